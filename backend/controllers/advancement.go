@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+// GroupLabel names a finishing place in a group stage, e.g. "A1" for the winner of the first
+// group or "B2" for the runner-up of the second.
+func GroupLabel(group, place int) string {
+	return string(rune('A'+group-1)) + strconv.Itoa(place)
+}
+
+// ParseGroupLabel splits a label such as "C2" into its 1-based group and place.
+func ParseGroupLabel(label string) (group, place int, err error) {
+	label = strings.ToUpper(strings.TrimSpace(label))
+	if len(label) < 2 || label[0] < 'A' || label[0] > 'Z' {
+		return 0, 0, fmt.Errorf("invalid group label %q", label)
+	}
+	place, err = strconv.Atoi(label[1:])
+	if err != nil || place < 1 {
+		return 0, 0, fmt.Errorf("invalid group label %q", label)
+	}
+	return int(label[0]-'A') + 1, place, nil
+}
+
+// ParseAdvancementMap reads a stored advancement mapping ("A1,B1,B2,A2"): the i-th label is the
+// group place that enters the next stage as seed i+1.
+func ParseAdvancementMap(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	labels := make([]string, 0, len(parts))
+	for _, p := range parts {
+		labels = append(labels, strings.ToUpper(strings.TrimSpace(p)))
+	}
+	return labels
+}
+
+// ValidateAdvancementMap checks that labels name every advancing group place exactly once.
+func ValidateAdvancementMap(labels []string, numGroups, perGroup int) error {
+	if len(labels) != numGroups*perGroup {
+		return fmt.Errorf("advancement mapping must list %d places, got %d", numGroups*perGroup, len(labels))
+	}
+	seen := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		group, place, err := ParseGroupLabel(l)
+		if err != nil {
+			return err
+		}
+		if group > numGroups || place > perGroup {
+			return fmt.Errorf("group label %s is outside the advancing places", l)
+		}
+		if seen[l] {
+			return fmt.Errorf("group label %s is listed twice", l)
+		}
+		seen[l] = true
+	}
+	return nil
+}
+
+// defaultAdvancementMap seeds group winners first (A1, B1, ...) and then places each later
+// finisher where it meets entrants of its own group as late as possible in a seeded bracket. With
+// two entrants per group this puts them on opposite halves and pairs winners with another
+// group's runner-up (A1 vs B2).
+func defaultAdvancementMap(numGroups, perGroup int) []string {
+	total := numGroups * perGroup
+	order := engine.BracketOrder(engine.NextPowerOfTwo(total))
+	pos := make(map[int]int, len(order))
+	for i, s := range order {
+		pos[s] = i
+	}
+
+	labels := make([]string, 0, total)
+	placed := make(map[int][]int, numGroups) // group -> bracket positions so far
+	for place := 1; place <= perGroup; place++ {
+		free := make([]bool, numGroups+1)
+		for g := 1; g <= numGroups; g++ {
+			free[g] = true
+		}
+		for range numGroups {
+			seed := len(labels) + 1
+			best, bestScore := 0, -1
+			for g := 1; g <= numGroups; g++ {
+				if !free[g] {
+					continue
+				}
+				// the earliest round this entrant could meet a group mate; higher is better
+				score := bits.Len(uint(len(order)))
+				for _, p := range placed[g] {
+					if r := bits.Len(uint(p ^ pos[seed])); r < score {
+						score = r
+					}
+				}
+				if score > bestScore {
+					best, bestScore = g, score
+				}
+			}
+			free[best] = false
+			placed[best] = append(placed[best], pos[seed])
+			labels = append(labels, GroupLabel(best, place))
+		}
+	}
+	return labels
+}
+
+// AdvancementSeeds assigns next-stage seeds to entrants advancing from a stage. ranked lists the
+// entrants by place across groups (1A, 1B, ..., 2A, 2B, ...), as returned by
+// GetTopNFromPrevStage. Without a mapping the default cross-group seeding is used.
+func AdvancementSeeds(ranked []entrant, numGroups int, mapping []string) ([]entrant, error) {
+	if numGroups < 1 {
+		numGroups = 1
+	}
+	if len(ranked)%numGroups != 0 {
+		return nil, fmt.Errorf("cannot split %d advancing entrants over %d groups", len(ranked), numGroups)
+	}
+	perGroup := len(ranked) / numGroups
+	if len(mapping) == 0 {
+		if numGroups == 1 {
+			// a single table keeps its finishing order
+			seeded := make([]entrant, len(ranked))
+			for i, e := range ranked {
+				seed := i + 1
+				seeded[i] = entrant{UserID: e.UserID, TeamID: e.TeamID, Seed: &seed}
+			}
+			return seeded, nil
+		}
+		mapping = defaultAdvancementMap(numGroups, perGroup)
+	}
+	if err := ValidateAdvancementMap(mapping, numGroups, perGroup); err != nil {
+		return nil, err
+	}
+
+	seeded := make([]entrant, 0, len(mapping))
+	for i, l := range mapping {
+		group, place, _ := ParseGroupLabel(l)
+		e := ranked[(place-1)*numGroups+group-1]
+		seed := i + 1
+		seeded = append(seeded, entrant{UserID: e.UserID, TeamID: e.TeamID, Seed: &seed})
+	}
+	return seeded, nil
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+func TestDefaultAdvancementMap_TwoGroups(t *testing.T) {
+	got := defaultAdvancementMap(2, 2)
+	want := []string{"A1", "B1", "A2", "B2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDefaultAdvancementMap_SameGroupOnOppositeHalves(t *testing.T) {
+	labels := defaultAdvancementMap(4, 2)
+	order := engine.BracketOrder(8)
+	half := make(map[int]int)
+	for i, s := range order {
+		half[s] = i / 4
+	}
+	groupHalf := make(map[byte]int)
+	for i, l := range labels {
+		h := half[i+1]
+		if prev, ok := groupHalf[l[0]]; ok && prev == h {
+			t.Errorf("entrants of group %c share a half: %v", l[0], labels)
+		}
+		groupHalf[l[0]] = h
+	}
+	// winners only meet runners-up in the first round
+	for i := 0; i < len(order); i += 2 {
+		a, b := labels[order[i]-1], labels[order[i+1]-1]
+		if a[1] == b[1] {
+			t.Errorf("first round pairs %s with %s", a, b)
+		}
+	}
+}
+
+func TestAdvancementSeeds_CustomMapping(t *testing.T) {
+	// ranked by place: A1=1, B1=2, A2=3, B2=4
+	seeded, err := AdvancementSeeds(userEntrants(1, 2, 3, 4), 2, []string{"B1", "A1", "A2", "B2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []int{2, 1, 3, 4}
+	for i, e := range seeded {
+		if *e.UserID != want[i] || *e.Seed != i+1 {
+			t.Errorf("seed %d: expected user %d, got %+v", i+1, want[i], e)
+		}
+	}
+}
+
+func TestAdvancementSeeds_InvalidMapping(t *testing.T) {
+	if _, err := AdvancementSeeds(userEntrants(1, 2, 3, 4), 2, []string{"A1", "A1", "B1", "B2"}); err == nil {
+		t.Error("expected error for duplicate label")
+	}
+	if _, err := AdvancementSeeds(userEntrants(1, 2, 3, 4), 2, []string{"A1", "B1", "C1", "B2"}); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
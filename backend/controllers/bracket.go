@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// Outcomes stored on match_slots: the slot takes the winner or the loser of its source match.
+const (
+	slotWinner = "W"
+	slotLoser  = "L"
+)
+
+// FillBracketSlots moves the winner and the loser of a match that has just been completed into
+// the later matches of a pre-generated bracket that wait on it. Each slot is filled once. A
+// double forfeit sends nobody on: its slots are filled empty, and a match left without an
+// opponent that way is settled as a walkover, as is one the filling puts a disqualified
+// entrant into.
+func FillBracketSlots(tx *sql.Tx, matchID int) error {
+	rows, err := tx.Query(
+		`SELECT match_id, source_outcome FROM match_slots WHERE source_match_id = $1 AND NOT filled`,
+		matchID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load match slots: %w", err)
+	}
+	type slot struct {
+		MatchID int
+		Outcome string
+	}
+	var slots []slot
+	for rows.Next() {
+		var s slot
+		if err := rows.Scan(&s.MatchID, &s.Outcome); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan match slot: %w", err)
+		}
+		slots = append(slots, s)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("row error: %w", err)
+	}
+	rows.Close()
+	if len(slots) == 0 {
+		return nil
+	}
+
+	var resultType string
+	if err := tx.QueryRow(`SELECT result_type FROM matches WHERE match_id = $1`, matchID).Scan(&resultType); err != nil {
+		return fmt.Errorf("failed to load match result type: %w", err)
+	}
+	for _, s := range slots {
+		if resultType != engine.ResultDoubleForfeit {
+			var e entrant
+			if err := tx.QueryRow(
+				`SELECT user_id, team_id FROM match_participants WHERE match_id = $1 AND is_winner = $2`,
+				matchID, s.Outcome == slotWinner,
+			).Scan(&e.UserID, &e.TeamID); err == sql.ErrNoRows {
+				return fmt.Errorf("match %d has no %s to advance", matchID, outcomeName(s.Outcome))
+			} else if err != nil {
+				return fmt.Errorf("failed to load match result: %w", err)
+			}
+			if err := insertParticipant(tx, s.MatchID, e); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(
+			`UPDATE match_slots SET filled = true WHERE match_id = $1 AND source_match_id = $2 AND source_outcome = $3`,
+			s.MatchID, matchID, s.Outcome,
+		); err != nil {
+			return fmt.Errorf("failed to fill match slot: %w", err)
+		}
+		if _, err := settleMatch(tx, s.MatchID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StageBracket returns every round and match of a stage in the order they were created, with
+// placeholders such as "winner of match 12" for the entrants still to come.
+func StageBracket(db *sql.DB, stageID int) ([]models.BracketRound, error) {
+	rows, err := db.Query(`
+        SELECT r.round_id, r.round_number, r.bracket, m.match_id, m.completed_at IS NOT NULL
+        FROM rounds r
+        JOIN matches m ON m.round_id = r.round_id
+        WHERE r.stage_id = $1
+        ORDER BY r.round_id, m.match_id
+    `, stageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bracket matches: %w", err)
+	}
+	defer rows.Close()
+
+	var rounds []models.BracketRound
+	for rows.Next() {
+		var round models.BracketRound
+		var m models.BracketMatch
+		if err := rows.Scan(&round.RoundID, &round.RoundNumber, &round.Bracket, &m.MatchID, &m.Completed); err != nil {
+			return nil, fmt.Errorf("failed to scan bracket match: %w", err)
+		}
+		if len(rounds) == 0 || rounds[len(rounds)-1].RoundID != round.RoundID {
+			rounds = append(rounds, round)
+		}
+		last := &rounds[len(rounds)-1]
+		last.Matches = append(last.Matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	// Matches are only indexed once every round is built, as appending moves them.
+	byMatch := make(map[int]*models.BracketMatch)
+	for r := range rounds {
+		for i := range rounds[r].Matches {
+			byMatch[rounds[r].Matches[i].MatchID] = &rounds[r].Matches[i]
+		}
+	}
+
+	prows, err := db.Query(`
+        SELECT mp.match_id, mp.user_id, mp.team_id, mp.is_winner, mp.score
+        FROM match_participants mp
+        JOIN matches m ON mp.match_id = m.match_id
+        JOIN rounds r ON m.round_id = r.round_id
+        WHERE r.stage_id = $1
+        ORDER BY mp.match_id
+    `, stageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bracket participants: %w", err)
+	}
+	defer prows.Close()
+	for prows.Next() {
+		var p models.MatchParticipant
+		if err := prows.Scan(&p.MatchID, &p.UserID, &p.TeamID, &p.IsWinner, &p.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan bracket participant: %w", err)
+		}
+		if m, ok := byMatch[p.MatchID]; ok {
+			m.Participants = append(m.Participants, p)
+		}
+	}
+	if err := prows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+
+	srows, err := db.Query(`
+        SELECT s.match_id, s.source_match_id, s.source_outcome
+        FROM match_slots s
+        JOIN matches m ON s.match_id = m.match_id
+        JOIN rounds r ON m.round_id = r.round_id
+        WHERE r.stage_id = $1 AND NOT s.filled
+        ORDER BY s.match_id, s.source_match_id
+    `, stageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bracket slots: %w", err)
+	}
+	defer srows.Close()
+	for srows.Next() {
+		var matchID int
+		var s models.BracketSlot
+		if err := srows.Scan(&matchID, &s.SourceMatchID, &s.Outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan bracket slot: %w", err)
+		}
+		s.Outcome = outcomeName(s.Outcome)
+		s.Label = s.Outcome + " of match " + strconv.Itoa(s.SourceMatchID)
+		if m, ok := byMatch[matchID]; ok {
+			m.Placeholders = append(m.Placeholders, s)
+		}
+	}
+	if err := srows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return rounds, nil
+}
+
+func outcomeName(outcome string) string {
+	if outcome == slotLoser {
+		return "loser"
+	}
+	return "winner"
+}
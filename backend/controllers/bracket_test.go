@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFillBracketSlots_AdvancesWinnerAndLoser(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT match_id, source_outcome FROM match_slots WHERE source_match_id = \$1 AND NOT filled`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_outcome"}).AddRow(12, "W").AddRow(15, "L"))
+	mock.ExpectQuery(`SELECT result_type FROM matches`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"result_type"}).AddRow("played"))
+	mock.ExpectQuery(`SELECT user_id, team_id FROM match_participants WHERE match_id = \$1 AND is_winner = \$2`).
+		WithArgs(7, true).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id"}).AddRow(3, nil))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(12, 3, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE match_slots SET filled = true`).WithArgs(12, 7, "W").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectSettleCheck(mock, 12, false)
+	mock.ExpectQuery(`SELECT user_id, team_id FROM match_participants WHERE match_id = \$1 AND is_winner = \$2`).
+		WithArgs(7, false).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id"}).AddRow(4, nil))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(15, 4, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE match_slots SET filled = true`).WithArgs(15, 7, "L").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectSettleCheck(mock, 15, false)
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := FillBracketSlots(tx, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
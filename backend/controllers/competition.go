@@ -2,527 +2,169 @@ package controllers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"sort"
+
+	"github.com/Drodrl/competition-engine/engine"
 )
 
-type entrant struct{ UserID, TeamID *int }
+// entrant is a user or team in a stage, as the engine plans with it.
+type entrant = engine.Entrant
 
-// GenerateRoundRobin will insert N–1 rounds and all their matches & participants.
-// Assumes an even number of entries in stage_participants.
+// GenerateRoundRobin will insert all rounds and all their matches & participants.
+// With an odd number of entries each round leaves one entrant without a match.
+// Stages with several groups get one schedule per group, played side by side in the same rounds.
+// A stage played over two legs gets a second cycle with every pairing's home and away swapped.
+// Entrants disqualified before the stage started are left out of the schedule.
 func GenerateRoundRobin(db *sql.DB, stageID int) error {
-	rows, err := db.Query(
-		`SELECT user_id, team_id FROM stage_participants WHERE stage_id=$1`,
+	var numGroups, legs int
+	if err := db.QueryRow(
+		`SELECT COALESCE(num_groups, 1), COALESCE(legs, 1) FROM competition_stages WHERE stage_id=$1`,
 		stageID,
-	)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	var entrants []entrant
-	for rows.Next() {
-		var e entrant
-		if err := rows.Scan(&e.UserID, &e.TeamID); err != nil {
-			return fmt.Errorf("failed to scan participant: %w", err)
-		}
-		entrants = append(entrants, e)
-	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("row error: %w", err)
-	}
-
-	N := len(entrants)
-	if N == 0 {
-		return fmt.Errorf("no participants in stage")
+	).Scan(&numGroups, &legs); err != nil {
+		return fmt.Errorf("failed to get number of groups: %w", err)
 	}
-	if N%2 != 0 {
-		return fmt.Errorf("expected even participants, got %d", N)
-	}
-	rounds := N - 1
-	log.Printf("Number of rounds: %d ", rounds)
 
-	tx, err := db.Begin()
+	entrants, draw, err := loadDrawnEntrants(db, stageID)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			panic(p)
-		} else if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-		}
-	}()
-
-	// insert rounds
-	roundIDs := make([]int, rounds)
-	for i := 1; i <= rounds; i++ {
-		if err := tx.QueryRow(
-			`INSERT INTO rounds (stage_id, round_number) VALUES ($1,$2) RETURNING round_id`,
-			stageID, i,
-		).Scan(&roundIDs[i-1]); err != nil {
-			return fmt.Errorf("failed to insert round: %w", err)
-		}
+		return err
 	}
-
-	// build circle
-	idx := make([]int, N)
-	for i := range idx {
-		idx[i] = i
+	groups, rounds, err := engine.RoundRobin(entrants, numGroups, legs)
+	if err != nil {
+		return err
 	}
-
-	for _, rid := range roundIDs {
-		for i := 0; i < N/2; i++ {
-			a, b := entrants[idx[i]], entrants[idx[N-1-i]]
-			var mid int
-			if err := tx.QueryRow(
-				`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-				rid,
-			).Scan(&mid); err != nil {
-				return fmt.Errorf("failed to insert match: %w", err)
-			}
-
-			_, err := tx.Exec(
-				`INSERT INTO match_participants
-                        (match_id,user_id,team_id,is_winner,score)
-                       VALUES
-                        ($1,$2,$3,false,NULL),
-                        ($1,$4,$5,false,NULL)`,
-				mid,
-				a.UserID, a.TeamID,
-				b.UserID, b.TeamID,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to insert match participants: %w", err)
+	log.Printf("Number of rounds: %d ", len(rounds))
+
+	return inTx(db, func(tx *sql.Tx) error {
+		if len(groups) > 1 {
+			for g, group := range groups {
+				for _, e := range group {
+					var err error
+					if e.UserID != nil {
+						_, err = tx.Exec(`UPDATE stage_participants SET group_number = $1 WHERE stage_id = $2 AND user_id = $3`, g+1, stageID, *e.UserID)
+					} else {
+						_, err = tx.Exec(`UPDATE stage_participants SET group_number = $1 WHERE stage_id = $2 AND team_id = $3`, g+1, stageID, *e.TeamID)
+					}
+					if err != nil {
+						return fmt.Errorf("failed to assign group: %w", err)
+					}
+				}
 			}
 		}
-		// rotate (keep 0 fixed)
-		tmp := idx[1]
-		copy(idx[1:], idx[2:])
-		idx[N-1] = tmp
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
+		return insertRounds(tx, stageID, rounds, draw)
+	})
 }
 
-func GenerateRoundSingleElim(db *sql.DB, stageID int) (err error) {
-	var nextRound int
-	err = db.QueryRow(
-		`SELECT COALESCE(MAX(round_number), 0) + 1 FROM rounds WHERE stage_id = $1`,
-		stageID,
-	).Scan(&nextRound)
+// GenerateRoundSingleElim inserts the next round of a single elimination stage, drawing the
+// entrants for the first round. A stage set to a full bracket gets every round at once instead.
+// Disqualified entrants are left out of the draw, and walked over in later rounds they reached.
+// A stage played over two legs gets a two-legged tie for every pairing, and sends on the winners
+// of the ties.
+func GenerateRoundSingleElim(db *sql.DB, stageID int) error {
+	results, err := loadKnockoutResults(db, stageID)
 	if err != nil {
-		return fmt.Errorf("failed to get next round number: %w", err)
+		return err
+	}
+	var thirdPlace, fullBracket bool
+	var legs int
+	if err := db.QueryRow(
+		`SELECT COALESCE(third_place_match, false), COALESCE(full_bracket, false), COALESCE(legs, 1) FROM competition_stages WHERE stage_id=$1`,
+		stageID,
+	).Scan(&thirdPlace, &fullBracket, &legs); err != nil {
+		return fmt.Errorf("failed to get bracket settings: %w", err)
+	}
+	if fullBracket && len(results) > 0 {
+		return errors.New("the whole bracket was generated when the stage started")
 	}
 
-	var rows *sql.Rows
 	var entrants []entrant
-	if nextRound == 1 {
-		rows, err = db.Query(
-			`SELECT user_id, team_id FROM stage_participants WHERE stage_id=$1`,
-			stageID,
-		)
-		if err != nil {
+	var draw *stageDraw
+	if len(results) == 0 {
+		if entrants, draw, err = loadDrawnEntrants(db, stageID); err != nil {
 			return err
 		}
-		defer rows.Close()
-		for rows.Next() {
-			var e entrant
-			if err := rows.Scan(&e.UserID, &e.TeamID); err != nil {
-				return fmt.Errorf("failed to scan participant: %w", err)
-			}
-			entrants = append(entrants, e)
-		}
-	} else {
-		rows, err = db.Query(
-			`SELECT mp.user_id, mp.team_id
-             FROM match_participants mp
-             JOIN matches m ON mp.match_id = m.match_id
-             JOIN rounds r ON m.round_id = r.round_id
-             WHERE r.stage_id = $1 AND r.round_number = $2 AND mp.is_winner = true`,
-			stageID, nextRound-1,
-		)
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var e entrant
-			if err := rows.Scan(&e.UserID, &e.TeamID); err != nil {
-				return fmt.Errorf("failed to scan participant: %w", err)
-			}
-			entrants = append(entrants, e)
-		}
 	}
-	N := len(entrants)
-	if N%2 != 0 {
-		return fmt.Errorf("expected even participants, got %d", N)
+	var rounds []engine.Round
+	if fullBracket {
+		rounds, err = engine.SingleElimBracket(entrants, thirdPlace)
+	} else {
+		rounds, err = engine.SingleElimNextRound(entrants, results, thirdPlace)
 	}
-
-	tx, txErr := db.Begin()
-	if txErr != nil {
-		return txErr
+	if err != nil {
+		return err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			panic(p)
-		} else if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-		}
-	}()
-
-	var roundID int
-	if err := tx.QueryRow(
-		`INSERT INTO rounds (stage_id, round_number) VALUES ($1,$2) RETURNING round_id`,
-		stageID, nextRound,
-	).Scan(&roundID); err != nil {
-		return fmt.Errorf("failed to insert round: %w", err)
+	if legs == 2 {
+		rounds = engine.TwoLegged(rounds)
 	}
-
-	for i := 0; i < N; i += 2 {
-		a := entrants[i]
-		b := entrants[i+1]
-		var matchID int
-		if err := tx.QueryRow(
-			`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-			roundID,
-		).Scan(&matchID); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert match: %w", err)
-		}
-
-		_, err := tx.Exec(
-			`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
-             VALUES ($1, $2, $3, false, NULL), ($1, $4, $5, false, NULL)`,
-			matchID,
-			a.UserID, a.TeamID,
-			b.UserID, b.TeamID,
-		)
-		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert match participants: %w", err)
+	return inTx(db, func(tx *sql.Tx) error {
+		if err := insertRounds(tx, stageID, rounds, draw); err != nil {
+			return err
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-	return nil
+		// Disqualified entrants who won their way into the new round forfeit straight away
+		return settleDisqualified(tx, stageID)
+	})
 }
 
-func GenerateRoundDoubleElim(db *sql.DB, stageID int) (err error) {
-	tx, txErr := db.Begin()
-	if txErr != nil {
-		return txErr
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			panic(p)
-		} else if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-		}
-	}()
-
-	var nextWinnersRound, nextLosersRound int
-	if err := tx.QueryRow(
-		`SELECT COALESCE(MAX(round_number), 0) + 1 FROM rounds WHERE stage_id = $1 AND bracket = 'W'`,
-		stageID,
-	).Scan(&nextWinnersRound); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-			log.Printf("rollback error: %v", rbErr)
-		}
-		return fmt.Errorf("failed to get next winners round: %w", err)
-	}
-	if err := tx.QueryRow(
-		`SELECT COALESCE(MAX(round_number), 0) + 1 FROM rounds WHERE stage_id = $1 AND bracket = 'L'`,
-		stageID,
-	).Scan(&nextLosersRound); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-			log.Printf("rollback error: %v", rbErr)
-		}
-		return fmt.Errorf("failed to get next losers round: %w", err)
-	}
-
-	var winners []entrant
-	if nextWinnersRound == 1 {
-		winnersRows, err := tx.Query(
-			`SELECT user_id, team_id FROM stage_participants WHERE stage_id=$1`,
-			stageID,
-		)
+// GenerateRoundDoubleElim inserts the next winners and losers bracket rounds of a double
+// elimination stage, or its grand final, drawing the entrants for the first round. A stage set
+// to a full bracket gets every round up to the grand final at once; once all of those are played
+// the only round that can follow is the grand final reset. A stage played over two legs gets a
+// two-legged tie for every pairing, as in single elimination. Disqualified entrants are left out
+// of the draw, as in single elimination.
+func GenerateRoundDoubleElim(db *sql.DB, stageID int) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		results, err := loadKnockoutResults(tx, stageID)
 		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
 			return err
 		}
-		defer winnersRows.Close()
-		for winnersRows.Next() {
-			var e entrant
-			if err := winnersRows.Scan(&e.UserID, &e.TeamID); err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to scan winners: %w", err)
-			}
-			winners = append(winners, e)
+		var fullBracket bool
+		var legs int
+		if err := tx.QueryRow(
+			`SELECT COALESCE(full_bracket, false), COALESCE(legs, 1) FROM competition_stages WHERE stage_id=$1`,
+			stageID,
+		).Scan(&fullBracket, &legs); err != nil {
+			return fmt.Errorf("failed to get bracket settings: %w", err)
 		}
-	} else {
-		winnersRows, err := tx.Query(
-			`SELECT mp.user_id, mp.team_id
-             FROM match_participants mp
-             JOIN matches m ON mp.match_id = m.match_id
-             JOIN rounds r ON m.round_id = r.round_id
-             WHERE r.stage_id = $1 AND r.bracket = 'W' AND r.round_number = $2 AND mp.is_winner = true`,
-			stageID, nextWinnersRound-1,
-		)
-		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
+		if len(results) > 0 {
+			rounds, err := engine.DoubleElimNextRound(nil, results)
+			if err != nil {
+				return err
 			}
-			return err
-		}
-		defer winnersRows.Close()
-		for winnersRows.Next() {
-			var e entrant
-			if err := winnersRows.Scan(&e.UserID, &e.TeamID); err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to scan winners: %w", err)
+			if legs == 2 {
+				rounds = engine.TwoLegged(rounds)
 			}
-			winners = append(winners, e)
+			if err := insertRounds(tx, stageID, rounds, nil); err != nil {
+				return err
+			}
+			// Disqualified entrants dropping into the losers bracket forfeit straight away
+			return settleDisqualified(tx, stageID)
 		}
-	}
-	Nw := len(winners)
 
-	var losers []entrant
-	var Nl int
-	if nextWinnersRound > 1 {
-		var losersRows *sql.Rows
-		losersRows, err = tx.Query(
-			`SELECT mp.user_id, mp.team_id
-             FROM match_participants mp
-             JOIN matches m ON mp.match_id = m.match_id
-             JOIN rounds r ON m.round_id = r.round_id
-             WHERE r.stage_id = $1 AND (
-                    (r.bracket = 'W' AND r.round_number = $2 AND mp.is_winner = false)
-                    OR
-                    (r.bracket = 'L' AND r.round_number = $3 AND mp.is_winner = true)
-             )`,
-			stageID, nextWinnersRound-1, nextLosersRound-1,
-		)
+		entrants, draw, err := loadDrawnEntrants(tx, stageID)
 		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
 			return err
 		}
-		defer losersRows.Close()
-		for losersRows.Next() {
-			var e entrant
-			if err := losersRows.Scan(&e.UserID, &e.TeamID); err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to scan losers: %w", err)
-			}
-			losers = append(losers, e)
-		}
-		Nl = len(losers)
-	}
-
-	if Nw == 1 && Nl == 1 {
-		var grandFinalRoundID int
-		if err := tx.QueryRow(
-			`INSERT INTO rounds (stage_id, round_number, bracket) VALUES ($1, 1, 'G') RETURNING round_id`,
-			stageID,
-		).Scan(&grandFinalRoundID); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert grand final round: %w", err)
-		}
-		var matchID int
-		if err := tx.QueryRow(
-			`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-			grandFinalRoundID,
-		).Scan(&matchID); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert grand final match: %w", err)
+		var rounds []engine.Round
+		if fullBracket {
+			rounds, err = engine.DoubleElimBracket(entrants)
+		} else {
+			rounds, err = engine.DoubleElimNextRound(entrants, nil)
 		}
-		_, err = tx.Exec(
-			`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
-             VALUES ($1, $2, $3, false, NULL), ($1, $4, $5, false, NULL)`,
-			matchID,
-			winners[0].UserID, winners[0].TeamID,
-			losers[0].UserID, losers[0].TeamID,
-		)
 		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert grand final participants: %w", err)
-		}
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit transaction: %w", err)
-		}
-		return nil
-	}
-
-	if Nw > 1 {
-		if Nw%2 != 0 {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("expected even participants in winners bracket, got %d", Nw)
-		}
-		var winnersRoundID int
-		if err := tx.QueryRow(
-			`INSERT INTO rounds (stage_id, round_number, bracket) VALUES ($1, $2, 'W') RETURNING round_id`,
-			stageID, nextWinnersRound,
-		).Scan(&winnersRoundID); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert winners round: %w", err)
-		}
-		for i := 0; i < Nw; i += 2 {
-			a := winners[i]
-			b := winners[i+1]
-			var matchID int
-			if err := tx.QueryRow(
-				`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-				winnersRoundID,
-			).Scan(&matchID); err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to insert winners match: %w", err)
-			}
-			_, err = tx.Exec(
-				`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
-                 VALUES ($1, $2, $3, false, NULL), ($1, $4, $5, false, NULL)`,
-				matchID,
-				a.UserID, a.TeamID,
-				b.UserID, b.TeamID,
-			)
-			if err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to insert winners match participants: %w", err)
-			}
-		}
-	}
-
-	if nextWinnersRound > 1 && Nl > 0 {
-		var losersRoundID int
-		if err := tx.QueryRow(
-			`INSERT INTO rounds (stage_id, round_number, bracket) VALUES ($1, $2, 'L') RETURNING round_id`,
-			stageID, nextLosersRound,
-		).Scan(&losersRoundID); err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-				log.Printf("rollback error: %v", rbErr)
-			}
-			return fmt.Errorf("failed to insert losers round: %w", err)
+			return err
 		}
-		if Nl == 2 {
-			a := losers[0]
-			b := losers[1]
-			var matchID int
-			if err := tx.QueryRow(
-				`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-				losersRoundID,
-			).Scan(&matchID); err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to insert losers final match: %w", err)
-			}
-			_, err = tx.Exec(
-				`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
-                 VALUES ($1, $2, $3, false, NULL), ($1, $4, $5, false, NULL)`,
-				matchID,
-				a.UserID, a.TeamID,
-				b.UserID, b.TeamID,
-			)
-			if err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("failed to insert losers final match participants: %w", err)
-			}
-		} else if Nl > 2 {
-			if Nl%2 != 0 {
-				if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-					log.Printf("rollback error: %v", rbErr)
-				}
-				return fmt.Errorf("expected even participants in losers bracket, got %d", Nl)
-			}
-			for i := 0; i < Nl; i += 2 {
-				a := losers[i]
-				b := losers[i+1]
-				var matchID int
-				if err := tx.QueryRow(
-					`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
-					losersRoundID,
-				).Scan(&matchID); err != nil {
-					if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-						log.Printf("rollback error: %v", rbErr)
-					}
-					return fmt.Errorf("failed to insert losers match: %w", err)
-				}
-				_, err = tx.Exec(
-					`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
-                     VALUES ($1, $2, $3, false, NULL), ($1, $4, $5, false, NULL)`,
-					matchID,
-					a.UserID, a.TeamID,
-					b.UserID, b.TeamID,
-				)
-				if err != nil {
-					if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
-						log.Printf("rollback error: %v", rbErr)
-					}
-					return fmt.Errorf("failed to insert losers match participants: %w", err)
-				}
-			}
+		if legs == 2 {
+			rounds = engine.TwoLegged(rounds)
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-	return nil
+		return insertRounds(tx, stageID, rounds, draw)
+	})
 }
 
-// Returns a slice of entrants (user_id, team_id) for the top N participants in the previous round robin stage.
-func GetTopNFromPrevRoundRobin(db *sql.DB, currentStageID int, n int) ([]entrant, error) {
+// GetTopNFromPrevStage returns the n best entrants of the stage before currentStageID, ranked by
+// the previous stage's own format and passing over disqualified entrants. The previous stage
+// must be finished.
+func GetTopNFromPrevStage(db *sql.DB, currentStageID int, n int) ([]entrant, error) {
 	var prevStageID int
 	if err := db.QueryRow(`
         SELECT stage_id FROM competition_stages
@@ -535,124 +177,74 @@ func GetTopNFromPrevRoundRobin(db *sql.DB, currentStageID int, n int) ([]entrant
 		return nil, fmt.Errorf("could not find previous stage: %w", err)
 	}
 
-	var prevFormatID int
-	if err := db.QueryRow(`SELECT tourney_format_id FROM competition_stages WHERE stage_id = $1`, prevStageID).Scan(&prevFormatID); err != nil {
+	var prevFormatID, numGroups int
+	if err := db.QueryRow(`SELECT tourney_format_id, COALESCE(num_groups, 1) FROM competition_stages WHERE stage_id = $1`, prevStageID).Scan(&prevFormatID, &numGroups); err != nil {
 		return nil, fmt.Errorf("could not get previous stage format: %w", err)
 	}
-	if prevFormatID != 3 {
-		return nil, fmt.Errorf("previous stage is not round robin")
+	if numGroups > 1 && n%numGroups != 0 {
+		return nil, fmt.Errorf("cannot advance %d participants evenly from %d groups", n, numGroups)
 	}
 
-	type participant struct {
-		UserID *int
-		TeamID *int
+	format, err := LookupFormat(prevFormatID)
+	if err != nil {
+		return nil, err
 	}
-	var participants []participant
-	rows, err := db.Query(`SELECT user_id, team_id FROM stage_participants WHERE stage_id = $1`, prevStageID)
+	// Group places come interleaved (1A, 1B, ..., 2A, 2B, ...), so the first n are the top
+	// n/numGroups of each group.
+	ranked, err := format.Rank(db, prevStageID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var p participant
-		if err := rows.Scan(&p.UserID, &p.TeamID); err != nil {
-			return nil, err
-		}
-		participants = append(participants, p)
+	if ranked, err = withoutDisqualified(db, prevStageID, ranked); err != nil {
+		return nil, err
 	}
+	if numGroups > 1 {
+		return topOfGroups(db, prevStageID, ranked, numGroups, n/numGroups)
+	}
+	if len(ranked) < n {
+		return nil, fmt.Errorf("previous stage has %d participants, cannot advance %d", len(ranked), n)
+	}
+	return ranked[:n], nil
+}
 
-	type score struct {
-		Entrant participant
-		Wins    int
+// topOfGroups takes the top perGroup entrants of every group from ranked, which lists each
+// group's entrants in order, and interleaves them by place again. Entrants removed from the
+// ranking, such as disqualified ones, would otherwise shift the places of every other group.
+func topOfGroups(q queryer, stageID int, ranked []entrant, numGroups, perGroup int) ([]entrant, error) {
+	rows, err := q.Query(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = $1`, stageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load groups: %w", err)
 	}
-	scores := make([]score, 0, len(participants))
-	for _, p := range participants {
-		var wins int
-		if p.UserID != nil {
-			if err := db.QueryRow(`
-                SELECT COUNT(*) FROM match_participants mp
-                JOIN matches m ON mp.match_id = m.match_id
-                JOIN rounds r ON m.round_id = r.round_id
-                WHERE r.stage_id = $1 AND mp.user_id = $2 AND mp.is_winner = true
-            `, prevStageID, *p.UserID).Scan(&wins); err != nil {
-				return nil, err
-			}
-		} else if p.TeamID != nil {
-			if err := db.QueryRow(`
-                SELECT COUNT(*) FROM match_participants mp
-                JOIN matches m ON mp.match_id = m.match_id
-                JOIN rounds r ON m.round_id = r.round_id
-                WHERE r.stage_id = $1 AND mp.team_id = $2 AND mp.is_winner = true
-            `, prevStageID, *p.TeamID).Scan(&wins); err != nil {
-				return nil, err
-			}
+	defer rows.Close()
+	groupOf := make(map[string]int)
+	for rows.Next() {
+		var e entrant
+		var group sql.NullInt64
+		if err := rows.Scan(&e.UserID, &e.TeamID, &group); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
 		}
-		scores = append(scores, score{Entrant: p, Wins: wins})
+		groupOf[e.Key()] = int(group.Int64)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
 	}
 
-	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].Wins > scores[j].Wins
-	})
-
-	i := 0
-	for i < len(scores) {
-		j := i + 1
-		for j < len(scores) && scores[j].Wins == scores[i].Wins {
-			j++
+	groups := make([][]entrant, numGroups)
+	for _, e := range ranked {
+		g := groupOf[e.Key()] - 1
+		if g < 0 || g >= numGroups {
+			return nil, fmt.Errorf("participant has no group assigned")
 		}
-		if j-i > 1 {
-			sort.SliceStable(scores[i:j], func(a, b int) bool {
-				pa := scores[i+a].Entrant
-				pb := scores[i+b].Entrant
-				var headToHeadWinsA, headToHeadWinsB int
-				if pa.UserID != nil && pb.UserID != nil {
-					if err := db.QueryRow(`
-                        SELECT COUNT(*) FROM matches m
-                        JOIN rounds r ON m.round_id = r.round_id
-                        JOIN match_participants mp1 ON mp1.match_id = m.match_id AND mp1.user_id = $1
-                        JOIN match_participants mp2 ON mp2.match_id = m.match_id AND mp2.user_id = $2
-                        WHERE r.stage_id = $3 AND mp1.is_winner = true
-                    `, *pa.UserID, *pb.UserID, prevStageID).Scan(&headToHeadWinsA); err != nil {
-						return false
-					}
-					if err := db.QueryRow(`
-                        SELECT COUNT(*) FROM matches m
-                        JOIN rounds r ON m.round_id = r.round_id
-                        JOIN match_participants mp1 ON mp1.match_id = m.match_id AND mp1.user_id = $1
-                        JOIN match_participants mp2 ON mp2.match_id = m.match_id AND mp2.user_id = $2
-                        WHERE r.stage_id = $3 AND mp1.is_winner = true
-                    `, *pb.UserID, *pa.UserID, prevStageID).Scan(&headToHeadWinsB); err != nil {
-						return false
-					}
-				} else if pa.TeamID != nil && pb.TeamID != nil {
-					if err := db.QueryRow(`
-                        SELECT COUNT(*) FROM matches m
-                        JOIN rounds r ON m.round_id = r.round_id
-                        JOIN match_participants mp1 ON mp1.match_id = m.match_id AND mp1.team_id = $1
-                        JOIN match_participants mp2 ON mp2.match_id = m.match_id AND mp2.team_id = $2
-                        WHERE r.stage_id = $3 AND mp1.is_winner = true
-                    `, *pa.TeamID, *pb.TeamID, prevStageID).Scan(&headToHeadWinsA); err != nil {
-						return false
-					}
-					if err := db.QueryRow(`
-                        SELECT COUNT(*) FROM matches m
-                        JOIN rounds r ON m.round_id = r.round_id
-                        JOIN match_participants mp1 ON mp1.match_id = m.match_id AND mp1.team_id = $1
-                        JOIN match_participants mp2 ON mp2.match_id = m.match_id AND mp2.team_id = $2
-                        WHERE r.stage_id = $3 AND mp1.is_winner = true
-                    `, *pb.TeamID, *pa.TeamID, prevStageID).Scan(&headToHeadWinsB); err != nil {
-						return false
-					}
-				}
-				return headToHeadWinsA > headToHeadWinsB
-			})
-		}
-		i = j
+		groups[g] = append(groups[g], e)
 	}
-
-	top := make([]entrant, 0, n)
-	for i := 0; i < n && i < len(scores); i++ {
-		top = append(top, entrant{UserID: scores[i].Entrant.UserID, TeamID: scores[i].Entrant.TeamID})
+	top := make([]entrant, 0, perGroup*numGroups)
+	for place := 0; place < perGroup; place++ {
+		for g := range groups {
+			if len(groups[g]) < perGroup {
+				return nil, fmt.Errorf("group %d has %d participants, cannot advance %d", g+1, len(groups[g]), perGroup)
+			}
+			top = append(top, groups[g][place])
+		}
 	}
 	return top, nil
 }
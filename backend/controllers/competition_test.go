@@ -2,7 +2,9 @@ package controllers
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -16,6 +18,31 @@ func setupMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
+// expectStageEntrants mocks the draw mode lookup and the unseeded stage participants query.
+func expectStageEntrants(mock sqlmock.Sqlmock, stageID int, drawMode string, userIDs ...int) {
+	mock.ExpectQuery(`SELECT COALESCE\(draw_mode, 'seeded'\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"draw_mode"}).AddRow(drawMode))
+	rows := sqlmock.NewRows([]string{"user_id", "team_id", "seed"})
+	for _, id := range userIDs {
+		rows.AddRow(id, nil, nil)
+	}
+	mock.ExpectQuery(`SELECT user_id, team_id, seed FROM stage_participants WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
+
+// expectSingleElimState mocks the results so far and the bracket settings that the next
+// single elimination round is planned from.
+func expectSingleElimState(mock sqlmock.Sqlmock, stageID int, results *sqlmock.Rows, thirdPlace, fullBracket bool) {
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(results)
+	mock.ExpectQuery(`SELECT COALESCE\(third_place_match, false\), COALESCE\(full_bracket, false\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"third_place_match", "full_bracket", "legs"}).AddRow(thirdPlace, fullBracket, 1))
+}
+
 // --- GenerateRoundSingleElim ---
 
 func TestGenerateRoundSingleElim_Success(t *testing.T) {
@@ -24,28 +51,23 @@ func TestGenerateRoundSingleElim_Success(t *testing.T) {
 
 	stageID := 1
 
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1`).
-		WithArgs(stageID).
-		WillReturnRows(sqlmock.NewRows([]string{"next_round"}).AddRow(1))
+	expectSingleElimState(mock, stageID, resultRows(), false, false)
 
-	rows := sqlmock.NewRows([]string{"user_id", "team_id"}).
-		AddRow(1, nil).
-		AddRow(2, nil)
-	mock.ExpectQuery(`SELECT user_id, team_id FROM stage_participants WHERE stage_id=\$1`).
-		WithArgs(stageID).
-		WillReturnRows(rows)
+	expectStageEntrants(mock, stageID, "seeded", 1, 2)
+	expectDisqualified(mock, stageID)
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1,\$2\) RETURNING round_id`).
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
 		WithArgs(stageID, 1).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
 
 	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
 		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
 
 	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
-		100, 1, nil, 2, nil,
+		100, 1, nil, nil, 2, nil, nil,
 	).WillReturnResult(sqlmock.NewResult(1, 2))
 
+	expectDisqualifiedMatches(mock, stageID)
 	mock.ExpectCommit()
 
 	err := GenerateRoundSingleElim(db, stageID)
@@ -59,21 +81,158 @@ func TestGenerateRoundSingleElim_OddParticipants(t *testing.T) {
 	defer db.Close()
 
 	stageID := 1
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1`).
-		WithArgs(stageID).
-		WillReturnRows(sqlmock.NewRows([]string{"next_round"}).AddRow(1))
+	expectSingleElimState(mock, stageID, resultRows(), false, false)
 
-	rows := sqlmock.NewRows([]string{"user_id", "team_id"}).
-		AddRow(1, nil).
-		AddRow(2, nil).
-		AddRow(3, nil)
-	mock.ExpectQuery(`SELECT user_id, team_id FROM stage_participants WHERE stage_id=\$1`).
-		WithArgs(stageID).
-		WillReturnRows(rows)
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+
+	// Top seed gets the bye
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at, completed_at\)`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
+		100, 1, nil,
+	).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(101))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
+		101, 2, nil, nil, 3, nil, nil,
+	).WillReturnResult(sqlmock.NewResult(1, 2))
+
+	expectDisqualifiedMatches(mock, stageID)
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSingleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSingleElim_FullBracket(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	expectSingleElimState(mock, stageID, resultRows(), false, true)
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at, completed_at\)`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(100, 1, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(101))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(101, 2, nil, nil, 3, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+
+	// the final is created at once: the bye winner waits for the winner of match 101
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 2).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(11))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(11).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(102))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(102, 1, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO match_slots \(match_id, source_match_id, source_outcome\)`).WithArgs(102, 101, "W").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectDisqualifiedMatches(mock, stageID)
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSingleElim(db, stageID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSingleElim_DisqualifiedBeforeDraw(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	expectSingleElimState(mock, stageID, resultRows(), false, false)
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID, 3)
+
+	// user 3 is left out, so the first round is a single match without a bye
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(100, 1, nil, nil, 2, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	expectDisqualifiedMatches(mock, stageID)
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSingleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSingleElim_DisqualifiedMidBracket(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	results := resultRows().
+		AddRow(100, "", 1, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(100, "", 1, true, 4, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(101, "", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(101, "", 1, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil)
+	expectSingleElimState(mock, stageID, results, false, false)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 2).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(11))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(11).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(102))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(102, 1, nil, nil, 2, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	// user 2 was disqualified after winning their semifinal: user 1 wins the final by walkover
+	expectDisqualifiedMatches(mock, stageID, 102)
+	expectSettleCheck(mock, 102, true)
+	expectSettleParticipants(mock, 102, map[int]bool{1: false, 2: true}, 1, 2)
+	mock.ExpectExec(`UPDATE match_participants SET is_winner = true`).
+		WithArgs(102, 1, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\), result_type = \$2`).
+		WithArgs(102, "walkover").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 102)
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSingleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSingleElim_FullBracketAlreadyGenerated(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	expectSingleElimState(mock, stageID, resultRows().AddRow(100, "", 1, false, 1, nil, false, nil, "played", nil, nil, 0, 0, nil), false, true)
 
 	err := GenerateRoundSingleElim(db, stageID)
-	if err == nil || err.Error() != "expected even participants, got 3" {
-		t.Errorf("expected error for odd participants, got: %v", err)
+	if err == nil || err.Error() != "the whole bracket was generated when the stage started" {
+		t.Errorf("expected bracket already generated error, got: %v", err)
 	}
 }
 
@@ -82,7 +241,7 @@ func TestGenerateRoundSingleElim_DBError(t *testing.T) {
 	defer db.Close()
 
 	stageID := 1
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1`).
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
 		WithArgs(stageID).
 		WillReturnError(errors.New("db error"))
 
@@ -92,39 +251,103 @@ func TestGenerateRoundSingleElim_DBError(t *testing.T) {
 	}
 }
 
-// --- GenerateRoundDoubleElim ---
+// --- GenerateRoundRobin ---
 
-func TestGenerateRoundDoubleElim_Success_FirstRound(t *testing.T) {
+func TestGenerateRoundRobin_TwoLegsSwapSides(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
 	stageID := 1
 
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups", "legs"}).AddRow(1, 2))
+	expectStageEntrants(mock, stageID, "seeded", 1, 2)
+	expectDisqualified(mock, stageID)
+
 	mock.ExpectBegin()
+	// user 2 hosts the first leg, user 1 the return leg
+	for r, participants := range [][]driver.Value{{2, nil, "home", 1, nil, "away"}, {1, nil, "home", 2, nil, "away"}} {
+		mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+			WithArgs(stageID, r+1).
+			WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10 + r))
+		mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+			WithArgs(10 + r).
+			WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100 + r))
+		mock.ExpectExec(`INSERT INTO match_participants \(match_id, user_id, team_id, is_winner, score, side\)`).
+			WithArgs(append([]driver.Value{100 + r}, participants...)...).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+	}
+	mock.ExpectCommit()
 
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1 AND bracket = 'W'`).
-		WithArgs(stageID).
-		WillReturnRows(sqlmock.NewRows([]string{"next_winners_round"}).AddRow(1))
+	if err := GenerateRoundRobin(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
 
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1 AND bracket = 'L'`).
-		WithArgs(stageID).
-		WillReturnRows(sqlmock.NewRows([]string{"next_losers_round"}).AddRow(1))
+func TestGenerateRoundRobin_LeavesOutDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"user_id", "team_id"}).
-		AddRow(1, nil).
-		AddRow(2, nil)
-	mock.ExpectQuery(`SELECT user_id, team_id FROM stage_participants WHERE stage_id=\$1`).
+	stageID := 1
+
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
 		WithArgs(stageID).
-		WillReturnRows(rows)
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups", "legs"}).AddRow(1, 1))
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID, 3)
 
-	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number, bracket\) VALUES \(\$1, \$2, 'W'\) RETURNING round_id`).
+	// user 3 gets no matches, and no byes either
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
 		WithArgs(stageID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(100, 2, nil, "home", 1, nil, "away").
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	if err := GenerateRoundRobin(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// --- GenerateRoundDoubleElim ---
+
+func TestGenerateRoundDoubleElim_Success_FirstRound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	mock.ExpectQuery(`SELECT COALESCE\(full_bracket, false\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"full_bracket", "legs"}).AddRow(false, 1))
+
+	expectStageEntrants(mock, stageID, "seeded", 1, 2)
+	expectDisqualified(mock, stageID)
+
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number, bracket\) VALUES \(\$1, \$2, \$3\) RETURNING round_id`).
+		WithArgs(stageID, 1, "W").
 		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(21))
 	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
 		WithArgs(21).
 		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(201))
 	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
-		201, 1, nil, 2, nil,
+		201, 1, nil, nil, 2, nil, nil,
 	).WillReturnResult(sqlmock.NewResult(1, 2))
 
 	mock.ExpectCommit()
@@ -135,15 +358,103 @@ func TestGenerateRoundDoubleElim_Success_FirstRound(t *testing.T) {
 	}
 }
 
+func TestGenerateRoundDoubleElim_FirstRoundLeavesOutDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	mock.ExpectQuery(`SELECT COALESCE\(full_bracket, false\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"full_bracket", "legs"}).AddRow(false, 1))
+
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID, 3)
+
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number, bracket\) VALUES \(\$1, \$2, \$3\) RETURNING round_id`).
+		WithArgs(stageID, 1, "W").
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(21))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(21).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(201))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
+		201, 1, nil, nil, 2, nil, nil,
+	).WillReturnResult(sqlmock.NewResult(1, 2))
+
+	mock.ExpectCommit()
+
+	if err := GenerateRoundDoubleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundDoubleElim_TwoLeggedTies(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	mock.ExpectQuery(`SELECT COALESCE\(full_bracket, false\), COALESCE\(legs, 1\) FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"full_bracket", "legs"}).AddRow(false, 2))
+
+	expectStageEntrants(mock, stageID, "seeded", 1, 2)
+	expectDisqualified(mock, stageID)
+
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number, bracket\) VALUES \(\$1, \$2, \$3\) RETURNING round_id`).
+		WithArgs(stageID, 1, "W").
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(21))
+	// The higher seed plays the first leg away and the second at home; both legs point at the first.
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(21).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(201))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
+		201, 2, nil, "home", 1, nil, "away",
+	).WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec(`UPDATE matches SET leg = \$1, first_leg_id = \$2 WHERE match_id = \$3`).
+		WithArgs(1, 201, 201).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(21).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(202))
+	mock.ExpectExec(`INSERT INTO match_participants`).WithArgs(
+		202, 1, nil, "home", 2, nil, "away",
+	).WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec(`UPDATE matches SET leg = \$1, first_leg_id = \$2 WHERE match_id = \$3`).
+		WithArgs(2, 201, 202).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	if err := GenerateRoundDoubleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
 func TestGenerateRoundDoubleElim_DBError(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
 	stageID := 1
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT COALESCE\(MAX\(round_number\), 0\) \+ 1 FROM rounds WHERE stage_id = \$1 AND bracket = 'W'`).
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
 		WithArgs(stageID).
 		WillReturnError(errors.New("db error"))
+	mock.ExpectRollback()
 
 	err := GenerateRoundDoubleElim(db, stageID)
 	if err == nil || err.Error() == "" {
@@ -151,9 +462,33 @@ func TestGenerateRoundDoubleElim_DBError(t *testing.T) {
 	}
 }
 
-// --- GetTopNFromPrevRoundRobin ---
+// --- GetTopNFromPrevStage ---
+
+func resultRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"})
+}
+
+func expectStageResults(mock sqlmock.Sqlmock, stageID int, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT COALESCE\(points_win, 3\), COALESCE\(points_draw, 1\), COALESCE\(points_loss, 0\), COALESCE\(tiebreakers, ''\),`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"points_win", "points_draw", "points_loss", "tiebreakers", "forfeit_points", "awarded_score", "retired_as_forfeit"}).AddRow(3, 1, 0, "", 0, nil, false))
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
 
-func TestGetTopNFromPrevRoundRobin_Success(t *testing.T) {
+// expectDisqualified mocks the lookup of the users disqualified from a stage's competition.
+func expectDisqualified(mock sqlmock.Sqlmock, stageID int, userIDs ...int) {
+	rows := sqlmock.NewRows([]string{"user_id", "team_id"})
+	for _, id := range userIDs {
+		rows.AddRow(id, nil)
+	}
+	mock.ExpectQuery(`SELECT cp.user_id, cp.team_id\s+FROM competition_participants cp`).
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
+
+func TestGetTopNFromPrevStage_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
@@ -164,25 +499,25 @@ func TestGetTopNFromPrevRoundRobin_Success(t *testing.T) {
 		WithArgs(currentStageID).
 		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(prevStageID))
 
-	mock.ExpectQuery(`SELECT tourney_format_id FROM competition_stages WHERE stage_id = \$1`).
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 1))
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
 		WithArgs(prevStageID).
-		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(3))
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups"}).AddRow(1))
 
-	rows := sqlmock.NewRows([]string{"user_id", "team_id"}).
-		AddRow(1, nil).
-		AddRow(2, nil)
-	mock.ExpectQuery(`SELECT user_id, team_id FROM stage_participants WHERE stage_id = \$1`).
+	rows := sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).
+		AddRow(1, nil, nil).
+		AddRow(2, nil, nil)
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
 		WithArgs(prevStageID).
 		WillReturnRows(rows)
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM match_participants mp`).
-		WithArgs(prevStageID, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM match_participants mp`).
-		WithArgs(prevStageID, 2).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	expectStageResults(mock, prevStageID, resultRows().
+		AddRow(10, "", 1, true, 1, nil, true, 2, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 2, nil, false, 1, "played", nil, nil, 0, 0, nil))
 
-	top, err := GetTopNFromPrevRoundRobin(db, currentStageID, 1)
+	expectDisqualified(mock, prevStageID)
+	top, err := GetTopNFromPrevStage(db, currentStageID, 1)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -191,7 +526,7 @@ func TestGetTopNFromPrevRoundRobin_Success(t *testing.T) {
 	}
 }
 
-func TestGetTopNFromPrevRoundRobin_NoPrevStage(t *testing.T) {
+func TestGetTopNFromPrevStage_NoPrevStage(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
@@ -200,13 +535,13 @@ func TestGetTopNFromPrevRoundRobin_NoPrevStage(t *testing.T) {
 		WithArgs(currentStageID).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := GetTopNFromPrevRoundRobin(db, currentStageID, 1)
+	_, err := GetTopNFromPrevStage(db, currentStageID, 1)
 	if err == nil || err.Error() == "" {
 		t.Errorf("expected error for no previous stage, got: %v", err)
 	}
 }
 
-func TestGetTopNFromPrevRoundRobin_NotRoundRobin(t *testing.T) {
+func TestGetTopNFromPrevStage_SingleElimination(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
@@ -217,17 +552,28 @@ func TestGetTopNFromPrevRoundRobin_NotRoundRobin(t *testing.T) {
 		WithArgs(currentStageID).
 		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(prevStageID))
 
-	mock.ExpectQuery(`SELECT tourney_format_id FROM competition_stages WHERE stage_id = \$1`).
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
 		WithArgs(prevStageID).
-		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(2)) // Not round robin
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(1, 1))
+
+	// 3 wins the final against 1, 4 wins the third place match against 2
+	expectBracketResults(mock, prevStageID, []int{1, 2, 3, 4}, resultRows().
+		AddRow(10, "", 1, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 4, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(11, "", 1, true, 2, nil, false, nil, "played", nil, nil, 0, 0, nil).AddRow(11, "", 1, true, 3, nil, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(12, "", 2, true, 1, nil, false, nil, "played", nil, nil, 0, 0, nil).AddRow(12, "", 2, true, 3, nil, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(13, "T", 2, true, 2, nil, false, nil, "played", nil, nil, 0, 0, nil).AddRow(13, "T", 2, true, 4, nil, true, nil, "played", nil, nil, 0, 0, nil))
 
-	_, err := GetTopNFromPrevRoundRobin(db, currentStageID, 1)
-	if err == nil || err.Error() != "previous stage is not round robin" {
-		t.Errorf("expected error for not round robin, got: %v", err)
+	expectDisqualified(mock, prevStageID)
+	top, err := GetTopNFromPrevStage(db, currentStageID, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(top) != 3 || *top[0].UserID != 3 || *top[1].UserID != 1 || *top[2].UserID != 4 {
+		t.Errorf("expected 3, 1, 4, got %+v", top)
 	}
 }
 
-func TestGetTopNFromPrevRoundRobin_DBError(t *testing.T) {
+func TestGetTopNFromPrevStage_DBError(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 
@@ -238,16 +584,111 @@ func TestGetTopNFromPrevRoundRobin_DBError(t *testing.T) {
 		WithArgs(currentStageID).
 		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(prevStageID))
 
-	mock.ExpectQuery(`SELECT tourney_format_id FROM competition_stages WHERE stage_id = \$1`).
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
 		WithArgs(prevStageID).
-		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(3))
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 1))
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups"}).AddRow(1))
 
-	mock.ExpectQuery(`SELECT user_id, team_id FROM stage_participants WHERE stage_id = \$1`).
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
 		WithArgs(prevStageID).
 		WillReturnError(errors.New("db error"))
 
-	_, err := GetTopNFromPrevRoundRobin(db, currentStageID, 1)
+	_, err := GetTopNFromPrevStage(db, currentStageID, 1)
 	if err == nil || err.Error() == "" {
 		t.Errorf("expected db error, got: %v", err)
 	}
 }
+
+func TestGetTopNFromPrevStage_Groups(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	currentStageID := 2
+	prevStageID := 1
+
+	mock.ExpectQuery(`SELECT stage_id FROM competition_stages`).
+		WithArgs(currentStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(prevStageID))
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 2))
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups"}).AddRow(2))
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).
+			AddRow(1, nil, 1).AddRow(2, nil, 2).AddRow(3, nil, 2).AddRow(4, nil, 1))
+
+	// group 1: user 4 beats user 1, group 2: user 2 beats user 3
+	expectStageResults(mock, prevStageID, resultRows().
+		AddRow(10, "", 1, true, 1, nil, false, nil, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 4, nil, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(11, "", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(11, "", 1, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil))
+
+	expectDisqualified(mock, prevStageID)
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).
+			AddRow(1, nil, 1).AddRow(2, nil, 2).AddRow(3, nil, 2).AddRow(4, nil, 1))
+	top, err := GetTopNFromPrevStage(db, currentStageID, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(top) != 2 || *top[0].UserID != 4 || *top[1].UserID != 2 {
+		t.Errorf("expected group winners 4 and 2, got %+v", top)
+	}
+}
+
+func TestGetTopNFromPrevStage_GroupsWithDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	currentStageID := 2
+	prevStageID := 1
+
+	mock.ExpectQuery(`SELECT stage_id FROM competition_stages`).
+		WithArgs(currentStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(prevStageID))
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 2))
+	mock.ExpectQuery(`SELECT COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(sqlmock.NewRows([]string{"num_groups"}).AddRow(2))
+	groups := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).
+			AddRow(1, nil, 1).AddRow(4, nil, 1).AddRow(5, nil, 1).
+			AddRow(2, nil, 2).AddRow(3, nil, 2).AddRow(6, nil, 2)
+	}
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(groups())
+
+	// group 1 finishes 4, 1, 5 and group 2 finishes 2, 3, 6
+	expectStageResults(mock, prevStageID, resultRows().
+		AddRow(10, "", 1, true, 4, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 1, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(11, "", 1, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(11, "", 1, true, 5, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(12, "", 1, true, 4, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(12, "", 1, true, 5, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(13, "", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(13, "", 1, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(14, "", 1, true, 3, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(14, "", 1, true, 6, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(15, "", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(15, "", 1, true, 6, nil, false, nil, "played", nil, nil, 0, 0, nil))
+
+	// the group 1 winner is disqualified: the rest of group 1 moves up, group 2 keeps its places
+	expectDisqualified(mock, prevStageID, 4)
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
+		WithArgs(prevStageID).
+		WillReturnRows(groups())
+	top, err := GetTopNFromPrevStage(db, currentStageID, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []int
+	for _, e := range top {
+		got = append(got, *e.UserID)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 5, 3}) {
+		t.Errorf("expected 1A 1, 1B 2, 2A 5, 2B 3, got %v", got)
+	}
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// CorrectionBlockedError is returned when a corrected result would change matches that have
+// already been played and the caller did not confirm voiding them. Played lists those matches.
+type CorrectionBlockedError struct {
+	Played []int
+}
+
+func (e *CorrectionBlockedError) Error() string {
+	return "the corrected result changes matches that have already been played"
+}
+
+// CorrectResult replaces the result of a completed match and repairs the matches its old result
+// was carried into. Only a change of winner in an elimination stage moves anyone: the entrant
+// who now wins takes the old winner's place in the next match that winner played, and the old
+// winner takes the loser's. Matches not played yet just get the corrected entrant. Played ones
+// are listed in a *CorrectionBlockedError unless voidPlayed is set, in which case their results
+// are cleared and the entrants they sent further on are replaced by placeholders that fill again
+// once they are replayed. A match that only exists because of the old result, such as a grand
+// final reset, is removed; generating the next round recreates whatever the new result calls for.
+// Table stages keep their later rounds as drawn; a heat whose qualifiers have already been
+// drawn into the next round cannot be corrected, nor can the winner of a ladder challenge, a
+// leg of a tie that has been carried forward, or an elimination match that sent nobody on, such
+// as a double forfeit, once later matches have been settled without it. A corrected leg of a tie that has not been carried
+// forward gets a decider when it leaves the tie level, or loses one not played yet when it no
+// longer does. A corrected walkover, forfeit or retirement becomes a played result, and the
+// games of a corrected best-of series are discarded.
+func CorrectResult(db *sql.DB, matchID int, results []ParticipantResult, voidPlayed bool) (*models.Correction, error) {
+	correction := &models.Correction{MatchID: matchID}
+	err := inTx(db, func(tx *sql.Tx) error {
+		st, err := loadMatchState(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if !st.Completed {
+			return resultError(CodeMatchNotCompleted, "match %d has no result to correct yet", matchID)
+		}
+		if st.StageClosed {
+			return resultError(CodeResultLocked, "the entrants of this stage have already moved on")
+		}
+		if st.Downstream && FormatRanksByPlacement(st.FormatID) {
+			return resultError(CodeResultLocked, "the next round of heats has already been drawn from match %d", matchID)
+		}
+		if st.Downstream && st.Leg > 0 {
+			return resultError(CodeResultLocked, "the tie of match %d has already been carried forward", matchID)
+		}
+		merged, err := st.merge(matchID, results)
+		if err != nil {
+			return err
+		}
+		for i, e := range st.Entrants {
+			if _, err := tx.Exec(`
+                UPDATE match_participants SET score = $1, is_winner = $2, placement = $3, time_ms = $4
+                WHERE match_id = $5 AND user_id IS NOT DISTINCT FROM $6 AND team_id IS NOT DISTINCT FROM $7
+            `, merged[i].Score, merged[i].IsWinner, merged[i].Placement, merged[i].TimeMs, matchID, e.UserID, e.TeamID); err != nil {
+				return fmt.Errorf("failed to update result: %w", err)
+			}
+		}
+		// The corrected result replaces how the match was decided: it is a played result now, and
+		// the games of a best-of series no longer add up to it.
+		if _, err := tx.Exec(`DELETE FROM match_games WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to clear games: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE matches SET result_type = 'played' WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to update result type: %w", err)
+		}
+
+		oldWinner, newWinner := winnerIndex(st.Stored), winnerIndex(merged)
+		if st.FormatID == models.Ladder && oldWinner != newWinner {
+			return resultError(CodeResultLocked, "the ladder has already been reordered by the result of match %d", matchID)
+		}
+		if st.Leg > 0 {
+			return decideTie(tx, matchID)
+		}
+		elimination := st.FormatID == models.SingleElimination || st.FormatID == models.DoubleElimination
+		if elimination && st.Downstream && oldWinner < 0 && newWinner >= 0 {
+			return resultError(CodeResultLocked, "match %d sent nobody on and the matches after it have been settled without it", matchID)
+		}
+		if !elimination || len(st.Entrants) != 2 || oldWinner < 0 || newWinner < 0 || oldWinner == newWinner {
+			return nil
+		}
+
+		stage, err := loadStageResults(tx, st.StageID)
+		if err != nil {
+			return err
+		}
+		plan := newRepairPlan(stage)
+		plan.swap(matchID, st.Entrants[oldWinner], st.Entrants[newWinner])
+		if len(plan.played) > 0 && !voidPlayed {
+			return &CorrectionBlockedError{Played: plan.played}
+		}
+		for _, op := range plan.ops {
+			if err := op(tx); err != nil {
+				return err
+			}
+		}
+		correction.Swapped, correction.Voided, correction.Removed = plan.swapped, plan.voided, plan.removed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
+
+func winnerIndex(result []ParticipantResult) int {
+	for i, p := range result {
+		if p.IsWinner {
+			return i
+		}
+	}
+	return -1
+}
+
+// repairPlan works out the downstream changes of a corrected result on an in-memory copy of the
+// stage and collects the writes that make them. An entrant who went on from a match is found in
+// the first later match of the stage they appear in, which covers pre-generated brackets and
+// rounds generated one at a time alike.
+type repairPlan struct {
+	matches []*matchResult
+	gone    map[int]bool
+
+	swapped, voided, removed []int
+	played                   []int
+	ops                      []func(tx *sql.Tx) error
+}
+
+func newRepairPlan(results []matchResult) *repairPlan {
+	p := &repairPlan{gone: make(map[int]bool)}
+	for i := range results {
+		p.matches = append(p.matches, &results[i])
+	}
+	return p
+}
+
+// next returns the first match after the given one that the entrant plays in.
+func (p *repairPlan) next(after int, e entrant) *matchResult {
+	for _, m := range p.matches {
+		if m.MatchID > after && !p.gone[m.MatchID] && entrantIndex(m, e) >= 0 {
+			return m
+		}
+	}
+	return nil
+}
+
+func entrantIndex(m *matchResult, e entrant) int {
+	for i, x := range m.Entrants {
+		if x.Key() == e.Key() {
+			return i
+		}
+	}
+	return -1
+}
+
+// swap repairs what follows a match whose winner changed from oldWinner to newWinner.
+func (p *repairPlan) swap(matchID int, oldWinner, newWinner entrant) {
+	type move struct {
+		target   *matchResult
+		from, to entrant
+	}
+	var moves []move
+	if t := p.next(matchID, oldWinner); t != nil {
+		moves = append(moves, move{t, oldWinner, newWinner})
+	}
+	if t := p.next(matchID, newWinner); t != nil {
+		moves = append(moves, move{t, newWinner, oldWinner})
+	}
+	// Both moves are found before either is made, then made in bracket order.
+	sort.Slice(moves, func(i, j int) bool { return moves[i].target.MatchID < moves[j].target.MatchID })
+	for _, mv := range moves {
+		t := mv.target
+		if p.gone[t.MatchID] {
+			continue
+		}
+		if entrantIndex(t, mv.to) >= 0 {
+			p.remove(t)
+			continue
+		}
+		if t.Completed {
+			p.void(t)
+		}
+		i := entrantIndex(t, mv.from)
+		t.Entrants[i] = mv.to
+		p.swapped = append(p.swapped, t.MatchID)
+		matchID, from, to := t.MatchID, mv.from, mv.to
+		p.ops = append(p.ops, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`
+                UPDATE match_participants SET user_id = $1, team_id = $2
+                WHERE match_id = $3 AND user_id IS NOT DISTINCT FROM $4 AND team_id IS NOT DISTINCT FROM $5
+            `, to.UserID, to.TeamID, matchID, from.UserID, from.TeamID); err != nil {
+				return fmt.Errorf("failed to swap entrant: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// void clears the result of a played match.
+func (p *repairPlan) void(m *matchResult) {
+	p.voided = append(p.voided, m.MatchID)
+	p.played = append(p.played, m.MatchID)
+	p.clear(m)
+}
+
+// remove deletes a match, clearing its result first if it was played.
+func (p *repairPlan) remove(m *matchResult) {
+	if m.Completed {
+		p.played = append(p.played, m.MatchID)
+		p.clear(m)
+	}
+	p.gone[m.MatchID] = true
+	p.removed = append(p.removed, m.MatchID)
+	matchID := m.MatchID
+	p.ops = append(p.ops, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM match_participants WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to remove match participants: %w", err)
+		}
+		var roundID int
+		if err := tx.QueryRow(`DELETE FROM matches WHERE match_id = $1 RETURNING round_id`, matchID).Scan(&roundID); err != nil {
+			return fmt.Errorf("failed to remove match: %w", err)
+		}
+		if _, err := tx.Exec(`
+            DELETE FROM rounds r
+            WHERE r.round_id = $1 AND NOT EXISTS (SELECT 1 FROM matches m WHERE m.round_id = r.round_id)
+        `, roundID); err != nil {
+			return fmt.Errorf("failed to remove empty round: %w", err)
+		}
+		return nil
+	})
+}
+
+// clear undoes a match result: the result and its games are wiped, and every entrant it sent on
+// is taken out of the next match they played, leaving a placeholder for the replayed result.
+// A later match holding both entrants only existed because of the result and is removed.
+func (p *repairPlan) clear(m *matchResult) {
+	type sent struct {
+		entrant entrant
+		loser   bool
+		target  *matchResult
+	}
+	var out []sent
+	for i, e := range m.Entrants {
+		if t := p.next(m.MatchID, e); t != nil {
+			out = append(out, sent{e, !m.IsWinner[i], t})
+		}
+	}
+	m.Completed = false
+	for i := range m.IsWinner {
+		m.IsWinner[i], m.Scores[i] = false, nil
+	}
+	matchID := m.MatchID
+	p.ops = append(p.ops, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE match_participants SET is_winner = false, score = NULL, placement = NULL, time_ms = NULL WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to clear result: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM match_games WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to clear games: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE matches SET completed_at = NULL, result_type = 'played' WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to reopen match: %w", err)
+		}
+		return nil
+	})
+
+	shared := make(map[int]int)
+	for _, s := range out {
+		shared[s.target.MatchID]++
+	}
+	for _, s := range out {
+		if p.gone[s.target.MatchID] {
+			continue
+		}
+		if shared[s.target.MatchID] > 1 {
+			p.remove(s.target)
+			continue
+		}
+		if s.target.Completed {
+			p.void(s.target)
+		}
+		p.unplace(s.target, matchID, s.entrant, s.loser)
+	}
+}
+
+// unplace takes an entrant back out of a match and reopens the slot it came through.
+func (p *repairPlan) unplace(m *matchResult, source int, e entrant, loser bool) {
+	i := entrantIndex(m, e)
+	m.Entrants = append(m.Entrants[:i:i], m.Entrants[i+1:]...)
+	m.IsWinner = append(m.IsWinner[:i:i], m.IsWinner[i+1:]...)
+	m.Scores = append(m.Scores[:i:i], m.Scores[i+1:]...)
+	outcome := slotWinner
+	if loser {
+		outcome = slotLoser
+	}
+	matchID := m.MatchID
+	p.ops = append(p.ops, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+            DELETE FROM match_participants
+            WHERE match_id = $1 AND user_id IS NOT DISTINCT FROM $2 AND team_id IS NOT DISTINCT FROM $3
+        `, matchID, e.UserID, e.TeamID); err != nil {
+			return fmt.Errorf("failed to remove entrant: %w", err)
+		}
+		if _, err := tx.Exec(`
+            INSERT INTO match_slots (match_id, source_match_id, source_outcome) VALUES ($1, $2, $3)
+            ON CONFLICT (match_id, source_match_id, source_outcome) DO UPDATE SET filled = false
+        `, matchID, source, outcome); err != nil {
+			return fmt.Errorf("failed to reopen match slot: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// openMatch is a match between the given users that has not been played yet.
+func openMatch(id int, userIDs ...int) matchResult {
+	m := matchResult{MatchID: id}
+	for _, e := range userEntrants(userIDs...) {
+		m.Entrants = append(m.Entrants, e)
+		m.IsWinner = append(m.IsWinner, false)
+		m.Scores = append(m.Scores, nil)
+	}
+	return m
+}
+
+func userOf(id int) entrant {
+	return entrant{UserID: &id}
+}
+
+func entrantIDs(m *matchResult) []int {
+	ids := []int{}
+	for _, e := range m.Entrants {
+		ids = append(ids, *e.UserID)
+	}
+	return ids
+}
+
+func TestRepairPlan_SwapsIntoUnplayedMatch(t *testing.T) {
+	plan := newRepairPlan([]matchResult{
+		completedMatch(1, 1, 2, 1, 2, 0),
+		completedMatch(2, 3, 4, 3, 2, 1),
+		openMatch(3, 1, 3),
+	})
+	plan.swap(1, userOf(1), userOf(2))
+
+	if len(plan.played) != 0 || len(plan.voided) != 0 {
+		t.Errorf("expected nothing played to change, got played %v voided %v", plan.played, plan.voided)
+	}
+	if !reflect.DeepEqual(plan.swapped, []int{3}) {
+		t.Errorf("expected match 3 to be swapped, got %v", plan.swapped)
+	}
+	if got := entrantIDs(plan.matches[2]); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("expected user 2 to take the final place, got %v", got)
+	}
+	if len(plan.ops) != 1 {
+		t.Errorf("expected a single write, got %d", len(plan.ops))
+	}
+}
+
+func TestRepairPlan_VoidsPlayedMatchAndReopensItsSlot(t *testing.T) {
+	plan := newRepairPlan([]matchResult{
+		completedMatch(1, 1, 2, 1, 2, 0),
+		completedMatch(2, 3, 4, 3, 2, 0),
+		completedMatch(3, 5, 6, 5, 2, 0),
+		completedMatch(4, 7, 8, 7, 2, 0),
+		completedMatch(5, 1, 3, 1, 2, 1),
+		openMatch(6, 5, 7),
+		openMatch(7, 1),
+	})
+	plan.swap(1, userOf(1), userOf(2))
+
+	if !reflect.DeepEqual(plan.played, []int{5}) || !reflect.DeepEqual(plan.voided, []int{5}) {
+		t.Errorf("expected match 5 to be voided, got played %v voided %v", plan.played, plan.voided)
+	}
+	semi, final := plan.matches[4], plan.matches[6]
+	if semi.Completed || !reflect.DeepEqual(entrantIDs(semi), []int{2, 3}) {
+		t.Errorf("expected an open semifinal between 2 and 3, got %+v", semi)
+	}
+	if len(final.Entrants) != 0 {
+		t.Errorf("expected user 1 to leave the final, got %v", entrantIDs(final))
+	}
+}
+
+func TestRepairPlan_RemovesGrandFinalReset(t *testing.T) {
+	// user 2 came from the losers bracket and won the first grand final, forcing a reset
+	plan := newRepairPlan([]matchResult{
+		completedMatch(6, 1, 2, 2, 1, 2),
+		openMatch(7, 1, 2),
+	})
+	plan.swap(6, userOf(2), userOf(1))
+
+	if !reflect.DeepEqual(plan.removed, []int{7}) {
+		t.Errorf("expected the reset to be removed, got %v", plan.removed)
+	}
+	if len(plan.swapped) != 0 || len(plan.played) != 0 {
+		t.Errorf("expected no other changes, got swapped %v played %v", plan.swapped, plan.played)
+	}
+}
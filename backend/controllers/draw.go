@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+const (
+	DrawSeeded = "seeded"
+	DrawRandom = "random"
+)
+
+// newDrawSeed picks the RNG seed for a random draw. Overridden in tests.
+var newDrawSeed = rand.Int63
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadStageEntrants returns the stage's entrants with seeded entrants first (by seed) and the
+// rest in a stable id order, so a random draw over them can be reproduced later.
+func loadStageEntrants(q queryer, stageID int) ([]entrant, error) {
+	rows, err := q.Query(
+		`SELECT user_id, team_id, seed FROM stage_participants WHERE stage_id=$1 ORDER BY seed NULLS LAST, user_id NULLS LAST, team_id NULLS LAST`,
+		stageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entrants []entrant
+	for rows.Next() {
+		var e entrant
+		if err := rows.Scan(&e.UserID, &e.TeamID, &e.Seed); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		entrants = append(entrants, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return entrants, nil
+}
+
+// stageDraw is a random draw: the RNG seed and the entrants it was applied to, in seed order.
+// Both are kept on the rounds it produced, so the draw can be audited after seeds change.
+type stageDraw struct {
+	Seed     int64
+	Entrants []entrant
+}
+
+// drawnEntrant is an entrant of a stored draw snapshot.
+type drawnEntrant struct {
+	UserID *int `json:"user_id,omitempty"`
+	TeamID *int `json:"team_id,omitempty"`
+	Seed   *int `json:"seed,omitempty"`
+}
+
+// loadDrawnEntrants loads the stage's entrants in draw order, leaving out entrants disqualified
+// before the stage started. For stages in random draw mode the unseeded entrants are shuffled and
+// the draw is returned so it can be stored on the round; seeded stages return a nil draw.
+func loadDrawnEntrants(q queryer, stageID int) ([]entrant, *stageDraw, error) {
+	mode, err := stageDrawMode(q, stageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	entrants, err := loadStageEntrants(q, stageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entrants, err = withoutDisqualified(q, stageID, entrants); err != nil {
+		return nil, nil, err
+	}
+	drawn, draw := drawEntrants(mode, entrants)
+	return drawn, draw, nil
+}
+
+// stageDrawMode returns how the first round of a stage is drawn.
+func stageDrawMode(q queryer, stageID int) (string, error) {
+	var mode string
+	if err := q.QueryRow(
+		`SELECT COALESCE(draw_mode, 'seeded') FROM competition_stages WHERE stage_id=$1`,
+		stageID,
+	).Scan(&mode); err != nil {
+		return "", fmt.Errorf("failed to get draw mode: %w", err)
+	}
+	return mode, nil
+}
+
+// drawEntrants puts entrants, in seed order, in draw order for the given draw mode.
+func drawEntrants(mode string, entrants []entrant) ([]entrant, *stageDraw) {
+	if mode != DrawRandom {
+		return entrants, nil
+	}
+	draw := &stageDraw{Seed: newDrawSeed(), Entrants: entrants}
+	return drawOrder(entrants, draw.Seed), draw
+}
+
+// drawOrder keeps seeded entrants in seed order at the top and shuffles the unseeded ones
+// with a RNG built from rngSeed. The same input and seed always give the same order.
+func drawOrder(entrants []entrant, rngSeed int64) []entrant {
+	ordered := make([]entrant, len(entrants))
+	copy(ordered, entrants)
+	firstUnseeded := len(ordered)
+	for i, e := range ordered {
+		if e.Seed == nil {
+			firstUnseeded = i
+			break
+		}
+	}
+	unseeded := ordered[firstUnseeded:]
+	rng := rand.New(rand.NewSource(rngSeed))
+	rng.Shuffle(len(unseeded), func(i, j int) {
+		unseeded[i], unseeded[j] = unseeded[j], unseeded[i]
+	})
+	return ordered
+}
+
+// recordDraw stores a random draw on a round it produced: the RNG seed and the entrants it
+// shuffled.
+func recordDraw(tx *sql.Tx, roundID int, draw *stageDraw) error {
+	if draw == nil {
+		return nil
+	}
+	snapshot := make([]drawnEntrant, len(draw.Entrants))
+	for i, e := range draw.Entrants {
+		snapshot[i] = drawnEntrant{UserID: e.UserID, TeamID: e.TeamID, Seed: e.Seed}
+	}
+	entrants, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode draw entrants: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE rounds SET rng_seed = $1, draw_entrants = $2 WHERE round_id = $3`, draw.Seed, string(entrants), roundID); err != nil {
+		return fmt.Errorf("failed to record draw: %w", err)
+	}
+	return nil
+}
+
+// AuditDraw re-derives the pairings of a randomly drawn round from its stored RNG seed and the
+// entrants the draw was applied to, and compares them with the matches that were actually
+// created. Seeds changed after the draw do not affect the audit. Both legs of a two-legged tie
+// are drawn; a decider added later is not.
+func AuditDraw(db *sql.DB, roundID int) (*models.DrawAudit, error) {
+	audit := models.DrawAudit{RoundID: roundID}
+	var rngSeed sql.NullInt64
+	var snapshot sql.NullString
+	var formatID, numGroups, legs, heatSize, advance int
+	if err := db.QueryRow(`
+        SELECT r.stage_id, r.round_number, r.rng_seed, r.draw_entrants, cs.tourney_format_id, COALESCE(cs.num_groups, 1), COALESCE(cs.legs, 1),
+            COALESCE(cs.heat_size, 0), COALESCE(cs.advance_per_heat, 0)
+        FROM rounds r
+        JOIN competition_stages cs ON cs.stage_id = r.stage_id
+        WHERE r.round_id = $1
+    `, roundID).Scan(&audit.StageID, &audit.RoundNumber, &rngSeed, &snapshot, &formatID, &numGroups, &legs, &heatSize, &advance); err != nil {
+		return nil, fmt.Errorf("round not found: %w", err)
+	}
+	if !rngSeed.Valid {
+		return nil, fmt.Errorf("round %d was not randomly drawn", roundID)
+	}
+	if !snapshot.Valid {
+		return nil, fmt.Errorf("round %d was drawn before draw entrants were recorded and cannot be audited", roundID)
+	}
+	audit.RNGSeed = rngSeed.Int64
+
+	var drawn []drawnEntrant
+	if err := json.Unmarshal([]byte(snapshot.String), &drawn); err != nil {
+		return nil, fmt.Errorf("failed to decode draw entrants: %w", err)
+	}
+	entrants := make([]entrant, len(drawn))
+	for i, e := range drawn {
+		entrants[i] = entrant{UserID: e.UserID, TeamID: e.TeamID, Seed: e.Seed}
+	}
+	order := drawOrder(entrants, audit.RNGSeed)
+	for _, e := range order {
+		audit.DrawOrder = append(audit.DrawOrder, entrantModel(e))
+	}
+
+	// The drawn round is whatever the engine plans from the draw order before any result exists.
+	var rounds []engine.Round
+	var err error
+	switch formatID {
+	case models.DoubleElimination:
+		rounds, err = engine.DoubleElimNextRound(order, nil)
+	case models.SingleElimination:
+		rounds, err = engine.SingleElimNextRound(order, nil, false)
+	case models.RoundRobin:
+		_, rounds, err = engine.RoundRobin(order, numGroups, legs)
+	case models.Swiss:
+		var round engine.Round
+		round, err = engine.SwissNextRound(order, nil, pointsSystem{}, 1)
+		rounds = []engine.Round{round}
+	case models.Heats:
+		var round engine.Round
+		round, err = engine.HeatsNextRound(order, nil, heatSize, advance)
+		rounds = []engine.Round{round}
+	default:
+		return nil, fmt.Errorf("draw audit is not supported for format %d", formatID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if legs == 2 && formatID != models.RoundRobin {
+		rounds = engine.TwoLegged(rounds)
+	}
+	if formatID == models.RoundRobin {
+		if audit.RoundNumber < 1 || audit.RoundNumber > len(rounds) {
+			return nil, fmt.Errorf("round %d is outside the round robin schedule", audit.RoundNumber)
+		}
+		rounds = rounds[audit.RoundNumber-1:]
+	}
+	for _, m := range rounds[0].Matches {
+		derived := make([]models.Entrant, 0, len(m.Entrants))
+		for _, e := range m.Entrants {
+			derived = append(derived, entrantModel(e))
+		}
+		audit.Derived = append(audit.Derived, derived)
+	}
+
+	rows, err := db.Query(`
+        SELECT mp.match_id, mp.user_id, mp.team_id
+        FROM match_participants mp
+        JOIN matches m ON mp.match_id = m.match_id
+        WHERE m.round_id = $1 AND m.leg IS DISTINCT FROM $2
+        ORDER BY mp.match_id
+    `, roundID, engine.Decider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load round matches: %w", err)
+	}
+	defer rows.Close()
+	lastMatch := -1
+	for rows.Next() {
+		var matchID int
+		var e entrant
+		if err := rows.Scan(&matchID, &e.UserID, &e.TeamID); err != nil {
+			return nil, fmt.Errorf("failed to scan match participant: %w", err)
+		}
+		if matchID != lastMatch {
+			audit.Actual = append(audit.Actual, nil)
+			lastMatch = matchID
+		}
+		audit.Actual[len(audit.Actual)-1] = append(audit.Actual[len(audit.Actual)-1], entrantModel(e))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+
+	audit.Verified = sameMatches(audit.Derived, audit.Actual)
+	return &audit, nil
+}
+
+func entrantModel(e entrant) models.Entrant {
+	return models.Entrant{UserID: e.UserID, TeamID: e.TeamID}
+}
+
+// sameMatches compares two match lists ignoring match order and side order.
+func sameMatches(a, b [][]models.Entrant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	keys := func(list [][]models.Entrant) []string {
+		out := make([]string, 0, len(list))
+		for _, m := range list {
+			parts := make([]string, 0, len(m))
+			for _, e := range m {
+				parts = append(parts, entrant{UserID: e.UserID, TeamID: e.TeamID}.Key())
+			}
+			sort.Strings(parts)
+			out = append(out, strings.Join(parts, "-"))
+		}
+		sort.Strings(out)
+		return out
+	}
+	ka, kb := keys(a), keys(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
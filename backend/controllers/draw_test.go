@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+func TestDrawOrder_Reproducible(t *testing.T) {
+	entrants := userEntrants(1, 2, 3, 4, 5, 6, 7, 8)
+	a := drawOrder(entrants, 42)
+	b := drawOrder(entrants, 42)
+	for i := range a {
+		if a[i].Key() != b[i].Key() {
+			t.Fatalf("draws with the same seed differ: %v vs %v", a, b)
+		}
+	}
+	if entrants[0].Key() != "u1" {
+		t.Errorf("drawOrder must not modify its input")
+	}
+}
+
+func TestDrawOrder_KeepsSeededOnTop(t *testing.T) {
+	entrants := userEntrants(1, 2, 3, 4, 5, 6)
+	one, two := 1, 2
+	entrants[0].Seed = &one
+	entrants[1].Seed = &two
+	for seed := int64(0); seed < 20; seed++ {
+		order := drawOrder(entrants, seed)
+		if order[0].Key() != "u1" || order[1].Key() != "u2" {
+			t.Fatalf("seeded entrants moved with rng seed %d: %v", seed, order)
+		}
+	}
+}
+
+func TestGenerateRoundSingleElim_RandomDrawRecordsSeed(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	orig := newDrawSeed
+	newDrawSeed = func() int64 { return 7 }
+	defer func() { newDrawSeed = orig }()
+
+	stageID := 1
+	expectSingleElimState(mock, stageID, resultRows(), false, false)
+	expectStageEntrants(mock, stageID, "random", 1, 2)
+	expectDisqualified(mock, stageID)
+
+	order := drawOrder(userEntrants(1, 2), 7)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectExec(`UPDATE rounds SET rng_seed = \$1, draw_entrants = \$2 WHERE round_id = \$3`).
+		WithArgs(int64(7), `[{"user_id":1},{"user_id":2}]`, 10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(100, *order[0].UserID, nil, nil, *order[1].UserID, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	expectDisqualifiedMatches(mock, stageID)
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSingleElim(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// expectAuditRound mocks the round an audit starts from: its stage, draw and stage settings,
+// with heats of 3 of which 1 advances.
+func expectAuditRound(mock sqlmock.Sqlmock, roundID, stageID, formatID int, rngSeed, snapshot interface{}, legs int) {
+	mock.ExpectQuery(`SELECT r.stage_id, r.round_number, r.rng_seed, r.draw_entrants, cs.tourney_format_id`).
+		WithArgs(roundID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_number", "rng_seed", "draw_entrants", "tourney_format_id", "num_groups", "legs", "heat_size", "advance_per_heat"}).
+			AddRow(stageID, 1, rngSeed, snapshot, formatID, 1, legs, 3, 1))
+}
+
+// expectRoundMatches mocks the matches of a round as they were created from rounds[0].
+func expectRoundMatches(mock sqlmock.Sqlmock, roundID int, rounds []engine.Round) {
+	rows := sqlmock.NewRows([]string{"match_id", "user_id", "team_id"})
+	for i, m := range rounds[0].Matches {
+		for _, e := range m.Entrants {
+			rows.AddRow(100+i, *e.UserID, nil)
+		}
+	}
+	mock.ExpectQuery(`SELECT mp.match_id, mp.user_id, mp.team_id`).
+		WithArgs(roundID, engine.Decider).
+		WillReturnRows(rows)
+}
+
+func TestAuditDraw_Verified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// the audit replays the recorded entrants, not the stage's current seeds
+	roundID, stageID := 10, 1
+	expectAuditRound(mock, roundID, stageID, models.SingleElimination, 99, `[{"user_id":1},{"user_id":2},{"user_id":3},{"user_id":4}]`, 1)
+	rounds, err := engine.SingleElimNextRound(drawOrder(userEntrants(1, 2, 3, 4), 99), nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectRoundMatches(mock, roundID, rounds)
+
+	audit, err := AuditDraw(db, roundID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !audit.Verified {
+		t.Errorf("expected draw to verify, got %+v", audit)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestAuditDraw_TwoLeggedTies(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	roundID, stageID := 10, 1
+	expectAuditRound(mock, roundID, stageID, models.SingleElimination, 99, `[{"user_id":1},{"user_id":2},{"user_id":3},{"user_id":4}]`, 2)
+	rounds, err := engine.SingleElimNextRound(drawOrder(userEntrants(1, 2, 3, 4), 99), nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectRoundMatches(mock, roundID, engine.TwoLegged(rounds))
+
+	audit, err := AuditDraw(db, roundID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !audit.Verified || len(audit.Derived) != 4 {
+		t.Errorf("expected both legs of 2 ties to verify, got %+v", audit)
+	}
+}
+
+func TestAuditDraw_Heats(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	roundID, stageID := 10, 1
+	expectAuditRound(mock, roundID, stageID, models.Heats, 99, `[{"user_id":1},{"user_id":2},{"user_id":3},{"user_id":4},{"user_id":5},{"user_id":6}]`, 1)
+	round, err := engine.HeatsNextRound(drawOrder(userEntrants(1, 2, 3, 4, 5, 6), 99), nil, 3, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectRoundMatches(mock, roundID, []engine.Round{round})
+
+	audit, err := AuditDraw(db, roundID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !audit.Verified || len(audit.Derived) != 2 {
+		t.Errorf("expected 2 heats to verify, got %+v", audit)
+	}
+}
+
+func TestAuditDraw_SeededEntrantsStayOnTop(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	roundID, stageID := 10, 1
+	expectAuditRound(mock, roundID, stageID, models.SingleElimination, 5, `[{"user_id":3,"seed":1},{"user_id":1},{"user_id":2},{"user_id":4}]`, 1)
+	recorded := userEntrants(3, 1, 2, 4)
+	one := 1
+	recorded[0].Seed = &one
+	rounds, err := engine.SingleElimNextRound(drawOrder(recorded, 5), nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectRoundMatches(mock, roundID, rounds)
+
+	audit, err := AuditDraw(db, roundID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !audit.Verified || *audit.DrawOrder[0].UserID != 3 {
+		t.Errorf("expected the recorded top seed first and the draw to verify, got %+v", audit)
+	}
+}
+
+func TestAuditDraw_NotRandom(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectAuditRound(mock, 10, 1, models.SingleElimination, nil, nil, 1)
+	if _, err := AuditDraw(db, 10); err == nil {
+		t.Error("expected error for a round without rng seed")
+	}
+}
+
+func TestAuditDraw_WithoutSnapshot(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectAuditRound(mock, 10, 1, models.SingleElimination, 99, nil, 1)
+	if _, err := AuditDraw(db, 10); err == nil || !strings.Contains(err.Error(), "cannot be audited") {
+		t.Errorf("expected error for a round drawn without recorded entrants, got: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// Format is a tournament format a stage can be played in. Formats register under their
+// tourney_format_id; round generation, completion, ranking and stage validation all go through
+// the format of the stage.
+type Format interface {
+	// GenerateNextRound creates the stage's next round from the results so far.
+	GenerateNextRound(db *sql.DB, stageID int) error
+	// Finished reports whether the stage has been played to the end.
+	Finished(db *sql.DB, stageID int) (bool, error)
+	// Rank returns the stage's entrants in final order, best first; group stages list their
+	// places across groups (1A, 1B, ..., 2A, 2B, ...). It returns ErrStageNotFinished while the
+	// stage is still being played.
+	Rank(db *sql.DB, stageID int) ([]entrant, error)
+	// ValidateEntrants checks that a stage of this format can be played with its entrant counts.
+	ValidateEntrants(stage models.StageDTO) error
+}
+
+// ErrUnsupportedFormat is returned for a tourney_format_id without a registered format.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+var formats = map[int]Format{}
+
+// RegisterFormat makes a format available to stages with the given tourney_format_id.
+func RegisterFormat(formatID int, f Format) {
+	formats[formatID] = f
+}
+
+// LookupFormat returns the format registered for a tourney_format_id.
+func LookupFormat(formatID int) (Format, error) {
+	f, ok := formats[formatID]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+	return f, nil
+}
+
+// StageFormat returns the format a stage is played in.
+func StageFormat(db *sql.DB, stageID int) (Format, error) {
+	var formatID int
+	if err := db.QueryRow(`SELECT tourney_format_id FROM competition_stages WHERE stage_id=$1`, stageID).Scan(&formatID); err != nil {
+		return nil, fmt.Errorf("failed to get stage format: %w", err)
+	}
+	return LookupFormat(formatID)
+}
+
+// StageRanking returns the entrants of a finished stage in the order its format ranks them, the
+// winner first, passing over entrants disqualified from the competition.
+func StageRanking(db *sql.DB, stageID int) ([]entrant, error) {
+	format, err := StageFormat(db, stageID)
+	if err != nil {
+		return nil, err
+	}
+	ranked, err := format.Rank(db, stageID)
+	if err != nil {
+		return nil, err
+	}
+	if ranked, err = withoutDisqualified(db, stageID, ranked); err != nil {
+		return nil, err
+	}
+	if len(ranked) == 0 {
+		return nil, ErrStageNotFinished
+	}
+	return ranked, nil
+}
+
+// ThirdPlaceWinner returns the winner of a stage's third place match, decided on aggregate when
+// it is played over two legs. Both ids are nil when the stage has no third place match or it has
+// not been won yet.
+func ThirdPlaceWinner(db *sql.DB, stageID int) (userID, teamID *int, err error) {
+	results, err := loadKnockoutResults(db, stageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range results {
+		if m.Bracket != engine.ThirdPlace || !m.Completed {
+			continue
+		}
+		for i, e := range m.Entrants {
+			if m.IsWinner[i] {
+				return e.UserID, e.TeamID, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func init() {
+	RegisterFormat(models.SingleElimination, singleElimination{})
+	RegisterFormat(models.DoubleElimination, doubleElimination{})
+	RegisterFormat(models.RoundRobin, roundRobin{})
+	RegisterFormat(models.Swiss, swiss{})
+	RegisterFormat(models.Heats, heats{})
+	RegisterFormat(models.Ladder, ladder{})
+}
+
+// rankedToFinished turns a ranking attempt into a completion check.
+func rankedToFinished(err error) (bool, error) {
+	if errors.Is(err, ErrStageNotFinished) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// rejectGroups is the group check of every format that plays as a single pool.
+func rejectGroups(stage models.StageDTO) error {
+	if stage.NumGroups > 1 {
+		return errors.New("only Round Robin stages can be split into groups")
+	}
+	return nil
+}
+
+type singleElimination struct{}
+
+func (singleElimination) GenerateNextRound(db *sql.DB, stageID int) error {
+	return GenerateRoundSingleElim(db, stageID)
+}
+
+func (f singleElimination) Finished(db *sql.DB, stageID int) (bool, error) {
+	_, err := f.Rank(db, stageID)
+	return rankedToFinished(err)
+}
+
+func (singleElimination) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	return rankElimination(db, stageID, models.SingleElimination)
+}
+
+// ValidateEntrants accepts any count: byes fill the bracket up to the next power of two.
+func (singleElimination) ValidateEntrants(stage models.StageDTO) error {
+	return rejectGroups(stage)
+}
+
+type doubleElimination struct{}
+
+func (doubleElimination) GenerateNextRound(db *sql.DB, stageID int) error {
+	return GenerateRoundDoubleElim(db, stageID)
+}
+
+func (f doubleElimination) Finished(db *sql.DB, stageID int) (bool, error) {
+	_, err := f.Rank(db, stageID)
+	return rankedToFinished(err)
+}
+
+func (doubleElimination) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	return rankElimination(db, stageID, models.DoubleElimination)
+}
+
+// ValidateEntrants requires a power of two: neither bracket has byes, so every winners round
+// must halve evenly down to the winners final.
+func (doubleElimination) ValidateEntrants(stage models.StageDTO) error {
+	if stage.ParticipantsAtStart < 2 || stage.ParticipantsAtStart != engine.NextPowerOfTwo(stage.ParticipantsAtStart) {
+		return errors.New("a Double Elimination stage needs a power of two participants at start")
+	}
+	return rejectGroups(stage)
+}
+
+type roundRobin struct{}
+
+// GenerateNextRound creates the whole schedule at once, so it only runs on a stage without rounds.
+func (roundRobin) GenerateNextRound(db *sql.DB, stageID int) error {
+	return GenerateRoundRobin(db, stageID)
+}
+
+// Finished reports whether the schedule exists and every match of it has been played.
+func (roundRobin) Finished(db *sql.DB, stageID int) (bool, error) {
+	total, open, err := stageMatchCounts(db, stageID)
+	return total > 0 && open == 0, err
+}
+
+func (roundRobin) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	var numGroups int
+	if err := db.QueryRow(`SELECT COALESCE(num_groups, 1) FROM competition_stages WHERE stage_id = $1`, stageID).Scan(&numGroups); err != nil {
+		return nil, fmt.Errorf("failed to get number of groups: %w", err)
+	}
+	return rankTable(db, stageID, numGroups)
+}
+
+// ValidateEntrants checks that every group can play and advance the same number of entrants.
+func (roundRobin) ValidateEntrants(stage models.StageDTO) error {
+	if stage.NumGroups <= 1 {
+		return nil
+	}
+	if stage.ParticipantsAtStart < stage.NumGroups*2 {
+		return errors.New("each group needs at least 2 participants")
+	}
+	if stage.ParticipantsAtEnd%stage.NumGroups != 0 {
+		return errors.New("participants at end must be divisible by the number of groups")
+	}
+	return nil
+}
+
+type swiss struct{}
+
+func (swiss) GenerateNextRound(db *sql.DB, stageID int) error {
+	return GenerateRoundSwiss(db, stageID)
+}
+
+// Finished reports whether every configured round has been generated and played.
+func (swiss) Finished(db *sql.DB, stageID int) (bool, error) {
+	if err := checkSwissFinished(db, stageID); err != nil {
+		return rankedToFinished(err)
+	}
+	total, open, err := stageMatchCounts(db, stageID)
+	return total > 0 && open == 0, err
+}
+
+func (swiss) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	if err := checkSwissFinished(db, stageID); err != nil {
+		return nil, err
+	}
+	return rankTable(db, stageID, 1)
+}
+
+// ValidateEntrants checks that the round count still allows pairings without rematches.
+func (swiss) ValidateEntrants(stage models.StageDTO) error {
+	if stage.SwissRounds == nil || *stage.SwissRounds < 1 {
+		return errors.New("swiss stages require at least one round")
+	}
+	if *stage.SwissRounds >= stage.ParticipantsAtStart {
+		return errors.New("swiss rounds must be fewer than participants at start")
+	}
+	return rejectGroups(stage)
+}
+
+type heats struct{}
+
+func (heats) GenerateNextRound(db *sql.DB, stageID int) error {
+	return GenerateRoundHeats(db, stageID)
+}
+
+func (f heats) Finished(db *sql.DB, stageID int) (bool, error) {
+	_, err := f.Rank(db, stageID)
+	return rankedToFinished(err)
+}
+
+func (heats) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	return rankHeats(db, stageID)
+}
+
+// ValidateEntrants checks that the heats narrow the entrants down to a single final heat.
+func (heats) ValidateEntrants(stage models.StageDTO) error {
+	if stage.HeatSize == nil || stage.AdvancePerHeat == nil {
+		return errors.New("heats stages require a heat size and the number advancing from each heat")
+	}
+	if _, err := engine.HeatRounds(stage.ParticipantsAtStart, *stage.HeatSize, *stage.AdvancePerHeat); err != nil {
+		return err
+	}
+	return rejectGroups(stage)
+}
+
+type ladder struct{}
+
+// GenerateNextRound opens the ladder; after that matches are only made by challenges.
+func (ladder) GenerateNextRound(db *sql.DB, stageID int) error {
+	return OpenLadder(db, stageID)
+}
+
+// Finished reports whether the ladder is open with no challenge left to play, so it can be
+// closed in its current order.
+func (f ladder) Finished(db *sql.DB, stageID int) (bool, error) {
+	_, err := f.Rank(db, stageID)
+	return rankedToFinished(err)
+}
+
+func (ladder) Rank(db *sql.DB, stageID int) ([]entrant, error) {
+	return rankLadder(db, stageID)
+}
+
+// ValidateEntrants checks the challenge range and cooldown.
+func (ladder) ValidateEntrants(stage models.StageDTO) error {
+	if stage.ChallengeRange != nil && *stage.ChallengeRange < 1 {
+		return errors.New("the challenge range must be at least 1 position")
+	}
+	if stage.ChallengeCooldownHours != nil && *stage.ChallengeCooldownHours < 0 {
+		return errors.New("the challenge cooldown cannot be negative")
+	}
+	return rejectGroups(stage)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+func TestLookupFormat_Unknown(t *testing.T) {
+	if _, err := LookupFormat(99); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+	for _, id := range []int{models.SingleElimination, models.DoubleElimination, models.RoundRobin, models.Swiss} {
+		if _, err := LookupFormat(id); err != nil {
+			t.Errorf("format %d: unexpected error %v", id, err)
+		}
+	}
+}
+
+func TestRoundRobinFinished(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	cases := []struct {
+		total, open int
+		want        bool
+	}{
+		{0, 0, false}, // schedule not generated yet
+		{6, 1, false},
+		{6, 0, true},
+	}
+	for _, c := range cases {
+		mock.ExpectQuery(`SELECT COUNT\(\*\), COUNT\(\*\) FILTER`).
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "open"}).AddRow(c.total, c.open))
+		got, err := roundRobin{}.Finished(db, 4)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("total %d, open %d: expected finished %v, got %v", c.total, c.open, c.want, got)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDoubleEliminationValidateEntrants(t *testing.T) {
+	for _, n := range []int{2, 4, 8, 16, 32} {
+		if err := (doubleElimination{}).ValidateEntrants(models.StageDTO{ParticipantsAtStart: n, ParticipantsAtEnd: 1}); err != nil {
+			t.Errorf("%d participants: unexpected error: %v", n, err)
+		}
+	}
+	for _, n := range []int{3, 6, 7, 10, 12} {
+		if err := (doubleElimination{}).ValidateEntrants(models.StageDTO{ParticipantsAtStart: n, ParticipantsAtEnd: 1}); err == nil {
+			t.Errorf("%d participants: expected a power of two error", n)
+		}
+	}
+	if err := (singleElimination{}).ValidateEntrants(models.StageDTO{ParticipantsAtStart: 7, ParticipantsAtEnd: 1}); err != nil {
+		t.Errorf("single elimination should accept byes, got %v", err)
+	}
+}
+
+func TestStageRanking_PassesOverDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT tourney_format_id FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.Ladder))
+	mock.ExpectQuery(`SELECT sp.user_id, sp.team_id, sp.ladder_position`).
+		WithArgs(4, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "ladder_position", "disqualified", "busy", "cooling_down"}).
+			AddRow(1, nil, 1, true, false, false).
+			AddRow(2, nil, 2, false, false, false))
+	expectDisqualified(mock, 4, 1)
+
+	ranked, err := StageRanking(db, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ranked) != 1 || *ranked[0].UserID != 2 {
+		t.Errorf("expected only user 2 to be ranked, got %+v", ranked)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// FormatRanksByPlacement reports whether matches of a format are decided by finishing place
+// rather than by a winner: heats race all their entrants at once.
+func FormatRanksByPlacement(formatID int) bool {
+	return formatID == models.Heats
+}
+
+// GenerateRoundHeats inserts the next round of a heats stage: the drawn entrants spread over heats
+// of the stage's heat_size for the first round, the best advance_per_heat of every heat for each
+// round after that, down to a single final heat. Entrants disqualified from the competition are
+// left out of every round.
+func GenerateRoundHeats(db *sql.DB, stageID int) error {
+	var size, advance sql.NullInt64
+	if err := db.QueryRow(
+		`SELECT heat_size, advance_per_heat FROM competition_stages WHERE stage_id=$1`,
+		stageID,
+	).Scan(&size, &advance); err != nil {
+		return fmt.Errorf("failed to get heat settings: %w", err)
+	}
+	if !size.Valid || !advance.Valid {
+		return fmt.Errorf("heats stage has no heat size or qualifiers per heat configured")
+	}
+
+	results, err := loadStageResults(db, stageID)
+	if err != nil {
+		return err
+	}
+	var entrants []entrant
+	var draw *stageDraw
+	if len(results) == 0 {
+		entrants, draw, err = loadDrawnEntrants(db, stageID)
+	} else if entrants, err = loadStageEntrants(db, stageID); err == nil {
+		// disqualified entrants give their place in the next round to the next finisher
+		entrants, err = withoutDisqualified(db, stageID, entrants)
+	}
+	if err != nil {
+		return err
+	}
+
+	round, err := engine.HeatsNextRound(entrants, results, int(size.Int64), int(advance.Int64))
+	if err != nil {
+		return err
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		return insertRounds(tx, stageID, []engine.Round{round}, draw)
+	})
+}
+
+// rankHeats ranks a finished heats stage: the final in finishing order, then the entrants knocked
+// out in each earlier round, latest round first, ranked across that round's heats.
+func rankHeats(q queryer, stageID int) ([]entrant, error) {
+	results, err := loadStageResults(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+	byRound := make(map[int][]matchResult)
+	last := 0
+	for _, m := range results {
+		if !m.Completed {
+			return nil, ErrStageNotFinished
+		}
+		byRound[m.Round] = append(byRound[m.Round], m)
+		last = max(last, m.Round)
+	}
+	if last == 0 || len(byRound[last]) != 1 {
+		return nil, ErrStageNotFinished
+	}
+
+	var ranked []entrant
+	listed := make(map[string]bool)
+	for round := last; round >= 1; round-- {
+		for _, e := range engine.RankHeats(byRound[round]) {
+			if !listed[e.Key()] {
+				listed[e.Key()] = true
+				ranked = append(ranked, e)
+			}
+		}
+	}
+	return ranked, nil
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectHeatSettings(mock sqlmock.Sqlmock, stageID, size, advance int) {
+	mock.ExpectQuery(`SELECT heat_size, advance_per_heat FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"heat_size", "advance_per_heat"}).AddRow(size, advance))
+}
+
+func TestGenerateRoundHeats_FirstRoundRacesEveryoneInOneHeat(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	expectHeatSettings(mock, stageID, 4, 2)
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants .+ VALUES \(\$1, \$2, \$3, false, NULL, \$4\), \(\$1, \$5, \$6, false, NULL, \$7\), \(\$1, \$8, \$9, false, NULL, \$10\)`).
+		WithArgs(100, 1, nil, nil, 2, nil, nil, 3, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectCommit()
+
+	if err := GenerateRoundHeats(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundHeats_FirstRoundLeavesOutDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	expectHeatSettings(mock, stageID, 4, 2)
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID, 2)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants .+ VALUES \(\$1, \$2, \$3, false, NULL, \$4\), \(\$1, \$5, \$6, false, NULL, \$7\)$`).
+		WithArgs(100, 1, nil, nil, 3, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	if err := GenerateRoundHeats(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRankHeats_FinalThenEarlierRounds(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	// round 1: heats won by 3 and 4, with 1 and 6 last; final: 4, 2, 3, 5
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows().
+			AddRow(10, "", 1, true, 1, nil, false, nil, "played", 3, nil, 0, 0, nil).
+			AddRow(10, "", 1, true, 2, nil, false, nil, "played", 2, nil, 0, 0, nil).
+			AddRow(10, "", 1, true, 3, nil, true, nil, "played", 1, nil, 0, 0, nil).
+			AddRow(11, "", 1, true, 4, nil, true, nil, "played", 1, nil, 0, 0, nil).
+			AddRow(11, "", 1, true, 5, nil, false, nil, "played", 2, nil, 0, 0, nil).
+			AddRow(11, "", 1, true, 6, nil, false, nil, "played", 3, nil, 0, 0, nil).
+			AddRow(12, "", 2, true, 3, nil, false, nil, "played", 3, nil, 0, 0, nil).
+			AddRow(12, "", 2, true, 4, nil, true, nil, "played", 1, nil, 0, 0, nil).
+			AddRow(12, "", 2, true, 2, nil, false, nil, "played", 2, nil, 0, 0, nil).
+			AddRow(12, "", 2, true, 5, nil, false, nil, "played", 4, nil, 0, 0, nil))
+
+	ranked, err := rankHeats(db, stageID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []int
+	for _, e := range ranked {
+		got = append(got, *e.UserID)
+	}
+	if want := []int{4, 2, 3, 5, 1, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected ranking %v, got %v", want, got)
+	}
+}
+
+func TestRankHeats_NotFinishedBeforeTheFinal(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(1).
+		WillReturnRows(resultRows().
+			AddRow(10, "", 1, true, 1, nil, true, nil, "played", 1, nil, 0, 0, nil).
+			AddRow(10, "", 1, true, 2, nil, false, nil, "played", 2, nil, 0, 0, nil).
+			AddRow(11, "", 1, true, 3, nil, true, nil, "played", 1, nil, 0, 0, nil).
+			AddRow(11, "", 1, true, 4, nil, false, nil, "played", 2, nil, 0, 0, nil))
+
+	if _, err := rankHeats(db, 1); err != ErrStageNotFinished {
+		t.Errorf("expected ErrStageNotFinished, got: %v", err)
+	}
+}
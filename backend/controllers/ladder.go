@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/models"
+)
+
+var (
+	// ErrStageNotFound is returned for a stage id that does not exist.
+	ErrStageNotFound = errors.New("stage not found")
+	// ErrNotLadder is returned when challenging in a stage that is not played as a ladder.
+	ErrNotLadder = errors.New("challenges can only be made in Ladder stages")
+)
+
+// Codes reported with a rejected challenge.
+const (
+	CodeLadderNotOpen    = "ladder_not_open"
+	CodeNotOnLadder      = "not_on_ladder"
+	CodeSelfChallenge    = "self_challenge"
+	CodeOutOfRange       = "out_of_range"
+	CodeChallengePending = "challenge_pending"
+	CodeCooldown         = "cooldown"
+)
+
+// ChallengeError is a challenge that was rejected. Code is one of the challenge codes above and
+// stays stable for clients; Message explains the problem.
+type ChallengeError struct {
+	Code    string
+	Message string
+}
+
+func (e *ChallengeError) Error() string {
+	return e.Message
+}
+
+func challengeError(code, format string, args ...interface{}) error {
+	return &ChallengeError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// rung is an entrant's place on a ladder. Busy reports an unplayed challenge the entrant is in;
+// CoolingDown a ladder match the entrant finished within the stage's cooldown.
+type rung struct {
+	Entrant      entrant
+	Position     int
+	Disqualified bool
+	Busy         bool
+	CoolingDown  bool
+}
+
+// OpenLadder starts a ladder stage: its entrants are put on the ladder in seed order, the top
+// seed in position 1, and the round that holds every challenge match is created. Ladders are not
+// drawn at random: challenges reorder the ladder, so a draw could not be audited later. Ladders have
+// no further rounds to generate.
+func OpenLadder(db *sql.DB, stageID int) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		var opened bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM rounds WHERE stage_id = $1)`, stageID).Scan(&opened); err != nil {
+			return fmt.Errorf("failed to check ladder rounds: %w", err)
+		}
+		if opened {
+			return errors.New("the ladder is already open; its matches are made by challenges")
+		}
+		entrants, err := loadStageEntrants(tx, stageID)
+		if err != nil {
+			return err
+		}
+		if len(entrants) < 2 {
+			return fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+		}
+		if _, err := insertRound(tx, stageID, 1, ""); err != nil {
+			return err
+		}
+		for i, e := range entrants {
+			if _, err := tx.Exec(`
+                UPDATE stage_participants SET ladder_position = $1
+                WHERE stage_id = $2 AND user_id IS NOT DISTINCT FROM $3 AND team_id IS NOT DISTINCT FROM $4
+            `, i+1, stageID, e.UserID, e.TeamID); err != nil {
+				return fmt.Errorf("failed to place entrant on the ladder: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Challenge creates a match between two entrants of a ladder stage, identified by user or team
+// id. The challenger must be below the challenged entrant and at most the stage's
+// challenge_range positions away, not counting disqualified entrants between them. Neither may already be in an unplayed challenge, have played
+// a ladder match within the stage's cooldown, or have been disqualified.
+func Challenge(db *sql.DB, stageID, challengerID, challengedID int) (*models.Challenge, error) {
+	var challenge *models.Challenge
+	err := inTx(db, func(tx *sql.Tx) error {
+		var formatID, challengeRange, cooldownHours int
+		var roundID sql.NullInt64
+		err := tx.QueryRow(`
+            SELECT tourney_format_id, COALESCE(challenge_range, 1), COALESCE(challenge_cooldown_hours, 0),
+                (SELECT round_id FROM rounds WHERE stage_id = $1 ORDER BY round_number LIMIT 1)
+            FROM competition_stages WHERE stage_id = $1
+        `, stageID).Scan(&formatID, &challengeRange, &cooldownHours, &roundID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrStageNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to load ladder settings: %w", err)
+		}
+		if formatID != models.Ladder {
+			return ErrNotLadder
+		}
+		if !roundID.Valid {
+			return challengeError(CodeLadderNotOpen, "the ladder has not been opened yet")
+		}
+
+		// Lock the ladder so that concurrent challenges, and results moving entrants up it, are
+		// checked one after another against the ladder the previous one left.
+		if _, err := tx.Exec(
+			`SELECT 1 FROM stage_participants WHERE stage_id = $1 AND ladder_position IS NOT NULL FOR UPDATE`,
+			stageID,
+		); err != nil {
+			return fmt.Errorf("failed to lock ladder: %w", err)
+		}
+		ladder, err := loadLadder(tx, stageID, cooldownHours)
+		if err != nil {
+			return err
+		}
+		challenger, challenged, err := checkChallenge(ladder, challengerID, challengedID, challengeRange)
+		if err != nil {
+			return err
+		}
+		matchID, err := insertMatch(tx, int(roundID.Int64), []entrant{challenger.Entrant, challenged.Entrant}, nil)
+		if err != nil {
+			return err
+		}
+		challenge = &models.Challenge{
+			MatchID:    matchID,
+			Challenger: models.LadderRung{Position: challenger.Position, UserID: challenger.Entrant.UserID, TeamID: challenger.Entrant.TeamID},
+			Challenged: models.LadderRung{Position: challenged.Position, UserID: challenged.Entrant.UserID, TeamID: challenged.Entrant.TeamID},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// checkChallenge finds both entrants on the ladder and checks that the challenge is allowed.
+func checkChallenge(ladder []rung, challengerID, challengedID, challengeRange int) (*rung, *rung, error) {
+	find := func(id int) *rung {
+		for i := range ladder {
+			e := ladder[i].Entrant
+			if (e.UserID != nil && *e.UserID == id) || (e.TeamID != nil && *e.TeamID == id) {
+				return &ladder[i]
+			}
+		}
+		return nil
+	}
+	if challengerID == challengedID {
+		return nil, nil, challengeError(CodeSelfChallenge, "an entrant cannot challenge itself")
+	}
+	challenger, challenged := find(challengerID), find(challengedID)
+	for _, r := range []struct {
+		id int
+		at *rung
+	}{{challengerID, challenger}, {challengedID, challenged}} {
+		if r.at == nil || r.at.Disqualified {
+			return nil, nil, challengeError(CodeNotOnLadder, "participant %d is not on the ladder", r.id)
+		}
+	}
+	// Disqualified entrants keep their rung but no longer stand in anyone's way, so they are not
+	// counted towards the range.
+	distance := 0
+	for _, r := range ladder {
+		if !r.Disqualified && r.Position >= challenged.Position && r.Position < challenger.Position {
+			distance++
+		}
+	}
+	if challenged.Position >= challenger.Position || distance > challengeRange {
+		return nil, nil, challengeError(CodeOutOfRange, "entrants can only challenge up to %d positions above them", challengeRange)
+	}
+	for _, r := range []*rung{challenger, challenged} {
+		if r.Busy {
+			return nil, nil, challengeError(CodeChallengePending, "the entrant in position %d already has a challenge to play", r.Position)
+		}
+		if r.CoolingDown {
+			return nil, nil, challengeError(CodeCooldown, "the entrant in position %d played a ladder match too recently", r.Position)
+		}
+	}
+	return challenger, challenged, nil
+}
+
+// loadLadder reads the entrants on a ladder, top first, with what keeps them from a challenge.
+func loadLadder(q queryer, stageID, cooldownHours int) ([]rung, error) {
+	rows, err := q.Query(`
+        SELECT sp.user_id, sp.team_id, sp.ladder_position, COALESCE(cp.disqualified_at IS NOT NULL, false),
+            EXISTS (
+                SELECT 1 FROM matches m
+                JOIN rounds r ON r.round_id = m.round_id
+                JOIN match_participants mp ON mp.match_id = m.match_id
+                WHERE r.stage_id = sp.stage_id AND m.completed_at IS NULL
+                  AND mp.user_id IS NOT DISTINCT FROM sp.user_id AND mp.team_id IS NOT DISTINCT FROM sp.team_id
+            ),
+            EXISTS (
+                SELECT 1 FROM matches m
+                JOIN rounds r ON r.round_id = m.round_id
+                JOIN match_participants mp ON mp.match_id = m.match_id
+                WHERE r.stage_id = sp.stage_id AND m.completed_at > NOW() - make_interval(hours => $2)
+                  AND mp.user_id IS NOT DISTINCT FROM sp.user_id AND mp.team_id IS NOT DISTINCT FROM sp.team_id
+            )
+        FROM stage_participants sp
+        JOIN competition_stages cs ON cs.stage_id = sp.stage_id
+        LEFT JOIN competition_participants cp ON cp.competition_id = cs.competition_id
+            AND cp.user_id IS NOT DISTINCT FROM sp.user_id AND cp.team_id IS NOT DISTINCT FROM sp.team_id
+        WHERE sp.stage_id = $1 AND sp.ladder_position IS NOT NULL
+        ORDER BY sp.ladder_position
+    `, stageID, cooldownHours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ladder: %w", err)
+	}
+	defer rows.Close()
+	var ladder []rung
+	for rows.Next() {
+		var r rung
+		if err := rows.Scan(&r.Entrant.UserID, &r.Entrant.TeamID, &r.Position, &r.Disqualified, &r.Busy, &r.CoolingDown); err != nil {
+			return nil, fmt.Errorf("failed to scan ladder entrant: %w", err)
+		}
+		ladder = append(ladder, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return ladder, nil
+}
+
+// StageLadder returns the current order of a ladder stage, top first.
+func StageLadder(db *sql.DB, stageID int) ([]models.LadderRung, error) {
+	ladder, err := loadLadder(db, stageID, 0)
+	if err != nil {
+		return nil, err
+	}
+	rungs := make([]models.LadderRung, len(ladder))
+	for i, r := range ladder {
+		rungs[i] = models.LadderRung{Position: r.Position, UserID: r.Entrant.UserID, TeamID: r.Entrant.TeamID, Disqualified: r.Disqualified}
+	}
+	return rungs, nil
+}
+
+// climbLadder swaps a challenger who won a ladder match with the entrant they beat. Entrants
+// cannot take on a second challenge while one is open, so the challenger is still the lower of
+// the two. Matches outside ladder stages, and challenges the higher entrant won, move nobody.
+func climbLadder(tx *sql.Tx, matchID int) error {
+	rows, err := tx.Query(`
+        SELECT sp.stage_id, sp.ladder_position, mp.is_winner
+        FROM match_participants mp
+        JOIN matches m ON m.match_id = mp.match_id
+        JOIN rounds r ON r.round_id = m.round_id
+        JOIN stage_participants sp ON sp.stage_id = r.stage_id
+            AND sp.user_id IS NOT DISTINCT FROM mp.user_id AND sp.team_id IS NOT DISTINCT FROM mp.team_id
+        WHERE mp.match_id = $1 AND sp.ladder_position IS NOT NULL
+    `, matchID)
+	if err != nil {
+		return fmt.Errorf("failed to load ladder positions: %w", err)
+	}
+	var stageID, winner, loser int
+	for rows.Next() {
+		var position int
+		var won bool
+		if err := rows.Scan(&stageID, &position, &won); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan ladder position: %w", err)
+		}
+		if won {
+			winner = position
+		} else {
+			loser = position
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("row error: %w", err)
+	}
+	rows.Close()
+	if winner == 0 || loser == 0 || winner < loser {
+		return nil
+	}
+	if _, err := tx.Exec(`
+        UPDATE stage_participants SET ladder_position = CASE ladder_position WHEN $2 THEN $3 ELSE $2 END
+        WHERE stage_id = $1 AND ladder_position IN ($2, $3)
+    `, stageID, winner, loser); err != nil {
+		return fmt.Errorf("failed to swap ladder positions: %w", err)
+	}
+	return nil
+}
+
+// rankLadder ranks a ladder stage by its current order. A ladder can be ranked once it is open
+// and no challenge is waiting to be played.
+func rankLadder(q queryer, stageID int) ([]entrant, error) {
+	ladder, err := loadLadder(q, stageID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(ladder) == 0 {
+		return nil, ErrStageNotFinished
+	}
+	ranked := make([]entrant, len(ladder))
+	for i, r := range ladder {
+		if r.Busy {
+			return nil, ErrStageNotFinished
+		}
+		ranked[i] = r.Entrant
+	}
+	return ranked, nil
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// ladderOf puts users on a ladder in the given order, all free to challenge.
+func ladderOf(userIDs ...int) []rung {
+	ladder := make([]rung, len(userIDs))
+	for i, e := range userEntrants(userIDs...) {
+		ladder[i] = rung{Entrant: e, Position: i + 1}
+	}
+	return ladder
+}
+
+func TestCheckChallenge(t *testing.T) {
+	busy := ladderOf(1, 2, 3, 4)
+	busy[1].Busy = true
+	cooling := ladderOf(1, 2, 3, 4)
+	cooling[3].CoolingDown = true
+	disqualified := ladderOf(1, 2, 3, 4)
+	disqualified[2].Disqualified = true
+	longer := ladderOf(1, 2, 3, 4, 5)
+	longer[2].Disqualified = true
+
+	tests := []struct {
+		name                   string
+		ladder                 []rung
+		challenger, challenged int
+		code                   string
+	}{
+		{"one place up", ladderOf(1, 2, 3, 4), 4, 3, ""},
+		{"at the edge of the range", ladderOf(1, 2, 3, 4), 4, 2, ""},
+		{"beyond the range", ladderOf(1, 2, 3, 4), 4, 1, CodeOutOfRange},
+		{"challenging down", ladderOf(1, 2, 3, 4), 2, 3, CodeOutOfRange},
+		{"self", ladderOf(1, 2, 3, 4), 2, 2, CodeSelfChallenge},
+		{"not on the ladder", ladderOf(1, 2, 3, 4), 9, 3, CodeNotOnLadder},
+		{"disqualified", disqualified, 4, 3, CodeNotOnLadder},
+		{"past a disqualified entrant", disqualified, 4, 1, ""},
+		{"beyond the range past a disqualified entrant", longer, 5, 1, CodeOutOfRange},
+		{"opponent already challenged", busy, 3, 2, CodeChallengePending},
+		{"challenger cooling down", cooling, 4, 3, CodeCooldown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := checkChallenge(tt.ladder, tt.challenger, tt.challenged, 2)
+			var chErr *ChallengeError
+			switch {
+			case tt.code == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.code != "" && (!errors.As(err, &chErr) || chErr.Code != tt.code):
+				t.Errorf("expected code %q, got: %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestCarryResult_ChallengerWinSwapsPlaces(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT match_id, source_outcome FROM match_slots`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_outcome"}))
+	mock.ExpectQuery(`SELECT sp.stage_id, sp.ladder_position, mp.is_winner`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "ladder_position", "is_winner"}).
+			AddRow(1, 3, false).
+			AddRow(1, 5, true))
+	mock.ExpectExec(`UPDATE stage_participants SET ladder_position = CASE ladder_position WHEN \$2 THEN \$3 ELSE \$2 END`).
+		WithArgs(1, 5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	expectNoTie(mock, 7)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := CarryResult(tx, 7); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestChallenge_LadderNotOpen(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(challenge_range, 1\)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "challenge_range", "challenge_cooldown_hours", "round_id"}).
+			AddRow(7, 2, 0, nil))
+	mock.ExpectRollback()
+
+	_, err := Challenge(db, 1, 4, 3)
+	var chErr *ChallengeError
+	if !errors.As(err, &chErr) || chErr.Code != CodeLadderNotOpen {
+		t.Errorf("expected ladder_not_open, got: %v", err)
+	}
+}
+
+func TestChallenge_LocksLadder(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(challenge_range, 1\)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "challenge_range", "challenge_cooldown_hours", "round_id"}).
+			AddRow(7, 2, 0, 9))
+	mock.ExpectExec(`SELECT 1 FROM stage_participants WHERE stage_id = \$1 AND ladder_position IS NOT NULL FOR UPDATE`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectQuery(`SELECT sp.user_id, sp.team_id, sp.ladder_position`).
+		WithArgs(1, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "ladder_position", "disqualified", "busy", "cooling_down"}).
+			AddRow(1, nil, 1, false, false, false).
+			AddRow(3, nil, 2, false, false, false).
+			AddRow(4, nil, 3, false, false, false))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(12))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	challenge, err := Challenge(db, 1, 4, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if challenge.MatchID != 12 || challenge.Challenger.Position != 3 || challenge.Challenged.Position != 2 {
+		t.Errorf("unexpected challenge: %+v", challenge)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+var (
+	// ErrNotParticipant is returned for an entrant who is not signed up to the competition.
+	ErrNotParticipant = errors.New("entrant is not a participant of this competition")
+	// ErrAlreadyDisqualified is returned when disqualifying an entrant a second time.
+	ErrAlreadyDisqualified = errors.New("entrant has already been disqualified")
+)
+
+// Outcome is how a match ended without being played out: ResultType is walkover, forfeit,
+// retired or double_forfeit. ParticipantID names the entrant who did not turn up, conceded or
+// retired, and loses the match; a double forfeit names nobody. Scores optionally records the
+// score as it stood, e.g. when a player retired mid-match; their is_winner is ignored.
+type Outcome struct {
+	ResultType    string              `json:"result_type"`
+	ParticipantID *int                `json:"participant_id"`
+	Scores        []ParticipantResult `json:"scores"`
+}
+
+// RecordOutcome completes a match with a result that was not played out. The named participant
+// loses and everyone else wins; in a double forfeit nobody wins and nobody goes on in the stage.
+// The same checks as for a played result apply: the match must not be waiting on earlier
+// results, nor have its result already carried forward. Byes cannot be given up, and heats
+// record entrants who did not finish by placing them instead.
+func RecordOutcome(db *sql.DB, matchID int, o Outcome) error {
+	if !engine.ValidResultType(o.ResultType) || o.ResultType == engine.ResultPlayed {
+		return resultError(CodeUnknownResultType, "result type must be walkover, forfeit, retired or double_forfeit")
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		st, err := loadMatchState(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if err := st.checkOpen(matchID); err != nil {
+			return err
+		}
+		if FormatRanksByPlacement(st.FormatID) {
+			return resultError(CodeMissingPlacement, "heats are decided by placement; place entrants who did not finish last")
+		}
+		if len(st.Entrants) < 2 {
+			return resultError(CodeNoOpponent, "match %d has no opponent to give it up to", matchID)
+		}
+
+		loser := -1
+		if o.ResultType == engine.ResultDoubleForfeit {
+			if o.ParticipantID != nil {
+				return resultError(CodeOutcomeParticipant, "a double forfeit is given up by every participant and names none")
+			}
+		} else {
+			if o.ParticipantID == nil {
+				return resultError(CodeOutcomeParticipant, "a %s names the participant who gave the match up", o.ResultType)
+			}
+			if loser = st.index(*o.ParticipantID); loser < 0 {
+				return resultError(CodeNotInMatch, "participant %d is not in match %d", *o.ParticipantID, matchID)
+			}
+		}
+		scores := make([]*int, len(st.Entrants))
+		for _, res := range o.Scores {
+			i := st.index(res.ParticipantID)
+			if i < 0 {
+				return resultError(CodeNotInMatch, "participant %d is not in match %d", res.ParticipantID, matchID)
+			}
+			scores[i] = res.Score
+		}
+
+		for i, e := range st.Entrants {
+			won := loser >= 0 && i != loser
+			if _, err := tx.Exec(`
+                UPDATE match_participants SET score = $1, is_winner = $2
+                WHERE match_id = $3 AND user_id IS NOT DISTINCT FROM $4 AND team_id IS NOT DISTINCT FROM $5
+            `, scores[i], won, matchID, e.UserID, e.TeamID); err != nil {
+				return fmt.Errorf("failed to update result: %w", err)
+			}
+		}
+		if _, err := tx.Exec(`UPDATE matches SET completed_at = NOW(), result_type = $2 WHERE match_id = $1`, matchID, o.ResultType); err != nil {
+			return fmt.Errorf("failed to complete match: %w", err)
+		}
+		return CarryResult(tx, matchID)
+	})
+}
+
+// settleMatch decides a match that cannot be played: one with disqualified participants, or one
+// left short of entrants because a match feeding it was a double forfeit. The one entrant still
+// able to play wins a walkover; with nobody left the match is a double forfeit. Completed
+// matches, matches still waiting on earlier results and matches between entrants who can all
+// play are left alone. A settled match moves its entrants on like any other result, which may
+// settle the matches it feeds in turn. It reports whether the match was settled.
+func settleMatch(tx *sql.Tx, matchID int) (bool, error) {
+	var open bool
+	if err := tx.QueryRow(`
+        SELECT m.completed_at IS NULL AND NOT EXISTS (SELECT 1 FROM match_slots s WHERE s.match_id = m.match_id AND NOT s.filled)
+        FROM matches m WHERE m.match_id = $1
+    `, matchID).Scan(&open); err != nil {
+		return false, fmt.Errorf("failed to load match: %w", err)
+	}
+	if !open {
+		return false, nil
+	}
+
+	rows, err := tx.Query(`
+        SELECT mp.user_id, mp.team_id, COALESCE(cp.disqualified_at IS NOT NULL, false)
+        FROM match_participants mp
+        JOIN matches m ON m.match_id = mp.match_id
+        JOIN rounds r ON r.round_id = m.round_id
+        JOIN competition_stages cs ON cs.stage_id = r.stage_id
+        LEFT JOIN competition_participants cp ON cp.competition_id = cs.competition_id
+            AND cp.user_id IS NOT DISTINCT FROM mp.user_id AND cp.team_id IS NOT DISTINCT FROM mp.team_id
+        WHERE mp.match_id = $1
+    `, matchID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load match participants: %w", err)
+	}
+	var active []entrant
+	for rows.Next() {
+		var e entrant
+		var disqualified bool
+		if err := rows.Scan(&e.UserID, &e.TeamID, &disqualified); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan match participant: %w", err)
+		}
+		if !disqualified {
+			active = append(active, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return false, fmt.Errorf("row error: %w", err)
+	}
+	rows.Close()
+	if len(active) >= 2 {
+		return false, nil
+	}
+
+	resultType := engine.ResultDoubleForfeit
+	if len(active) == 1 {
+		resultType = engine.ResultWalkover
+		if _, err := tx.Exec(`
+            UPDATE match_participants SET is_winner = true
+            WHERE match_id = $1 AND user_id IS NOT DISTINCT FROM $2 AND team_id IS NOT DISTINCT FROM $3
+        `, matchID, active[0].UserID, active[0].TeamID); err != nil {
+			return false, fmt.Errorf("failed to award walkover: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE matches SET completed_at = NOW(), result_type = $2 WHERE match_id = $1`, matchID, resultType); err != nil {
+		return false, fmt.Errorf("failed to complete match: %w", err)
+	}
+	return true, CarryResult(tx, matchID)
+}
+
+// DisqualifyEntrant removes an entrant from a competition for good. Every match it still has to
+// play whose opponent is known is awarded to the opponent as a walkover; matches it would reach
+// later, such as the losers bracket of a double elimination stage, are walked over as soon as
+// they are ready. Swiss pairings and stage advancement pass over disqualified entrants.
+func DisqualifyEntrant(db *sql.DB, competitionID int, who models.Entrant) (*models.Disqualification, error) {
+	e := entrant{UserID: who.UserID, TeamID: who.TeamID}
+	dq := &models.Disqualification{UserID: e.UserID, TeamID: e.TeamID, Walkovers: []int{}}
+	err := inTx(db, func(tx *sql.Tx) error {
+		var disqualified bool
+		err := tx.QueryRow(`
+            SELECT disqualified_at IS NOT NULL FROM competition_participants
+            WHERE competition_id = $1 AND user_id IS NOT DISTINCT FROM $2 AND team_id IS NOT DISTINCT FROM $3
+        `, competitionID, e.UserID, e.TeamID).Scan(&disqualified)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotParticipant
+		} else if err != nil {
+			return fmt.Errorf("failed to load participant: %w", err)
+		}
+		if disqualified {
+			return ErrAlreadyDisqualified
+		}
+		if _, err := tx.Exec(`
+            UPDATE competition_participants SET disqualified_at = NOW()
+            WHERE competition_id = $1 AND user_id IS NOT DISTINCT FROM $2 AND team_id IS NOT DISTINCT FROM $3
+        `, competitionID, e.UserID, e.TeamID); err != nil {
+			return fmt.Errorf("failed to disqualify participant: %w", err)
+		}
+
+		rows, err := tx.Query(`
+            SELECT m.match_id
+            FROM matches m
+            JOIN rounds r ON r.round_id = m.round_id
+            JOIN competition_stages cs ON cs.stage_id = r.stage_id
+            JOIN match_participants mp ON mp.match_id = m.match_id
+            WHERE cs.competition_id = $1 AND m.completed_at IS NULL
+              AND mp.user_id IS NOT DISTINCT FROM $2 AND mp.team_id IS NOT DISTINCT FROM $3
+            ORDER BY m.match_id
+        `, competitionID, e.UserID, e.TeamID)
+		if err != nil {
+			return fmt.Errorf("failed to load open matches: %w", err)
+		}
+		matchIDs, err := scanIDs(rows)
+		if err != nil {
+			return err
+		}
+		for _, id := range matchIDs {
+			settled, err := settleMatch(tx, id)
+			if err != nil {
+				return err
+			}
+			if settled {
+				dq.Walkovers = append(dq.Walkovers, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dq, nil
+}
+
+// settleDisqualified walks over the open matches of a stage that disqualified entrants were
+// drawn into, e.g. by a round generated after the disqualification.
+func settleDisqualified(tx *sql.Tx, stageID int) error {
+	rows, err := tx.Query(`
+        SELECT DISTINCT m.match_id
+        FROM matches m
+        JOIN rounds r ON r.round_id = m.round_id
+        JOIN competition_stages cs ON cs.stage_id = r.stage_id
+        JOIN match_participants mp ON mp.match_id = m.match_id
+        JOIN competition_participants cp ON cp.competition_id = cs.competition_id
+            AND cp.user_id IS NOT DISTINCT FROM mp.user_id AND cp.team_id IS NOT DISTINCT FROM mp.team_id
+        WHERE r.stage_id = $1 AND m.completed_at IS NULL AND cp.disqualified_at IS NOT NULL
+        ORDER BY m.match_id
+    `, stageID)
+	if err != nil {
+		return fmt.Errorf("failed to load matches of disqualified entrants: %w", err)
+	}
+	matchIDs, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+	for _, id := range matchIDs {
+		if _, err := settleMatch(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutDisqualified drops the entrants disqualified from the stage's competition.
+func withoutDisqualified(q queryer, stageID int, entrants []entrant) ([]entrant, error) {
+	rows, err := q.Query(`
+        SELECT cp.user_id, cp.team_id
+        FROM competition_participants cp
+        JOIN competition_stages cs ON cs.competition_id = cp.competition_id
+        WHERE cs.stage_id = $1 AND cp.disqualified_at IS NOT NULL
+    `, stageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load disqualified entrants: %w", err)
+	}
+	defer rows.Close()
+	disqualified := make(map[string]bool)
+	for rows.Next() {
+		var e entrant
+		if err := rows.Scan(&e.UserID, &e.TeamID); err != nil {
+			return nil, fmt.Errorf("failed to scan disqualified entrant: %w", err)
+		}
+		disqualified[e.Key()] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	kept := make([]entrant, 0, len(entrants))
+	for _, e := range entrants {
+		if !disqualified[e.Key()] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// scanIDs reads a single id column and closes the rows.
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return ids, nil
+}
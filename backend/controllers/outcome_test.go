@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// expectSettleCheck mocks settleMatch's first look at a match: open is false for a match that
+// is completed or still waiting on earlier results, which ends the check.
+func expectSettleCheck(mock sqlmock.Sqlmock, matchID int, open bool) {
+	mock.ExpectQuery(`SELECT m.completed_at IS NULL AND NOT EXISTS`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"open"}).AddRow(open))
+}
+
+// expectSettleParticipants mocks the participants of an open match, keyed by user id, with
+// whether each was disqualified.
+func expectSettleParticipants(mock sqlmock.Sqlmock, matchID int, users map[int]bool, order ...int) {
+	rows := sqlmock.NewRows([]string{"user_id", "team_id", "disqualified"})
+	for _, id := range order {
+		rows.AddRow(id, nil, users[id])
+	}
+	mock.ExpectQuery(`SELECT mp.user_id, mp.team_id, COALESCE\(cp.disqualified_at IS NOT NULL, false\)`).
+		WithArgs(matchID).
+		WillReturnRows(rows)
+}
+
+// expectDisqualifiedMatches mocks the lookup of a stage's open matches with disqualified
+// entrants in them.
+func expectDisqualifiedMatches(mock sqlmock.Sqlmock, stageID int, matchIDs ...int) {
+	rows := sqlmock.NewRows([]string{"match_id"})
+	for _, id := range matchIDs {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(`SELECT DISTINCT m.match_id`).
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
+
+// expectNothingCarried mocks carrying a result that fills no bracket slots and is not a ladder
+// challenge.
+func expectNothingCarried(mock sqlmock.Sqlmock, matchID int) {
+	mock.ExpectQuery(`SELECT match_id, source_outcome FROM match_slots`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_outcome"}))
+	mock.ExpectQuery(`SELECT sp.stage_id, sp.ladder_position, mp.is_winner`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "ladder_position", "is_winner"}))
+	expectNoTie(mock, matchID)
+}
+
+// expectNoTie mocks the leg lookup of a match that is not part of a two-legged tie.
+func expectNoTie(mock sqlmock.Sqlmock, matchID int) {
+	mock.ExpectQuery(`SELECT r.stage_id, m.round_id, COALESCE\(m.leg, 0\)`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_id", "leg", "first_leg_id"}).AddRow(1, 1, 0, 0))
+}
+
+func TestRecordOutcome_Walkover(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT r.stage_id, cs.tourney_format_id`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "tourney_format_id", "completed", "pending", "downstream", "stage_advanced", "leg"}).
+			AddRow(1, 1, false, false, false, false, 0))
+	mock.ExpectQuery(`SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, false, nil, nil, nil).
+			AddRow(6, nil, false, nil, nil, nil))
+	mock.ExpectExec(`UPDATE match_participants SET score = \$1, is_winner = \$2`).
+		WithArgs(nil, false, 2, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE match_participants SET score = \$1, is_winner = \$2`).
+		WithArgs(nil, true, 2, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\), result_type = \$2`).
+		WithArgs(2, "walkover").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 2)
+	mock.ExpectCommit()
+
+	absent := 5
+	if err := RecordOutcome(db, 2, Outcome{ResultType: "walkover", ParticipantID: &absent}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRecordOutcome_Rejected(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+
+	err := RecordOutcome(db, 2, Outcome{ResultType: "played"})
+	var resErr *ResultError
+	if !errors.As(err, &resErr) || resErr.Code != CodeUnknownResultType {
+		t.Errorf("expected %s, got %v", CodeUnknownResultType, err)
+	}
+}
+
+func TestSettleMatch_WalkoverAgainstDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSettleCheck(mock, 20, true)
+	expectSettleParticipants(mock, 20, map[int]bool{5: true, 6: false}, 5, 6)
+	mock.ExpectExec(`UPDATE match_participants SET is_winner = true`).
+		WithArgs(20, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\), result_type = \$2`).
+		WithArgs(20, "walkover").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 20)
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	settled, err := settleMatch(tx, 20)
+	if err != nil || !settled {
+		t.Fatalf("expected the match to be settled, got %v, %v", settled, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSettleMatch_LeavesPlayableMatch(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSettleCheck(mock, 20, true)
+	expectSettleParticipants(mock, 20, map[int]bool{}, 5, 6)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if settled, err := settleMatch(tx, 20); err != nil || settled {
+		t.Errorf("expected the match to be left alone, got %v, %v", settled, err)
+	}
+}
+
+func TestFillBracketSlots_DoubleForfeitGivesWalkover(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT match_id, source_outcome FROM match_slots WHERE source_match_id = \$1 AND NOT filled`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_outcome"}).AddRow(12, "W"))
+	mock.ExpectQuery(`SELECT result_type FROM matches`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"result_type"}).AddRow("double_forfeit"))
+	mock.ExpectExec(`UPDATE match_slots SET filled = true`).WithArgs(12, 7, "W").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// user 3 waits alone in match 12 and wins it
+	expectSettleCheck(mock, 12, true)
+	expectSettleParticipants(mock, 12, map[int]bool{}, 3)
+	mock.ExpectExec(`UPDATE match_participants SET is_winner = true`).
+		WithArgs(12, 3, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\), result_type = \$2`).
+		WithArgs(12, "walkover").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 12)
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := FillBracketSlots(tx, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDisqualifyEntrant_WalksOverOpenMatches(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT disqualified_at IS NOT NULL FROM competition_participants`).
+		WithArgs(1, 5, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disqualified"}).AddRow(false))
+	mock.ExpectExec(`UPDATE competition_participants SET disqualified_at = NOW\(\)`).
+		WithArgs(1, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT m.match_id\s+FROM matches m`).
+		WithArgs(1, 5, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(20).AddRow(21))
+	expectSettleCheck(mock, 20, true)
+	expectSettleParticipants(mock, 20, map[int]bool{5: true}, 5, 6)
+	mock.ExpectExec(`UPDATE match_participants SET is_winner = true`).
+		WithArgs(20, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\), result_type = \$2`).
+		WithArgs(20, "walkover").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 20)
+	// match 21 still waits on its other entrant and is walked over once it arrives
+	expectSettleCheck(mock, 21, false)
+	mock.ExpectCommit()
+
+	user := 5
+	dq, err := DisqualifyEntrant(db, 1, models.Entrant{UserID: &user})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dq.Walkovers, []int{20}) {
+		t.Errorf("expected a walkover in match 20, got %v", dq.Walkovers)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDisqualifyEntrant_NotParticipant(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT disqualified_at IS NOT NULL FROM competition_participants`).
+		WithArgs(1, 5, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disqualified"}))
+	mock.ExpectRollback()
+
+	user := 5
+	if _, err := DisqualifyEntrant(db, 1, models.Entrant{UserID: &user}); !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("expected ErrNotParticipant, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// ErrStageNotFinished is returned when a stage is ranked before its last match has been played.
+var ErrStageNotFinished = errors.New("stage is not finished yet")
+
+// rankTable ranks a Round Robin or Swiss stage by its standings, listing places across groups
+// (1A, 1B, ..., 2A, 2B, ...) so the first k*numGroups entrants are the top k of every group.
+func rankTable(q queryer, stageID, numGroups int) ([]entrant, error) {
+	groups, err := rankedStageTable(q, stageID, numGroups)
+	if err != nil {
+		return nil, err
+	}
+	var ranked []entrant
+	for place := 0; ; place++ {
+		added := false
+		for g := range groups {
+			if place < len(groups[g]) {
+				ranked = append(ranked, groups[g][place].Entrant)
+				added = true
+			}
+		}
+		if !added {
+			return ranked, nil
+		}
+	}
+}
+
+// stageMatchCounts returns how many matches a stage has and how many of them are unplayed.
+func stageMatchCounts(q queryer, stageID int) (total, open int, err error) {
+	if err = q.QueryRow(
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE m.completed_at IS NULL)
+         FROM matches m
+         JOIN rounds r ON m.round_id = r.round_id
+         WHERE r.stage_id = $1`,
+		stageID,
+	).Scan(&total, &open); err != nil {
+		return 0, 0, fmt.Errorf("failed to count stage matches: %w", err)
+	}
+	return total, open, nil
+}
+
+// checkSwissFinished makes sure every configured Swiss round has been generated.
+func checkSwissFinished(q queryer, stageID int) error {
+	var swissRounds, generated int
+	if err := q.QueryRow(
+		`SELECT COALESCE(swiss_rounds, 0), (SELECT COUNT(*) FROM rounds WHERE stage_id = $1) FROM competition_stages WHERE stage_id = $1`,
+		stageID,
+	).Scan(&swissRounds, &generated); err != nil {
+		return fmt.Errorf("failed to get swiss rounds: %w", err)
+	}
+	if generated < swissRounds {
+		return ErrStageNotFinished
+	}
+	return nil
+}
+
+// bracketProgress orders the rounds of an elimination stage by how far into the stage they are:
+// winners bracket rounds first, then losers bracket rounds, then the grand final.
+type bracketProgress struct {
+	Bracket int
+	Round   int
+}
+
+func (p bracketProgress) less(o bracketProgress) bool {
+	if p.Bracket != o.Bracket {
+		return p.Bracket < o.Bracket
+	}
+	return p.Round < o.Round
+}
+
+var bracketWeight = map[string]int{engine.NoBracket: 0, engine.Winners: 0, engine.Losers: 1, engine.GrandFinal: 2}
+
+// bracketLine is one entrant's part in one match of an elimination stage.
+type bracketLine struct {
+	MatchID  int
+	At       bracketProgress
+	Entrant  entrant
+	IsWinner bool
+}
+
+// rankElimination ranks a finished single or double elimination stage: the champion first, then
+// everyone else by the furthest round they played, so the runner-up follows the champion and
+// entrants knocked out earlier come later. A third place match orders the two semi-final losers;
+// entrants still level keep their seed order. A two-legged tie counts as a single match.
+func rankElimination(q queryer, stageID, formatID int) ([]entrant, error) {
+	entrants, err := loadStageEntrants(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := loadKnockoutResults(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []bracketLine
+	reached := make(map[string]bracketProgress)
+	thirdPlace := make(map[string]int) // 1 for the third place winner, 2 for the loser
+	for _, m := range results {
+		if !m.Completed {
+			return nil, ErrStageNotFinished
+		}
+		for i, e := range m.Entrants {
+			if m.Bracket == engine.ThirdPlace {
+				thirdPlace[e.Key()] = 2
+				if m.IsWinner[i] {
+					thirdPlace[e.Key()] = 1
+				}
+				continue
+			}
+			p := bracketLine{
+				MatchID:  m.MatchID,
+				At:       bracketProgress{Bracket: bracketWeight[m.Bracket], Round: m.Round},
+				Entrant:  e,
+				IsWinner: m.IsWinner[i],
+			}
+			lines = append(lines, p)
+			if r, ok := reached[e.Key()]; !ok || r.less(p.At) {
+				reached[e.Key()] = p.At
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil, ErrStageNotFinished
+	}
+
+	// The last round played decides the stage; it must be a single match with a winner.
+	last := lines[0].At
+	for _, p := range lines {
+		if last.less(p.At) {
+			last = p.At
+		}
+	}
+	var final []bracketLine
+	for _, p := range lines {
+		if p.At == last {
+			final = append(final, p)
+		}
+	}
+	var champion, runnerUp *entrant
+	for i := range final {
+		if final[i].MatchID != final[0].MatchID {
+			return nil, ErrStageNotFinished
+		}
+		if final[i].IsWinner {
+			champion = &final[i].Entrant
+		} else {
+			runnerUp = &final[i].Entrant
+		}
+	}
+	// A final left without an opponent by a double forfeit is a bye for the champion.
+	if champion == nil || (runnerUp == nil && len(final) > 1) {
+		return nil, ErrStageNotFinished
+	}
+	if formatID == models.DoubleElimination {
+		if last.Bracket != bracketWeight["G"] {
+			return nil, ErrStageNotFinished
+		}
+		// A first grand final won by the losers bracket entrant is followed by a reset.
+		if wc, _ := engine.WinnersChampion(results); last.Round == 1 && wc.Key() != champion.Key() {
+			return nil, ErrStageNotFinished
+		}
+	}
+
+	ranked := make([]entrant, len(entrants))
+	copy(ranked, entrants)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i].Key(), ranked[j].Key()
+		if (a == champion.Key()) != (b == champion.Key()) {
+			return a == champion.Key()
+		}
+		if reached[a] != reached[b] {
+			return reached[b].less(reached[a])
+		}
+		return thirdPlace[a] != 0 && (thirdPlace[b] == 0 || thirdPlace[a] < thirdPlace[b])
+	})
+	return ranked, nil
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectBracketResults(mock sqlmock.Sqlmock, stageID int, userIDs []int, rows *sqlmock.Rows) {
+	entrants := sqlmock.NewRows([]string{"user_id", "team_id", "seed"})
+	for _, id := range userIDs {
+		entrants.AddRow(id, nil, nil)
+	}
+	mock.ExpectQuery(`SELECT user_id, team_id, seed FROM stage_participants WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(entrants)
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\), r.round_number`).
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
+
+// doubleElimRows is a four entrant double elimination stage up to the first grand final,
+// which gfWinner wins against the other of 1 and 2.
+func doubleElimRows(gfWinner int) *sqlmock.Rows {
+	return resultRows().
+		AddRow(1, "W", 1, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(1, "W", 1, true, 4, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(2, "W", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(2, "W", 1, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(3, "W", 2, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(3, "W", 2, true, 2, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(4, "L", 1, true, 3, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(4, "L", 1, true, 4, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(5, "L", 2, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(5, "L", 2, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(6, "G", 1, true, 1, nil, gfWinner == 1, nil, "played", nil, nil, 0, 0, nil).AddRow(6, "G", 1, true, 2, nil, gfWinner == 2, nil, "played", nil, nil, 0, 0, nil)
+}
+
+func TestRankElimination_DoubleElimination(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectBracketResults(mock, 1, []int{4, 3, 2, 1}, doubleElimRows(1))
+
+	ranked, err := rankElimination(db, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []int{1, 2, 3, 4} {
+		if *ranked[i].UserID != want {
+			t.Fatalf("expected order 1, 2, 3, 4, got %+v", ranked)
+		}
+	}
+}
+
+func TestRankElimination_AwaitsGrandFinalReset(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectBracketResults(mock, 1, []int{1, 2, 3, 4}, doubleElimRows(2))
+
+	if _, err := rankElimination(db, 1, 2); err != ErrStageNotFinished {
+		t.Errorf("expected ErrStageNotFinished, got: %v", err)
+	}
+}
+
+func TestRankElimination_UnplayedFinal(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectBracketResults(mock, 1, []int{1, 2, 3, 4}, resultRows().
+		AddRow(10, "", 1, true, 1, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 4, nil, false, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(11, "", 1, true, 2, nil, true, nil, "played", nil, nil, 0, 0, nil).AddRow(11, "", 1, true, 3, nil, false, nil, "played", nil, nil, 0, 0, nil))
+
+	if _, err := rankElimination(db, 1, 1); err != ErrStageNotFinished {
+		t.Errorf("expected ErrStageNotFinished, got: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+// ParticipantResult is one participant's part in a submitted match or game result. The
+// participant is identified by its user or team id. Heats also record the finishing place and,
+// optionally, the finishing time in milliseconds.
+type ParticipantResult struct {
+	ParticipantID int  `json:"participant_id"`
+	Score         *int `json:"score"`
+	IsWinner      bool `json:"is_winner"`
+	Placement     *int `json:"placement,omitempty"`
+	TimeMs        *int `json:"time_ms,omitempty"`
+}
+
+// Codes reported with a rejected match result.
+const (
+	CodeEmptyResult          = "empty_result"
+	CodeNotInMatch           = "participant_not_in_match"
+	CodeDuplicateParticipant = "duplicate_participant"
+	CodeMultipleWinners      = "multiple_winners"
+	CodeDrawNotAllowed       = "draw_not_allowed"
+	CodeWinnerScoreMismatch  = "winner_score_mismatch"
+	CodeDrawScoreMismatch    = "draw_score_mismatch"
+	CodeMatchNotReady        = "match_not_ready"
+	CodeResultLocked         = "result_locked"
+	CodeMatchNotCompleted    = "match_not_completed"
+	CodeDownstreamPlayed     = "downstream_played"
+	CodeUnknownResultType    = "unknown_result_type"
+	CodeNoOpponent           = "no_opponent"
+	CodeOutcomeParticipant   = "outcome_participant"
+	CodePlacementNotAllowed  = "placement_not_allowed"
+	CodeMissingPlacement     = "missing_placement"
+	CodeInvalidPlacements    = "invalid_placements"
+	CodeWinnerPlacement      = "winner_placement_mismatch"
+	CodeTimePlacement        = "time_placement_mismatch"
+	CodeMissingScore         = "missing_score"
+	CodeMissingParticipant   = "missing_participant"
+	CodeByeNotWon            = "bye_not_won"
+	CodeMatchCompleted       = "match_completed"
+)
+
+// ResultError is a match result that was rejected. Code is one of the Code constants and stays
+// stable for clients; Message explains the problem.
+type ResultError struct {
+	Code    string
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return e.Message
+}
+
+func resultError(code, format string, args ...interface{}) error {
+	return &ResultError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// matchState is what result validation knows about a match: its format, whether it is played,
+// still waiting on earlier results, or already carried forward, its leg when it is part of a
+// two-legged tie, and its stored participants.
+type matchState struct {
+	StageID     int
+	FormatID    int
+	Leg         int
+	Completed   bool
+	Pending     bool
+	Downstream  bool
+	StageClosed bool
+	Entrants    []entrant
+	Stored      []ParticipantResult
+}
+
+// loadMatchState reads a match for result validation. Downstream reports whether a later match
+// of the stage took an entrant from this result: a filled bracket slot, or a match created after
+// it was completed. StageClosed reports whether the stage's entrants have moved on: the next
+// stage has been populated or the competition has finished. Inside a transaction the match row
+// stays locked until it ends, so results for the same match are checked and written one at a
+// time.
+func loadMatchState(q queryer, matchID int) (*matchState, error) {
+	var st matchState
+	err := q.QueryRow(`
+        SELECT r.stage_id, cs.tourney_format_id, m.completed_at IS NOT NULL,
+            EXISTS (SELECT 1 FROM match_slots s WHERE s.match_id = m.match_id AND NOT s.filled),
+            m.completed_at IS NOT NULL AND (
+                EXISTS (SELECT 1 FROM match_slots s WHERE s.source_match_id = m.match_id AND s.filled)
+                OR EXISTS (
+                    SELECT 1 FROM matches later
+                    JOIN rounds lr ON later.round_id = lr.round_id
+                    WHERE lr.stage_id = r.stage_id AND later.scheduled_at > m.completed_at
+                )
+            ),
+            EXISTS (
+                SELECT 1 FROM competition_stages next
+                JOIN stage_participants sp ON sp.stage_id = next.stage_id
+                WHERE next.competition_id = cs.competition_id AND next.stage_order = cs.stage_order + 1
+            ) OR EXISTS (SELECT 1 FROM competitions c WHERE c.competition_id = cs.competition_id AND c.status = 3),
+            COALESCE(m.leg, 0)
+        FROM matches m
+        JOIN rounds r ON m.round_id = r.round_id
+        JOIN competition_stages cs ON cs.stage_id = r.stage_id
+        WHERE m.match_id = $1
+        FOR UPDATE OF m
+    `, matchID).Scan(&st.StageID, &st.FormatID, &st.Completed, &st.Pending, &st.Downstream, &st.StageClosed, &st.Leg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMatchNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load match: %w", err)
+	}
+
+	rows, err := q.Query(`SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants WHERE match_id = $1`, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load match participants: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e entrant
+		var p ParticipantResult
+		if err := rows.Scan(&e.UserID, &e.TeamID, &p.IsWinner, &p.Score, &p.Placement, &p.TimeMs); err != nil {
+			return nil, fmt.Errorf("failed to scan match participant: %w", err)
+		}
+		st.Entrants = append(st.Entrants, e)
+		st.Stored = append(st.Stored, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return &st, nil
+}
+
+// index returns the position of a participant, by user or team id, among the match's entrants,
+// -1 if it does not play in the match.
+func (st *matchState) index(participantID int) int {
+	for i, e := range st.Entrants {
+		if (e.UserID != nil && *e.UserID == participantID) || (e.TeamID != nil && *e.TeamID == participantID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkOpen rejects a new result for a match still waiting on earlier results, or whose result
+// has already been carried forward into later rounds or the next stage.
+func (st *matchState) checkOpen(matchID int) error {
+	if st.Pending {
+		return resultError(CodeMatchNotReady, "match %d is still waiting on the results of earlier matches", matchID)
+	}
+	if st.Completed && (st.Downstream || st.StageClosed) {
+		return resultError(CodeResultLocked, "the result of match %d has already been carried into later rounds", matchID)
+	}
+	return nil
+}
+
+// merge lays the submitted entries over the stored result and returns the result they leave.
+func (st *matchState) merge(matchID int, results []ParticipantResult) ([]ParticipantResult, error) {
+	if len(results) == 0 {
+		return nil, resultError(CodeEmptyResult, "a result needs at least one participant")
+	}
+	merged := make([]ParticipantResult, len(st.Stored))
+	copy(merged, st.Stored)
+	submitted := make(map[int]bool)
+	for _, res := range results {
+		found := st.index(res.ParticipantID)
+		if found < 0 {
+			return nil, resultError(CodeNotInMatch, "participant %d is not in match %d", res.ParticipantID, matchID)
+		}
+		if submitted[found] {
+			return nil, resultError(CodeDuplicateParticipant, "participant %d is listed more than once", res.ParticipantID)
+		}
+		submitted[found] = true
+		merged[found].Score, merged[found].IsWinner = res.Score, res.IsWinner
+		merged[found].Placement, merged[found].TimeMs = res.Placement, res.TimeMs
+	}
+	if FormatRanksByPlacement(st.FormatID) {
+		return merged, checkPlacements(merged)
+	}
+	for _, p := range merged {
+		if p.Placement != nil || p.TimeMs != nil {
+			return nil, resultError(CodePlacementNotAllowed, "placements and times are only recorded in heats")
+		}
+	}
+	// The legs of a tie can be drawn; the tie is decided on their aggregate score.
+	leg := st.Leg == engine.FirstLeg || st.Leg == engine.SecondLeg
+	if leg {
+		for _, p := range merged {
+			if p.Score == nil {
+				return nil, resultError(CodeMissingScore, "both legs of a tie need a score for every participant")
+			}
+		}
+	}
+	return merged, checkResult(merged, FormatAllowsDraws(st.FormatID) || leg)
+}
+
+// ValidateResult checks a result submitted for a match before it is written. The submitted
+// entries are merged over what is stored, so a partial update is checked as the result it
+// leaves behind: every entry must name a participant of the match, at most one participant may
+// win, a bye must be won by its only participant, a result without a winner is only allowed in
+// formats with draws, and where every participant has a score the winner must have the highest
+// one (or all scores must be level in a draw). The two legs of a tie can be drawn but need every score. Heats are checked by
+// placement instead, see checkPlacements. A match still waiting on earlier results, or whose
+// result has already been carried forward into later rounds or the next stage, cannot be
+// changed; CorrectResult repairs those.
+// It returns ErrMatchNotFound for an unknown match and a *ResultError for a rejected result.
+func ValidateResult(q queryer, matchID int, results []ParticipantResult) error {
+	st, err := loadMatchState(q, matchID)
+	if err != nil {
+		return err
+	}
+	if err := st.checkOpen(matchID); err != nil {
+		return err
+	}
+	_, err = st.merge(matchID, results)
+	return err
+}
+
+// SaveResult checks a result submitted for a match as ValidateResult does, writes it, completes
+// the match and carries the result forward into the matches that wait on it, all in one
+// transaction.
+func SaveResult(db *sql.DB, matchID int, results []ParticipantResult) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		if err := ValidateResult(tx, matchID, results); err != nil {
+			return err
+		}
+		if err := writeResult(tx, matchID, results); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE matches SET completed_at = NOW(), result_type = 'played' WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to complete match: %w", err)
+		}
+		return CarryResult(tx, matchID)
+	})
+}
+
+// UpdateResult records scores for a match that is still being played without completing it. The
+// entries are checked as ValidateResult does; the result of a completed match is changed with
+// CorrectResult instead.
+func UpdateResult(db *sql.DB, matchID int, results []ParticipantResult) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		st, err := loadMatchState(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if st.Completed {
+			return resultError(CodeMatchCompleted, "match %d already has a result; correct it to change it", matchID)
+		}
+		if err := st.checkOpen(matchID); err != nil {
+			return err
+		}
+		if _, err := st.merge(matchID, results); err != nil {
+			return err
+		}
+		return writeResult(tx, matchID, results)
+	})
+}
+
+// writeResult stores the submitted entries of a result on the match's participants.
+func writeResult(tx *sql.Tx, matchID int, results []ParticipantResult) error {
+	for _, res := range results {
+		if _, err := tx.Exec(`
+            UPDATE match_participants
+            SET score = $1, is_winner = $2, placement = $3, time_ms = $4
+            WHERE match_id = $5 AND (user_id = $6 OR team_id = $6)
+        `, res.Score, res.IsWinner, res.Placement, res.TimeMs, matchID, res.ParticipantID); err != nil {
+			return fmt.Errorf("failed to save result: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkResult checks the winners and scores of a complete match result.
+func checkResult(result []ParticipantResult, allowDraws bool) error {
+	winner := -1
+	scored := true
+	for i, p := range result {
+		if p.IsWinner {
+			if winner >= 0 {
+				return resultError(CodeMultipleWinners, "only one participant can win a match")
+			}
+			winner = i
+		}
+		scored = scored && p.Score != nil
+	}
+	if winner < 0 && len(result) == 1 {
+		return resultError(CodeByeNotWon, "the only participant of a match must win it")
+	}
+	if winner < 0 && len(result) > 1 && !allowDraws {
+		return resultError(CodeDrawNotAllowed, "knockout matches cannot end in a draw")
+	}
+	if !scored || len(result) < 2 {
+		return nil
+	}
+	for i, p := range result {
+		switch {
+		case winner >= 0 && i != winner && *p.Score >= *result[winner].Score:
+			return resultError(CodeWinnerScoreMismatch, "the winner must have the highest score")
+		case winner < 0 && *p.Score != *result[0].Score:
+			return resultError(CodeDrawScoreMismatch, "a draw needs level scores")
+		}
+	}
+	return nil
+}
+
+// checkPlacements checks the result of a heat: every participant needs a finishing place, the
+// places must run from 1 with equal places only for a dead heat (1, 2, 2, 4), the winners are
+// exactly those placed first, and a better place cannot come with a slower time. Scores, such
+// as points in a battle royale, are recorded as they are.
+func checkPlacements(result []ParticipantResult) error {
+	places := make([]int, 0, len(result))
+	for _, p := range result {
+		if p.Placement == nil {
+			return resultError(CodeMissingPlacement, "every participant of a heat needs a placement")
+		}
+		places = append(places, *p.Placement)
+	}
+	sort.Ints(places)
+	for i, place := range places {
+		if place != i+1 && (i == 0 || place != places[i-1]) {
+			return resultError(CodeInvalidPlacements, "placements must run from 1, sharing a place only in a dead heat")
+		}
+	}
+	for i, p := range result {
+		if p.IsWinner != (*p.Placement == 1) {
+			return resultError(CodeWinnerPlacement, "the winners of a heat are the participants placed first")
+		}
+		for _, o := range result[i+1:] {
+			if p.TimeMs == nil || o.TimeMs == nil {
+				continue
+			}
+			if (*p.Placement < *o.Placement && *p.TimeMs > *o.TimeMs) || (*o.Placement < *p.Placement && *o.TimeMs > *p.TimeMs) {
+				return resultError(CodeTimePlacement, "a better placement cannot have a slower time")
+			}
+		}
+	}
+	return nil
+}
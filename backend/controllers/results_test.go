@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+func scored(score int, won bool) ParticipantResult {
+	return ParticipantResult{Score: &score, IsWinner: won}
+}
+
+func TestCheckResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     []ParticipantResult
+		allowDraws bool
+		code       string
+	}{
+		{"winner with the higher score", []ParticipantResult{scored(3, true), scored(1, false)}, false, ""},
+		{"winner without scores", []ParticipantResult{{IsWinner: true}, {}}, false, ""},
+		{"level draw", []ParticipantResult{scored(2, false), scored(2, false)}, true, ""},
+		{"draw in knockout", []ParticipantResult{scored(2, false), scored(2, false)}, false, CodeDrawNotAllowed},
+		{"draw with uneven scores", []ParticipantResult{scored(2, false), scored(1, false)}, true, CodeDrawScoreMismatch},
+		{"winner on a tied score", []ParticipantResult{scored(2, true), scored(2, false)}, false, CodeWinnerScoreMismatch},
+		{"two winners", []ParticipantResult{{IsWinner: true}, {IsWinner: true}}, true, CodeMultipleWinners},
+		{"bye", []ParticipantResult{{IsWinner: true}}, false, ""},
+		{"bye without a winner", []ParticipantResult{{}}, true, CodeByeNotWon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkResult(tt.result, tt.allowDraws)
+			var resErr *ResultError
+			switch {
+			case tt.code == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.code != "" && (!errors.As(err, &resErr) || resErr.Code != tt.code):
+				t.Errorf("expected code %q, got: %v", tt.code, err)
+			}
+		})
+	}
+}
+
+// placed is a heat result for the given place and time; the winners are those placed first.
+func placed(place int, timeMs *int) ParticipantResult {
+	return ParticipantResult{Placement: &place, TimeMs: timeMs, IsWinner: place == 1}
+}
+
+func TestCheckPlacements(t *testing.T) {
+	fast, slow := 58000, 61000
+	winnerless := placed(1, nil)
+	winnerless.IsWinner = false
+	tests := []struct {
+		name   string
+		result []ParticipantResult
+		code   string
+	}{
+		{"finishing order", []ParticipantResult{placed(2, nil), placed(1, nil), placed(3, nil)}, ""},
+		{"dead heat", []ParticipantResult{placed(1, nil), placed(2, nil), placed(2, nil), placed(4, nil)}, ""},
+		{"shared win", []ParticipantResult{placed(1, nil), placed(1, nil), placed(3, nil)}, ""},
+		{"times in order", []ParticipantResult{placed(1, &fast), placed(2, &slow), placed(3, nil)}, ""},
+		{"missing place", []ParticipantResult{placed(1, nil), {}}, CodeMissingPlacement},
+		{"gap in places", []ParticipantResult{placed(1, nil), placed(3, nil)}, CodeInvalidPlacements},
+		{"dead heat without the skipped place", []ParticipantResult{placed(1, nil), placed(1, nil), placed(2, nil)}, CodeInvalidPlacements},
+		{"first place not winning", []ParticipantResult{winnerless, placed(2, nil)}, CodeWinnerPlacement},
+		{"slower time placed higher", []ParticipantResult{placed(1, &slow), placed(2, &fast)}, CodeTimePlacement},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPlacements(tt.result)
+			var resErr *ResultError
+			switch {
+			case tt.code == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.code != "" && (!errors.As(err, &resErr) || resErr.Code != tt.code):
+				t.Errorf("expected code %q, got: %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestMerge_TieLegs(t *testing.T) {
+	st := &matchState{FormatID: models.SingleElimination, Leg: engine.FirstLeg, Entrants: userEntrants(5, 6), Stored: make([]ParticipantResult, 2)}
+	drawn := []ParticipantResult{scored(1, false), scored(1, false)}
+	drawn[0].ParticipantID, drawn[1].ParticipantID = 5, 6
+	if _, err := st.merge(1, drawn); err != nil {
+		t.Errorf("expected a drawn leg to be accepted, got: %v", err)
+	}
+
+	var resErr *ResultError
+	if _, err := st.merge(1, []ParticipantResult{{ParticipantID: 5, IsWinner: true}}); !errors.As(err, &resErr) || resErr.Code != CodeMissingScore {
+		t.Errorf("expected code %q, got: %v", CodeMissingScore, err)
+	}
+
+	st.Leg = 0
+	if _, err := st.merge(1, drawn); !errors.As(err, &resErr) || resErr.Code != CodeDrawNotAllowed {
+		t.Errorf("expected code %q, got: %v", CodeDrawNotAllowed, err)
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/models"
+)
+
+var (
+	// ErrMatchNotFound is returned for a match id that does not exist.
+	ErrMatchNotFound = errors.New("match not found")
+	// ErrSeriesDecided is returned when a game is recorded for a series that already has a winner.
+	ErrSeriesDecided = errors.New("the series has already been decided")
+	// ErrGameWinner is returned for a game without exactly one winner.
+	ErrGameWinner = errors.New("a game needs exactly one winner")
+	// ErrNotInMatch is returned for a participant that does not play in the match.
+	ErrNotInMatch = errors.New("participant is not in this match")
+)
+
+// ValidateBestOf checks a series length. It must be odd so that one side always wins the series.
+func ValidateBestOf(bestOf int) error {
+	if bestOf < 1 || bestOf%2 == 0 {
+		return errors.New("best of must be a positive odd number of games")
+	}
+	return nil
+}
+
+// gamesToWin is the number of games that decides a best-of series.
+func gamesToWin(bestOf int) int {
+	return bestOf/2 + 1
+}
+
+// RecordGame adds the next game of a match's series. The series score on match_participants is
+// the games each side has won; once a side reaches the games needed for the match's best-of
+// length it wins the match, which is completed and advances its entrants like any other result.
+// Matches without a series length are a best of one. A game is only recorded for a match that is
+// ready to be played, and it must list every participant of the match once with scores that
+// agree with its winner; a rejected game is reported as a *ResultError.
+func RecordGame(db *sql.DB, matchID int, results []ParticipantResult) error {
+	winners := 0
+	for _, res := range results {
+		if res.IsWinner {
+			winners++
+		}
+	}
+	if winners != 1 {
+		return ErrGameWinner
+	}
+
+	return inTx(db, func(tx *sql.Tx) error {
+		st, err := loadMatchState(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if st.Completed {
+			return ErrSeriesDecided
+		}
+		if err := st.checkOpen(matchID); err != nil {
+			return err
+		}
+		if err := st.checkGame(matchID, results); err != nil {
+			return err
+		}
+
+		var bestOf int
+		if err := tx.QueryRow(`
+            SELECT COALESCE(r.best_of, cs.best_of, 1)
+            FROM matches m
+            JOIN rounds r ON m.round_id = r.round_id
+            JOIN competition_stages cs ON cs.stage_id = r.stage_id
+            WHERE m.match_id = $1
+        `, matchID).Scan(&bestOf); err != nil {
+			return fmt.Errorf("failed to get series length: %w", err)
+		}
+
+		var game int
+		if err := tx.QueryRow(
+			`SELECT COALESCE(MAX(game_number), 0) + 1 FROM match_games WHERE match_id = $1`,
+			matchID,
+		).Scan(&game); err != nil {
+			return fmt.Errorf("failed to get game number: %w", err)
+		}
+		for _, res := range results {
+			inserted, err := tx.Exec(`
+                INSERT INTO match_games (match_id, game_number, user_id, team_id, score, is_winner)
+                SELECT match_id, $2, user_id, team_id, $3, $4
+                FROM match_participants
+                WHERE match_id = $1 AND (user_id = $5 OR team_id = $5)
+            `, matchID, game, res.Score, res.IsWinner, res.ParticipantID)
+			if err != nil {
+				return fmt.Errorf("failed to insert game result: %w", err)
+			}
+			if n, err := inserted.RowsAffected(); err != nil {
+				return fmt.Errorf("failed to insert game result: %w", err)
+			} else if n != 1 {
+				return fmt.Errorf("%w: %d", ErrNotInMatch, res.ParticipantID)
+			}
+		}
+
+		if _, err := tx.Exec(`
+            UPDATE match_participants mp
+            SET score = (
+                SELECT COUNT(*) FROM match_games g
+                WHERE g.match_id = mp.match_id AND g.is_winner
+                  AND g.user_id IS NOT DISTINCT FROM mp.user_id
+                  AND g.team_id IS NOT DISTINCT FROM mp.team_id
+            )
+            WHERE mp.match_id = $1
+        `, matchID); err != nil {
+			return fmt.Errorf("failed to update series score: %w", err)
+		}
+		var leader int
+		if err := tx.QueryRow(
+			`SELECT COALESCE(MAX(score), 0) FROM match_participants WHERE match_id = $1`,
+			matchID,
+		).Scan(&leader); err != nil {
+			return fmt.Errorf("failed to get series score: %w", err)
+		}
+		if leader < gamesToWin(bestOf) {
+			return nil
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE match_participants SET is_winner = (score = $2) WHERE match_id = $1`,
+			matchID, leader,
+		); err != nil {
+			return fmt.Errorf("failed to set series winner: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE matches SET completed_at = NOW() WHERE match_id = $1`, matchID); err != nil {
+			return fmt.Errorf("failed to complete match: %w", err)
+		}
+		return CarryResult(tx, matchID)
+	})
+}
+
+// checkGame rejects a game that does not list every participant of the match exactly once, or
+// whose scores contradict its winner.
+func (st *matchState) checkGame(matchID int, results []ParticipantResult) error {
+	listed := make(map[int]bool)
+	for _, res := range results {
+		found := st.index(res.ParticipantID)
+		if found < 0 {
+			return resultError(CodeNotInMatch, "participant %d is not in match %d", res.ParticipantID, matchID)
+		}
+		if listed[found] {
+			return resultError(CodeDuplicateParticipant, "participant %d is listed more than once", res.ParticipantID)
+		}
+		listed[found] = true
+	}
+	if len(listed) != len(st.Entrants) {
+		return resultError(CodeMissingParticipant, "a game of match %d needs a result for every participant", matchID)
+	}
+	return checkResult(results, false)
+}
+
+// RoundGames returns the games played in each match of a round, by match id.
+func RoundGames(db *sql.DB, roundID int) (map[int][]models.MatchGame, error) {
+	rows, err := db.Query(`
+        SELECT g.match_id, g.game_number, g.user_id, g.team_id, g.score, g.is_winner
+        FROM match_games g
+        JOIN matches m ON g.match_id = m.match_id
+        WHERE m.round_id = $1
+        ORDER BY g.match_id, g.game_number
+    `, roundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load games: %w", err)
+	}
+	defer rows.Close()
+	return scanGames(rows)
+}
+
+// MatchGames returns the games played in a match, in order.
+func MatchGames(db *sql.DB, matchID int) ([]models.MatchGame, error) {
+	rows, err := db.Query(`
+        SELECT match_id, game_number, user_id, team_id, score, is_winner
+        FROM match_games
+        WHERE match_id = $1
+        ORDER BY game_number
+    `, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load games: %w", err)
+	}
+	defer rows.Close()
+	games, err := scanGames(rows)
+	return games[matchID], err
+}
+
+// scanGames groups game rows, ordered by match and game number, into games by match id.
+func scanGames(rows *sql.Rows) (map[int][]models.MatchGame, error) {
+	games := make(map[int][]models.MatchGame)
+	for rows.Next() {
+		var matchID, number int
+		var r models.GameResult
+		if err := rows.Scan(&matchID, &number, &r.UserID, &r.TeamID, &r.Score, &r.IsWinner); err != nil {
+			return nil, fmt.Errorf("failed to scan game: %w", err)
+		}
+		played := games[matchID]
+		if len(played) == 0 || played[len(played)-1].GameNumber != number {
+			played = append(played, models.MatchGame{GameNumber: number})
+		}
+		played[len(played)-1].Results = append(played[len(played)-1].Results, r)
+		games[matchID] = played
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return games, nil
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectGameChecks mocks loading the state and participants (users) of a match before a game is
+// recorded for it.
+func expectGameChecks(mock sqlmock.Sqlmock, matchID int, completed, pending bool, userIDs ...int) {
+	mock.ExpectQuery(`SELECT r.stage_id, cs.tourney_format_id`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "tourney_format_id", "completed", "pending", "downstream", "stage_advanced", "leg"}).
+			AddRow(1, 1, completed, pending, false, false, 0))
+	rows := sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"})
+	for _, id := range userIDs {
+		rows.AddRow(id, nil, false, nil, nil, nil)
+	}
+	mock.ExpectQuery(`SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants`).
+		WithArgs(matchID).
+		WillReturnRows(rows)
+}
+
+// expectGame mocks recording one game of a best-of series up to the series score update, with
+// winner beating loser.
+func expectGame(mock sqlmock.Sqlmock, matchID, bestOf, game, winner, loser int) {
+	mock.ExpectBegin()
+	expectGameChecks(mock, matchID, false, false, winner, loser)
+	mock.ExpectQuery(`SELECT COALESCE\(r.best_of, cs.best_of, 1\)`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"best_of"}).AddRow(bestOf))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(game_number\), 0\) \+ 1 FROM match_games`).
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"game"}).AddRow(game))
+	mock.ExpectExec(`INSERT INTO match_games`).
+		WithArgs(matchID, game, nil, true, winner).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO match_games`).
+		WithArgs(matchID, game, nil, false, loser).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE match_participants mp`).
+		WithArgs(matchID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+}
+
+func gameReports(winner, loser int) []ParticipantResult {
+	return []ParticipantResult{{ParticipantID: winner, IsWinner: true}, {ParticipantID: loser}}
+}
+
+func TestRecordGame_SeriesContinues(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectGame(mock, 7, 3, 1, 1, 2)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(score\), 0\) FROM match_participants`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(1))
+	mock.ExpectCommit()
+
+	if err := RecordGame(db, 7, gameReports(1, 2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRecordGame_DecidesSeries(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	expectGame(mock, 7, 3, 3, 1, 2)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(score\), 0\) FROM match_participants`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(2))
+	mock.ExpectExec(`UPDATE match_participants SET is_winner = \(score = \$2\) WHERE match_id = \$1`).
+		WithArgs(7, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE matches SET completed_at = NOW\(\) WHERE match_id = \$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectNothingCarried(mock, 7)
+	mock.ExpectCommit()
+
+	if err := RecordGame(db, 7, gameReports(1, 2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRecordGame_AlreadyDecided(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectGameChecks(mock, 7, true, false, 1, 2)
+	mock.ExpectRollback()
+
+	if err := RecordGame(db, 7, gameReports(1, 2)); !errors.Is(err, ErrSeriesDecided) {
+		t.Errorf("expected series decided error, got: %v", err)
+	}
+}
+
+func TestRecordGame_Rejected(t *testing.T) {
+	one, three := 1, 3
+	tests := []struct {
+		name    string
+		pending bool
+		results []ParticipantResult
+		code    string
+	}{
+		{"not ready", true, gameReports(1, 2), CodeMatchNotReady},
+		{"unknown participant", false, gameReports(9, 2), CodeNotInMatch},
+		{"listed twice", false, gameReports(1, 1), CodeDuplicateParticipant},
+		{"missing participant", false, []ParticipantResult{{ParticipantID: 1, IsWinner: true}}, CodeMissingParticipant},
+		{"winner scored less", false, []ParticipantResult{
+			{ParticipantID: 1, Score: &one, IsWinner: true},
+			{ParticipantID: 2, Score: &three},
+		}, CodeWinnerScoreMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+
+			mock.ExpectBegin()
+			expectGameChecks(mock, 7, false, tt.pending, 1, 2)
+			mock.ExpectRollback()
+
+			var resErr *ResultError
+			if err := RecordGame(db, 7, tt.results); !errors.As(err, &resErr) || resErr.Code != tt.code {
+				t.Fatalf("expected %s, got: %v", tt.code, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateBestOf(t *testing.T) {
+	for _, n := range []int{1, 3, 5, 7} {
+		if err := ValidateBestOf(n); err != nil {
+			t.Errorf("best of %d: unexpected error: %v", n, err)
+		}
+	}
+	for _, n := range []int{0, 2, -3} {
+		if err := ValidateBestOf(n); err == nil {
+			t.Errorf("best of %d: expected an error", n)
+		}
+	}
+}
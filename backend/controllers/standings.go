@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// pointsSystem is what a stage awards for each match outcome.
+type pointsSystem = engine.Points
+
+// matchResult is one match of a stage with its participants in a stable order.
+type matchResult = engine.Result
+
+// standing is an entrant's line in a stage table.
+type standing struct {
+	Entrant      entrant
+	Group        int
+	Played       int
+	Won          int
+	Drawn        int
+	Lost         int
+	ScoreFor     int
+	ScoreAgainst int
+	Points       int
+	// SeparatedBy names the criterion that put this entrant below the one ranked just above it,
+	// empty for the leader and for entrants still level after every tiebreaker.
+	SeparatedBy string
+}
+
+// FormatAllowsDraws reports whether matches of a format may end without a winner. Knockout
+// formats need a winner to advance someone.
+func FormatAllowsDraws(formatID int) bool {
+	return formatID == models.RoundRobin || formatID == models.Swiss
+}
+
+// rankingRules is how a stage turns results into a table: points per outcome, how walkovers,
+// forfeits and retirements count, and the tiebreakers applied, in order, to entrants level on
+// points.
+type rankingRules struct {
+	Points      pointsSystem
+	Results     resultRules
+	Tiebreakers []string
+}
+
+// resultRules is how a stage's table counts matches that were not played out. AwardedScore,
+// when set, replaces the scores of walkovers and forfeits: the winner is credited with it and
+// everyone else with 0. RetiredAsForfeit counts a retirement as a forfeit instead of as a loss
+// with the score as it stood.
+type resultRules struct {
+	AwardedScore     *int
+	RetiredAsForfeit bool
+}
+
+// loadRankingRules reads the stage's points per win, draw and loss (3/1/0 unless configured),
+// the points for a forfeit (a loss unless configured), its result rules and its tiebreaker chain.
+func loadRankingRules(q queryer, stageID int) (rankingRules, error) {
+	var rules rankingRules
+	var tiebreakers string
+	if err := q.QueryRow(
+		`SELECT COALESCE(points_win, 3), COALESCE(points_draw, 1), COALESCE(points_loss, 0), COALESCE(tiebreakers, ''),
+             COALESCE(forfeit_points, points_loss, 0), awarded_score, COALESCE(retired_as_forfeit, false)
+         FROM competition_stages WHERE stage_id=$1`,
+		stageID,
+	).Scan(&rules.Points.Win, &rules.Points.Draw, &rules.Points.Loss, &tiebreakers,
+		&rules.Points.Forfeit, &rules.Results.AwardedScore, &rules.Results.RetiredAsForfeit); err != nil {
+		return rules, fmt.Errorf("failed to get stage ranking rules: %w", err)
+	}
+	chain, err := ParseTiebreakers(tiebreakers)
+	if err != nil {
+		return rules, err
+	}
+	rules.Tiebreakers = chain
+	return rules, nil
+}
+
+// apply returns the results as the stage's table counts them: retirements turned into forfeits
+// if configured, and the awarded score in place of the recorded one for matches given up.
+func (r resultRules) apply(results []matchResult) []matchResult {
+	counted := make([]matchResult, len(results))
+	for i, m := range results {
+		if r.RetiredAsForfeit && m.Type == engine.ResultRetired {
+			m.Type = engine.ResultForfeit
+		}
+		if r.AwardedScore != nil && m.Forfeited() {
+			scores := make([]*int, len(m.Scores))
+			for j := range scores {
+				score := 0
+				if m.IsWinner[j] {
+					score = *r.AwardedScore
+				}
+				scores[j] = &score
+			}
+			m.Scores = scores
+		}
+		counted[i] = m
+	}
+	return counted
+}
+
+// loadStageResults reads every match of a stage together with its participants, in match order.
+func loadStageResults(q queryer, stageID int) ([]matchResult, error) {
+	rows, err := q.Query(
+		`SELECT m.match_id, COALESCE(r.bracket, ''), r.round_number, m.completed_at IS NOT NULL, mp.user_id, mp.team_id, mp.is_winner, mp.score, m.result_type,
+             mp.placement, mp.time_ms, COALESCE(m.leg, 0), COALESCE(m.first_leg_id, 0), mp.side
+         FROM matches m
+         JOIN rounds r ON m.round_id = r.round_id
+         JOIN match_participants mp ON mp.match_id = m.match_id
+         WHERE r.stage_id = $1
+         ORDER BY m.match_id`,
+		stageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stage results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []matchResult
+	for rows.Next() {
+		var matchID, round, leg, firstLeg int
+		var bracket, resultType string
+		var completed, isWinner bool
+		var e entrant
+		var score, placement, timeMs *int
+		var side sql.NullString
+		if err := rows.Scan(&matchID, &bracket, &round, &completed, &e.UserID, &e.TeamID, &isWinner, &score, &resultType, &placement, &timeMs, &leg, &firstLeg, &side); err != nil {
+			return nil, fmt.Errorf("failed to scan stage result: %w", err)
+		}
+		if len(results) == 0 || results[len(results)-1].MatchID != matchID {
+			results = append(results, matchResult{MatchID: matchID, Bracket: bracket, Round: round, Completed: completed, Type: resultType, Leg: leg, FirstLeg: firstLeg})
+		}
+		m := &results[len(results)-1]
+		m.Entrants = append(m.Entrants, e)
+		m.IsWinner = append(m.IsWinner, isWinner)
+		m.Scores = append(m.Scores, score)
+		m.Placements = append(m.Placements, placement)
+		m.Times = append(m.Times, timeMs)
+		m.Sides = append(m.Sides, side.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+	return results, nil
+}
+
+// computeStandings tallies completed matches into one standing per entrant, in entrant order.
+// A bye (a match with a single entrant) counts as a win; a match without a winner is a draw,
+// except a double forfeit, which both sides lose. Entrants who gave a match up get the forfeit
+// points instead of the loss points.
+func computeStandings(entrants []entrant, results []matchResult, points pointsSystem) []standing {
+	table := make([]standing, len(entrants))
+	index := make(map[string]int, len(entrants))
+	for i, e := range entrants {
+		table[i].Entrant = e
+		index[e.Key()] = i
+	}
+
+	for _, m := range results {
+		if !m.Completed {
+			continue
+		}
+		draw := m.IsDraw()
+		for i, e := range m.Entrants {
+			idx, ok := index[e.Key()]
+			if !ok {
+				continue
+			}
+			s := &table[idx]
+			s.Played++
+			switch {
+			case draw:
+				s.Drawn++
+				s.Points += points.Draw
+			case m.IsWinner[i]:
+				s.Won++
+				s.Points += points.Win
+			default:
+				s.Lost++
+				s.Points += points.Lost(m)
+			}
+			for j := range m.Entrants {
+				if m.Scores[j] == nil {
+					continue
+				}
+				if j == i {
+					s.ScoreFor += *m.Scores[j]
+				} else {
+					s.ScoreAgainst += *m.Scores[j]
+				}
+			}
+		}
+	}
+	return table
+}
+
+// rankedStageTable builds the ranked table of a stage, one slice per group. Entrants only play
+// inside their group, so each group is ranked on its own; a stage without groups is one group.
+func rankedStageTable(q queryer, stageID, numGroups int) ([][]standing, error) {
+	if numGroups < 1 {
+		numGroups = 1
+	}
+	var entrants []entrant
+	groupOf := make(map[string]int)
+	rows, err := q.Query(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = $1`, stageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e entrant
+		var group sql.NullInt64
+		if err := rows.Scan(&e.UserID, &e.TeamID, &group); err != nil {
+			return nil, err
+		}
+		entrants = append(entrants, e)
+		groupOf[e.Key()] = int(group.Int64)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %w", err)
+	}
+
+	rules, err := loadRankingRules(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := loadStageResults(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+	results = rules.Results.apply(results)
+	table := computeStandings(entrants, results, rules.Points)
+
+	groups := make([][]standing, numGroups)
+	for _, s := range table {
+		g := 0
+		if numGroups > 1 {
+			g = groupOf[s.Entrant.Key()] - 1
+			if g < 0 || g >= numGroups {
+				return nil, fmt.Errorf("participant has no group assigned")
+			}
+		}
+		s.Group = g + 1
+		groups[g] = append(groups[g], s)
+	}
+	for g := range groups {
+		groups[g] = rankStandings(groups[g], results, rules, int64(stageID))
+	}
+	return groups, nil
+}
+
+// ErrNoStandings is returned for stages whose format does not produce a table.
+var ErrNoStandings = errors.New("standings are only available for Round Robin and Swiss stages")
+
+// StageStandings returns the table of a Round Robin or Swiss stage, group by group, ranked the
+// same way entrants are picked to advance. Entrants still level after every tiebreaker share a rank.
+func StageStandings(db *sql.DB, stageID int) ([]models.Standing, error) {
+	var formatID, numGroups int
+	if err := db.QueryRow(`SELECT tourney_format_id, COALESCE(num_groups, 1) FROM competition_stages WHERE stage_id = $1`, stageID).Scan(&formatID, &numGroups); err != nil {
+		return nil, fmt.Errorf("could not get stage format: %w", err)
+	}
+	if formatID != models.RoundRobin && formatID != models.Swiss {
+		return nil, ErrNoStandings
+	}
+
+	groups, err := rankedStageTable(db, stageID, numGroups)
+	if err != nil {
+		return nil, err
+	}
+	standings := make([]models.Standing, 0)
+	for _, group := range groups {
+		rank := 0
+		for i, s := range group {
+			if i == 0 || s.SeparatedBy != "" {
+				rank = i + 1
+			}
+			standings = append(standings, models.Standing{
+				Rank:         rank,
+				Group:        s.Group,
+				UserID:       s.Entrant.UserID,
+				TeamID:       s.Entrant.TeamID,
+				Played:       s.Played,
+				Won:          s.Won,
+				Drawn:        s.Drawn,
+				Lost:         s.Lost,
+				ScoreFor:     s.ScoreFor,
+				ScoreAgainst: s.ScoreAgainst,
+				ScoreDiff:    s.ScoreFor - s.ScoreAgainst,
+				Points:       s.Points,
+				SeparatedBy:  s.SeparatedBy,
+			})
+		}
+	}
+	return standings, nil
+}
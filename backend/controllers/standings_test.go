@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func completedMatch(id int, a, b int, winner int, scoreA, scoreB int) matchResult {
+	ua, ub := a, b
+	sa, sb := scoreA, scoreB
+	return matchResult{
+		MatchID:   id,
+		Completed: true,
+		Entrants:  []entrant{{UserID: &ua}, {UserID: &ub}},
+		IsWinner:  []bool{winner == a, winner == b},
+		Scores:    []*int{&sa, &sb},
+	}
+}
+
+func TestComputeStandings_WinsDrawsLosses(t *testing.T) {
+	results := []matchResult{
+		completedMatch(1, 1, 2, 1, 2, 0),
+		completedMatch(2, 1, 3, 0, 1, 1),
+		completedMatch(3, 2, 3, 3, 0, 3),
+	}
+	table := computeStandings(userEntrants(1, 2, 3), results, pointsSystem{Win: 3, Draw: 1, Loss: 0})
+
+	one := table[0]
+	if one.Played != 2 || one.Won != 1 || one.Drawn != 1 || one.Lost != 0 || one.Points != 4 {
+		t.Errorf("unexpected standing for user 1: %+v", one)
+	}
+	if one.ScoreFor != 3 || one.ScoreAgainst != 1 {
+		t.Errorf("unexpected scores for user 1: %+v", one)
+	}
+	if table[1].Points != 0 || table[1].Lost != 2 {
+		t.Errorf("unexpected standing for user 2: %+v", table[1])
+	}
+	if table[2].Points != 4 || table[2].Drawn != 1 {
+		t.Errorf("unexpected standing for user 3: %+v", table[2])
+	}
+}
+
+func TestComputeStandings_SkipsUnfinishedMatches(t *testing.T) {
+	m := completedMatch(1, 1, 2, 0, 0, 0)
+	m.Completed = false
+	table := computeStandings(userEntrants(1, 2), []matchResult{m}, pointsSystem{Win: 3, Draw: 1})
+	if table[0].Played != 0 || table[0].Points != 0 {
+		t.Errorf("unfinished match counted: %+v", table[0])
+	}
+}
+
+func rankedIDs(ranked []standing) []int {
+	ids := make([]int, len(ranked))
+	for i, s := range ranked {
+		ids[i] = *s.Entrant.UserID
+	}
+	return ids
+}
+
+func TestRankStandings_PointsThenHeadToHead(t *testing.T) {
+	results := []matchResult{
+		completedMatch(1, 2, 1, 2, 1, 0),
+		completedMatch(2, 1, 3, 1, 5, 0),
+		completedMatch(3, 2, 4, 4, 0, 1),
+		completedMatch(4, 3, 4, 0, 2, 2),
+	}
+	rules := rankingRules{Points: pointsSystem{Win: 3, Draw: 1}, Tiebreakers: DefaultTiebreakers}
+	ranked := rankStandings(computeStandings(userEntrants(1, 2, 3, 4), results, rules.Points), results, rules, 1)
+
+	if got := rankedIDs(ranked); !reflect.DeepEqual(got, []int{4, 2, 1, 3}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	separated := []string{"", "points", TiebreakHeadToHead, "points"}
+	for i, s := range ranked {
+		if s.SeparatedBy != separated[i] {
+			t.Errorf("position %d: expected separated by %q, got %q", i+1, separated[i], s.SeparatedBy)
+		}
+	}
+}
+
+func TestRankStandings_FallsThroughChain(t *testing.T) {
+	// users 1 and 2 drew each other and beat user 3 by different margins
+	results := []matchResult{
+		completedMatch(1, 1, 2, 0, 1, 1),
+		completedMatch(2, 1, 3, 1, 2, 0),
+		completedMatch(3, 2, 3, 2, 4, 0),
+	}
+	rules := rankingRules{Points: pointsSystem{Win: 3, Draw: 1}, Tiebreakers: []string{TiebreakHeadToHead, TiebreakScoreDiff}}
+	ranked := rankStandings(computeStandings(userEntrants(1, 2, 3), results, rules.Points), results, rules, 1)
+	if got := rankedIDs(ranked); !reflect.DeepEqual(got, []int{2, 1, 3}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if ranked[1].SeparatedBy != TiebreakScoreDiff {
+		t.Errorf("expected score difference to separate users 2 and 1, got %q", ranked[1].SeparatedBy)
+	}
+}
+
+func TestRankStandings_HeadToHeadCountsForfeits(t *testing.T) {
+	// users 1, 2 and 3 beat each other in a circle and are level on points; user 2's defeat was a
+	// forfeit, which costs a point in the head to head table too
+	forfeit := completedMatch(1, 1, 2, 1, 0, 0)
+	forfeit.Type = "forfeit"
+	results := []matchResult{
+		forfeit,
+		completedMatch(2, 2, 3, 2, 1, 0),
+		completedMatch(3, 3, 1, 3, 1, 0),
+		completedMatch(4, 2, 4, 0, 1, 1),
+	}
+	rules := rankingRules{Points: pointsSystem{Win: 3, Draw: 1, Forfeit: -1}, Tiebreakers: []string{TiebreakHeadToHead}}
+	ranked := rankStandings(computeStandings(userEntrants(1, 2, 3, 4), results, rules.Points), results, rules, 1)
+	if got := rankedIDs(ranked); !reflect.DeepEqual(got, []int{1, 3, 2, 4}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if ranked[2].SeparatedBy != TiebreakHeadToHead {
+		t.Errorf("expected head to head to separate user 2, got %q", ranked[2].SeparatedBy)
+	}
+}
+
+func TestRankStandings_Buchholz(t *testing.T) {
+	// users 1, 2 and 3 won once each; user 2 beat the only opponent without a point
+	results := []matchResult{
+		completedMatch(1, 1, 3, 1, 1, 0),
+		completedMatch(2, 2, 4, 2, 1, 0),
+		completedMatch(3, 3, 5, 3, 1, 0),
+	}
+	rules := rankingRules{Points: pointsSystem{Win: 1}, Tiebreakers: []string{TiebreakBuchholz}}
+	ranked := rankStandings(computeStandings(userEntrants(1, 2, 3, 4, 5), results, rules.Points), results, rules, 1)
+	if got := rankedIDs(ranked); !reflect.DeepEqual(got, []int{1, 3, 2, 4, 5}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if ranked[1].SeparatedBy != "" || ranked[2].SeparatedBy != TiebreakBuchholz {
+		t.Errorf("expected users 1 and 3 level and user 2 behind on buchholz, got %+v", ranked)
+	}
+}
+
+func TestRankStandings_RandomIsStable(t *testing.T) {
+	rules := rankingRules{Tiebreakers: []string{TiebreakRandom}}
+	table := computeStandings(userEntrants(1, 2, 3, 4, 5), nil, rules.Points)
+	first := rankedIDs(rankStandings(table, nil, rules, 7))
+	for i := 0; i < 5; i++ {
+		if got := rankedIDs(rankStandings(table, nil, rules, 7)); !reflect.DeepEqual(got, first) {
+			t.Fatalf("random tiebreak changed between calls: %v vs %v", first, got)
+		}
+	}
+}
+
+func TestParseTiebreakers(t *testing.T) {
+	chain, err := ParseTiebreakers("")
+	if err != nil || !reflect.DeepEqual(chain, DefaultTiebreakers) {
+		t.Errorf("expected default chain, got %v (%v)", chain, err)
+	}
+	chain, err = ParseTiebreakers("Buchholz, wins")
+	if err != nil || !reflect.DeepEqual(chain, []string{TiebreakBuchholz, TiebreakWins}) {
+		t.Errorf("unexpected chain %v (%v)", chain, err)
+	}
+	if _, err := ParseTiebreakers("wins,coin_toss"); err == nil {
+		t.Error("expected error for unknown tiebreaker")
+	}
+	if _, err := ParseTiebreakers("wins,wins"); err == nil {
+		t.Error("expected error for duplicate tiebreaker")
+	}
+}
+
+func TestStageStandings_LevelEntrantsShareRank(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 1))
+	mock.ExpectQuery(`SELECT user_id, team_id, group_number FROM stage_participants WHERE stage_id = \$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).
+			AddRow(1, nil, nil).AddRow(2, nil, nil).AddRow(3, nil, nil).AddRow(4, nil, nil))
+	expectStageResults(mock, stageID, resultRows().
+		AddRow(10, "", 1, true, 1, nil, true, 1, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 2, nil, false, 0, "played", nil, nil, 0, 0, nil).
+		AddRow(11, "", 1, true, 3, nil, true, 1, "played", nil, nil, 0, 0, nil).AddRow(11, "", 1, true, 4, nil, false, 0, "played", nil, nil, 0, 0, nil))
+
+	standings, err := StageStandings(db, stageID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ranks []int
+	for _, s := range standings {
+		ranks = append(ranks, s.Rank)
+	}
+	if !reflect.DeepEqual(ranks, []int{1, 1, 3, 3}) {
+		t.Errorf("expected ranks [1 1 3 3], got %v", ranks)
+	}
+	if top := standings[0]; top.Played != 1 || top.Won != 1 || top.Points != 3 || top.ScoreDiff != 1 || top.Group != 1 {
+		t.Errorf("unexpected leader line: %+v", top)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestStageStandings_KnockoutStage(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT tourney_format_id, COALESCE\(num_groups, 1\) FROM competition_stages WHERE stage_id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(1, 1))
+
+	if _, err := StageStandings(db, 1); err != ErrNoStandings {
+		t.Errorf("expected ErrNoStandings, got: %v", err)
+	}
+}
+
+func TestComputeStandings_Forfeits(t *testing.T) {
+	walkover := completedMatch(1, 1, 2, 1, 0, 0)
+	walkover.Type = "walkover"
+	double := completedMatch(2, 1, 3, 0, 0, 0)
+	double.Type = "double_forfeit"
+	points := pointsSystem{Win: 3, Draw: 1, Loss: 0, Forfeit: -1}
+	table := computeStandings(userEntrants(1, 2, 3), []matchResult{walkover, double}, points)
+
+	if one := table[0]; one.Won != 1 || one.Lost != 1 || one.Drawn != 0 || one.Points != 2 {
+		t.Errorf("unexpected standing for user 1: %+v", one)
+	}
+	if two := table[1]; two.Lost != 1 || two.Points != -1 {
+		t.Errorf("unexpected standing for user 2: %+v", two)
+	}
+	if three := table[2]; three.Lost != 1 || three.Drawn != 0 || three.Points != -1 {
+		t.Errorf("unexpected standing for user 3: %+v", three)
+	}
+}
+
+func TestResultRules_Apply(t *testing.T) {
+	forfeit := completedMatch(1, 1, 2, 2, 1, 0)
+	forfeit.Type = "forfeit"
+	retired := completedMatch(2, 1, 3, 1, 2, 3)
+	retired.Type = "retired"
+	awarded := 3
+	counted := resultRules{AwardedScore: &awarded, RetiredAsForfeit: true}.apply([]matchResult{forfeit, retired})
+
+	if *counted[0].Scores[0] != 0 || *counted[0].Scores[1] != 3 {
+		t.Errorf("expected the forfeit to count 0-3, got %d-%d", *counted[0].Scores[0], *counted[0].Scores[1])
+	}
+	if counted[1].Type != "forfeit" || *counted[1].Scores[0] != 3 || *counted[1].Scores[1] != 0 {
+		t.Errorf("expected the retirement to count as a 3-0 forfeit, got %+v", counted[1])
+	}
+	if *forfeit.Scores[0] != 1 {
+		t.Error("apply changed the recorded scores")
+	}
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+// inTx runs fn in a transaction that is committed when fn succeeds and rolled back otherwise.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
+				log.Printf("rollback error: %v", rbErr)
+			}
+			panic(p)
+		} else if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
+				log.Printf("rollback error: %v", rbErr)
+			}
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// insertRound adds a round to a stage. Stages without brackets pass an empty bracket.
+func insertRound(tx *sql.Tx, stageID, roundNumber int, bracket string) (int, error) {
+	var roundID int
+	var err error
+	if bracket == "" {
+		err = tx.QueryRow(
+			`INSERT INTO rounds (stage_id, round_number) VALUES ($1, $2) RETURNING round_id`,
+			stageID, roundNumber,
+		).Scan(&roundID)
+	} else {
+		err = tx.QueryRow(
+			`INSERT INTO rounds (stage_id, round_number, bracket) VALUES ($1, $2, $3) RETURNING round_id`,
+			stageID, roundNumber, bracket,
+		).Scan(&roundID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert round: %w", err)
+	}
+	return roundID, nil
+}
+
+// insertMatch adds an unplayed match between the given entrants to a round: a pair for head to
+// head formats, a whole heat for formats that race everyone at once. Sides, when given, records
+// which entrant plays at home and which away.
+func insertMatch(tx *sql.Tx, roundID int, entrants []entrant, sides []string) (int, error) {
+	var matchID int
+	if err := tx.QueryRow(
+		`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
+		roundID,
+	).Scan(&matchID); err != nil {
+		return 0, fmt.Errorf("failed to insert match: %w", err)
+	}
+	values := make([]string, len(entrants))
+	args := []interface{}{matchID}
+	for i, e := range entrants {
+		var side interface{}
+		if i < len(sides) {
+			side = sides[i]
+		}
+		values[i] = fmt.Sprintf("($1, $%d, $%d, false, NULL, $%d)", 3*i+2, 3*i+3, 3*i+4)
+		args = append(args, e.UserID, e.TeamID, side)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score, side)
+         VALUES `+strings.Join(values, ", "),
+		args...,
+	); err != nil {
+		return 0, fmt.Errorf("failed to insert match participants: %w", err)
+	}
+	return matchID, nil
+}
+
+// insertBye records a bye as an already completed single-participant match won by the entrant.
+func insertBye(tx *sql.Tx, roundID int, e entrant) (int, error) {
+	var matchID int
+	if err := tx.QueryRow(
+		`INSERT INTO matches (round_id, scheduled_at, completed_at) VALUES ($1, NOW(), NOW()) RETURNING match_id`,
+		roundID,
+	).Scan(&matchID); err != nil {
+		return 0, fmt.Errorf("failed to insert bye match: %w", err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
+         VALUES ($1, $2, $3, true, NULL)`,
+		matchID, e.UserID, e.TeamID,
+	); err != nil {
+		return 0, fmt.Errorf("failed to insert bye participant: %w", err)
+	}
+	return matchID, nil
+}
+
+// insertSlotMatch adds a match whose entrants are not all known yet: the known ones become
+// participants and every slot a match_slots row pointing at the match that fills it.
+// matchIDs holds the ids of the matches inserted so far, by planned round and match.
+func insertSlotMatch(tx *sql.Tx, roundID int, m engine.Match, matchIDs [][]int) (int, error) {
+	var matchID int
+	if err := tx.QueryRow(
+		`INSERT INTO matches (round_id, scheduled_at) VALUES ($1, NOW()) RETURNING match_id`,
+		roundID,
+	).Scan(&matchID); err != nil {
+		return 0, fmt.Errorf("failed to insert match: %w", err)
+	}
+	for _, e := range m.Entrants {
+		if err := insertParticipant(tx, matchID, e); err != nil {
+			return 0, err
+		}
+	}
+	for _, s := range m.Slots {
+		outcome := slotWinner
+		if s.Loser {
+			outcome = slotLoser
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO match_slots (match_id, source_match_id, source_outcome) VALUES ($1, $2, $3)`,
+			matchID, matchIDs[s.Round][s.Match], outcome,
+		); err != nil {
+			return 0, fmt.Errorf("failed to insert match slot: %w", err)
+		}
+	}
+	return matchID, nil
+}
+
+// insertParticipant adds an entrant to a match that has not been played yet.
+func insertParticipant(tx *sql.Tx, matchID int, e entrant) error {
+	if _, err := tx.Exec(
+		`INSERT INTO match_participants (match_id, user_id, team_id, is_winner, score)
+         VALUES ($1, $2, $3, false, NULL)`,
+		matchID, e.UserID, e.TeamID,
+	); err != nil {
+		return fmt.Errorf("failed to insert match participant: %w", err)
+	}
+	return nil
+}
+
+// insertRounds writes rounds planned by the engine, including matches that wait on the results
+// of earlier ones. A random draw is recorded on every round written whose matches were all
+// drawn from it, which leaves out rounds that wait on results.
+func insertRounds(tx *sql.Tx, stageID int, rounds []engine.Round, draw *stageDraw) error {
+	matchIDs := make([][]int, len(rounds))
+	var firstLeg int
+	for r, round := range rounds {
+		roundID, err := insertRound(tx, stageID, round.Number, round.Bracket)
+		if err != nil {
+			return err
+		}
+		drawn := true
+		for _, m := range round.Matches {
+			drawn = drawn && len(m.Slots) == 0
+		}
+		if drawn {
+			if err := recordDraw(tx, roundID, draw); err != nil {
+				return err
+			}
+		}
+		for _, m := range round.Matches {
+			var matchID int
+			switch {
+			case m.IsBye():
+				// Byes are recorded as completed single-participant matches so the entrant advances.
+				matchID, err = insertBye(tx, roundID, m.Entrants[0])
+			case len(m.Slots) > 0:
+				matchID, err = insertSlotMatch(tx, roundID, m, matchIDs)
+			default:
+				matchID, err = insertMatch(tx, roundID, m.Entrants, m.Sides)
+			}
+			if err != nil {
+				return err
+			}
+			if m.Leg > 0 {
+				if m.Leg == engine.FirstLeg {
+					firstLeg = matchID
+				}
+				if err := linkLeg(tx, matchID, m.Leg, firstLeg); err != nil {
+					return err
+				}
+			}
+			matchIDs[r] = append(matchIDs[r], matchID)
+		}
+	}
+	return nil
+}
+
+// CarryResult carries the result of a match that has just been completed forward: into the
+// bracket slots waiting on it, up the ladder when a challenger won, and into a decider when the
+// second leg of a tie leaves it level.
+func CarryResult(tx *sql.Tx, matchID int) error {
+	if err := FillBracketSlots(tx, matchID); err != nil {
+		return err
+	}
+	if err := climbLadder(tx, matchID); err != nil {
+		return err
+	}
+	return decideTie(tx, matchID)
+}
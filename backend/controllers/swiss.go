@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+// GenerateRoundSwiss inserts the next Swiss round for a stage. Entrants are paired by current
+// score without rematches, and with an odd count the lowest-ranked entrant without a bye sits out
+// and is credited with a win. Entrants disqualified from the competition are left out of every
+// round. Generation stops once the stage's swiss_rounds have been played.
+func GenerateRoundSwiss(db *sql.DB, stageID int) error {
+	var totalRounds sql.NullInt64
+	if err := db.QueryRow(
+		`SELECT swiss_rounds FROM competition_stages WHERE stage_id=$1`,
+		stageID,
+	).Scan(&totalRounds); err != nil {
+		return fmt.Errorf("failed to get swiss rounds: %w", err)
+	}
+	if !totalRounds.Valid || totalRounds.Int64 < 1 {
+		return fmt.Errorf("swiss stage has no round count configured")
+	}
+
+	results, err := loadStageResults(db, stageID)
+	if err != nil {
+		return fmt.Errorf("failed to load previous rounds: %w", err)
+	}
+	var entrants []entrant
+	var draw *stageDraw
+	if len(results) == 0 {
+		entrants, draw, err = loadDrawnEntrants(db, stageID)
+	} else {
+		// only the first round is drawn; later rounds are paired by score among the entrants
+		// still in the competition
+		if entrants, err = loadStageEntrants(db, stageID); err == nil {
+			entrants, err = withoutDisqualified(db, stageID, entrants)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	rules, err := loadRankingRules(db, stageID)
+	if err != nil {
+		return err
+	}
+
+	round, err := engine.SwissNextRound(entrants, rules.Results.apply(results), rules.Points, int(totalRounds.Int64))
+	if err != nil {
+		return err
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		return insertRounds(tx, stageID, []engine.Round{round}, draw)
+	})
+}
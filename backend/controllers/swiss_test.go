@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func userEntrants(ids ...int) []entrant {
+	entrants := make([]entrant, len(ids))
+	for i := range ids {
+		id := ids[i]
+		entrants[i] = entrant{UserID: &id}
+	}
+	return entrants
+}
+
+// --- GenerateRoundSwiss ---
+
+func TestGenerateRoundSwiss_Success_WithBye(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	mock.ExpectQuery(`SELECT swiss_rounds FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"swiss_rounds"}).AddRow(3))
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID)
+	mock.ExpectQuery(`SELECT COALESCE\(points_win, 3\), COALESCE\(points_draw, 1\), COALESCE\(points_loss, 0\), COALESCE\(tiebreakers, ''\),`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"points_win", "points_draw", "points_loss", "tiebreakers", "forfeit_points", "awarded_score", "retired_as_forfeit"}).AddRow(3, 1, 0, "", 0, nil, false))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(100, 1, nil, nil, 2, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at, completed_at\)`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(101))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(101, 3, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSwiss(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSwiss_FirstRoundLeavesOutDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	mock.ExpectQuery(`SELECT swiss_rounds FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"swiss_rounds"}).AddRow(3))
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(stageID).
+		WillReturnRows(resultRows())
+	expectStageEntrants(mock, stageID, "seeded", 1, 2, 3)
+	expectDisqualified(mock, stageID, 3)
+	mock.ExpectQuery(`SELECT COALESCE\(points_win, 3\), COALESCE\(points_draw, 1\), COALESCE\(points_loss, 0\), COALESCE\(tiebreakers, ''\),`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"points_win", "points_draw", "points_loss", "tiebreakers", "forfeit_points", "awarded_score", "retired_as_forfeit"}).AddRow(3, 1, 0, "", 0, nil, false))
+
+	// with user 3 gone the count is even, so nobody gets a bye
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rounds \(stage_id, round_number\) VALUES \(\$1, \$2\) RETURNING round_id`).
+		WithArgs(stageID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(10))
+	mock.ExpectQuery(`INSERT INTO matches \(round_id, scheduled_at\) VALUES \(\$1, NOW\(\)\) RETURNING match_id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(100))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(100, 1, nil, nil, 2, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	if err := GenerateRoundSwiss(db, stageID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateRoundSwiss_NoRoundCount(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	stageID := 1
+	mock.ExpectQuery(`SELECT swiss_rounds FROM competition_stages WHERE stage_id=\$1`).
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"swiss_rounds"}).AddRow(nil))
+
+	if err := GenerateRoundSwiss(db, stageID); err == nil {
+		t.Error("expected error for missing swiss round count")
+	}
+}
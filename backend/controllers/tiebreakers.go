@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Tiebreakers that can be chained on a stage to order entrants level on points.
+const (
+	TiebreakHeadToHead      = "head_to_head"
+	TiebreakScoreDiff       = "score_diff"
+	TiebreakScoreFor        = "score_for"
+	TiebreakBuchholz        = "buchholz"
+	TiebreakSonnebornBerger = "sonneborn_berger"
+	TiebreakWins            = "wins"
+	TiebreakRandom          = "random"
+)
+
+// rankByPoints is reported as the separating criterion for entrants on different points.
+const rankByPoints = "points"
+
+// DefaultTiebreakers is used by stages that do not configure their own chain.
+var DefaultTiebreakers = []string{TiebreakHeadToHead, TiebreakScoreDiff, TiebreakScoreFor}
+
+var knownTiebreakers = map[string]bool{
+	TiebreakHeadToHead:      true,
+	TiebreakScoreDiff:       true,
+	TiebreakScoreFor:        true,
+	TiebreakBuchholz:        true,
+	TiebreakSonnebornBerger: true,
+	TiebreakWins:            true,
+	TiebreakRandom:          true,
+}
+
+// ParseTiebreakers reads a stored chain such as "head_to_head,score_diff". An empty chain means
+// the default one.
+func ParseTiebreakers(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultTiebreakers, nil
+	}
+	seen := make(map[string]bool)
+	var chain []string
+	for _, part := range strings.Split(s, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if !knownTiebreakers[name] {
+			return nil, fmt.Errorf("unknown tiebreaker %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("tiebreaker %q is listed twice", name)
+		}
+		seen[name] = true
+		chain = append(chain, name)
+	}
+	return chain, nil
+}
+
+// tiebreakContext holds what tiebreakers need beyond a single standing: every match of the
+// stage, the full table (for opponents' points) and a fixed random draw.
+type tiebreakContext struct {
+	results []matchResult
+	points  pointsSystem
+	table   map[string]standing
+	random  map[string]float64
+}
+
+func newTiebreakContext(table []standing, results []matchResult, points pointsSystem, rngSeed int64) *tiebreakContext {
+	ctx := &tiebreakContext{
+		results: results,
+		points:  points,
+		table:   make(map[string]standing, len(table)),
+		random:  make(map[string]float64, len(table)),
+	}
+	keys := make([]string, 0, len(table))
+	for _, s := range table {
+		ctx.table[s.Entrant.Key()] = s
+		keys = append(keys, s.Entrant.Key())
+	}
+	// the random draw depends only on the seed and who is in the table, so it never changes
+	sort.Strings(keys)
+	rng := rand.New(rand.NewSource(rngSeed))
+	for _, k := range keys {
+		ctx.random[k] = rng.Float64()
+	}
+	return ctx
+}
+
+// values scores each entrant of a tied block on one criterion; higher ranks first.
+func (c *tiebreakContext) values(name string, block []standing) map[string]float64 {
+	vals := make(map[string]float64, len(block))
+	switch name {
+	case rankByPoints:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = float64(s.Points)
+		}
+	case TiebreakHeadToHead:
+		// a mini-table of the matches played between the tied entrants only
+		inBlock := make(map[string]bool, len(block))
+		for _, s := range block {
+			inBlock[s.Entrant.Key()] = true
+			vals[s.Entrant.Key()] = 0
+		}
+		for _, m := range c.results {
+			if !m.Completed {
+				continue
+			}
+			count := 0
+			for _, e := range m.Entrants {
+				if inBlock[e.Key()] {
+					count++
+				}
+			}
+			if count < 2 {
+				continue
+			}
+			draw := m.IsDraw()
+			for i, e := range m.Entrants {
+				if !inBlock[e.Key()] {
+					continue
+				}
+				switch {
+				case draw:
+					vals[e.Key()] += float64(c.points.Draw)
+				case m.IsWinner[i]:
+					vals[e.Key()] += float64(c.points.Win)
+				default:
+					vals[e.Key()] += float64(c.points.Lost(m))
+				}
+			}
+		}
+	case TiebreakScoreDiff:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = float64(s.ScoreFor - s.ScoreAgainst)
+		}
+	case TiebreakScoreFor:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = float64(s.ScoreFor)
+		}
+	case TiebreakWins:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = float64(s.Won)
+		}
+	case TiebreakBuchholz, TiebreakSonnebornBerger:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = c.opponentScore(s.Entrant, name == TiebreakSonnebornBerger)
+		}
+	case TiebreakRandom:
+		for _, s := range block {
+			vals[s.Entrant.Key()] = c.random[s.Entrant.Key()]
+		}
+	}
+	return vals
+}
+
+// opponentScore sums the points of every opponent faced (Buchholz). For Sonneborn-Berger only
+// beaten opponents count in full and drawn opponents count half.
+func (c *tiebreakContext) opponentScore(e entrant, sonnebornBerger bool) float64 {
+	total := 0.0
+	for _, m := range c.results {
+		if !m.Completed || len(m.Entrants) < 2 {
+			continue
+		}
+		self := -1
+		for i, o := range m.Entrants {
+			if o.Key() == e.Key() {
+				self = i
+			}
+		}
+		if self < 0 {
+			continue
+		}
+		draw := m.IsDraw()
+		for i, o := range m.Entrants {
+			if i == self {
+				continue
+			}
+			pts := float64(c.table[o.Key()].Points)
+			switch {
+			case !sonnebornBerger:
+				total += pts
+			case draw:
+				total += pts / 2
+			case m.IsWinner[self] && !m.IsWinner[i]:
+				total += pts
+			}
+		}
+	}
+	return total
+}
+
+// order sorts a block of entrants on the first criterion of the chain and resolves every group
+// still level with the rest of the chain, recording which criterion split neighbours.
+func (c *tiebreakContext) order(block []standing, chain []string) []standing {
+	if len(block) < 2 || len(chain) == 0 {
+		return block
+	}
+	name := chain[0]
+	vals := c.values(name, block)
+	sort.SliceStable(block, func(i, j int) bool {
+		return vals[block[i].Entrant.Key()] > vals[block[j].Entrant.Key()]
+	})
+
+	out := make([]standing, 0, len(block))
+	for i := 0; i < len(block); {
+		j := i + 1
+		for j < len(block) && vals[block[j].Entrant.Key()] == vals[block[i].Entrant.Key()] {
+			j++
+		}
+		sub := c.order(block[i:j], chain[1:])
+		if i > 0 {
+			sub[0].SeparatedBy = name
+		}
+		out = append(out, sub...)
+		i = j
+	}
+	return out
+}
+
+// rankStandings orders a table by points and then by the stage's tiebreaker chain. rngSeed
+// fixes the outcome of the random tiebreaker.
+func rankStandings(table []standing, results []matchResult, rules rankingRules, rngSeed int64) []standing {
+	ranked := make([]standing, len(table))
+	copy(ranked, table)
+	for i := range ranked {
+		ranked[i].SeparatedBy = ""
+	}
+	ctx := newTiebreakContext(ranked, results, rules.Points, rngSeed)
+	chain := append([]string{rankByPoints}, rules.Tiebreakers...)
+	return ctx.order(ranked, chain)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Drodrl/competition-engine/engine"
+)
+
+// loadKnockoutResults reads the results of an elimination stage with the legs of every
+// two-legged tie folded into a single result for the tie, see engine.FoldTies.
+func loadKnockoutResults(q queryer, stageID int) ([]matchResult, error) {
+	results, err := loadStageResults(q, stageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range results {
+		if m.Leg > 0 {
+			awayGoals, err := stageAwayGoals(q, stageID)
+			if err != nil {
+				return nil, err
+			}
+			return engine.FoldTies(results, awayGoals), nil
+		}
+	}
+	return results, nil
+}
+
+// stageAwayGoals reports whether away goals settle the two-legged ties of a stage that are level
+// on aggregate.
+func stageAwayGoals(q queryer, stageID int) (bool, error) {
+	var awayGoals bool
+	if err := q.QueryRow(`SELECT COALESCE(away_goals, false) FROM competition_stages WHERE stage_id = $1`, stageID).Scan(&awayGoals); err != nil {
+		return false, fmt.Errorf("failed to get away goals setting: %w", err)
+	}
+	return awayGoals, nil
+}
+
+// linkLeg marks a match as a leg of the tie whose first leg is firstLeg.
+func linkLeg(tx *sql.Tx, matchID, leg, firstLeg int) error {
+	if _, err := tx.Exec(`UPDATE matches SET leg = $1, first_leg_id = $2 WHERE match_id = $3`, leg, firstLeg, matchID); err != nil {
+		return fmt.Errorf("failed to link leg: %w", err)
+	}
+	return nil
+}
+
+// decideTie keeps the decider of a tie in line with its two legs once one of them has been
+// completed or corrected: a decider is added when both legs are played and leave the tie level,
+// and one not played yet is removed when a corrected leg settles the tie after all. A decider
+// that has already been played cannot be taken back. The decider is played in the same round,
+// without sides.
+func decideTie(tx *sql.Tx, matchID int) error {
+	var stageID, roundID, leg, firstLeg int
+	if err := tx.QueryRow(`
+        SELECT r.stage_id, m.round_id, COALESCE(m.leg, 0), COALESCE(m.first_leg_id, 0)
+        FROM matches m
+        JOIN rounds r ON m.round_id = r.round_id
+        WHERE m.match_id = $1
+    `, matchID).Scan(&stageID, &roundID, &leg, &firstLeg); err != nil {
+		return fmt.Errorf("failed to load match leg: %w", err)
+	}
+	if leg != engine.FirstLeg && leg != engine.SecondLeg {
+		return nil
+	}
+
+	results, err := loadStageResults(tx, stageID)
+	if err != nil {
+		return err
+	}
+	var legs []matchResult
+	var decider *matchResult
+	for i, m := range results {
+		switch {
+		case m.Leg == engine.Decider && m.FirstLeg == firstLeg:
+			decider = &results[i]
+		case m.Leg > 0 && m.FirstLeg == firstLeg:
+			legs = append(legs, m)
+		}
+	}
+	awayGoals, err := stageAwayGoals(tx, stageID)
+	if err != nil {
+		return err
+	}
+	level := engine.NeedsDecider(legs, awayGoals)
+	switch {
+	case level && decider == nil:
+		deciderID, err := insertMatch(tx, roundID, legs[0].Entrants, nil)
+		if err != nil {
+			return err
+		}
+		return linkLeg(tx, deciderID, engine.Decider, firstLeg)
+	case !level && decider != nil && decider.Completed:
+		return resultError(CodeResultLocked, "the decider of the tie of match %d has already been played", matchID)
+	case !level && decider != nil:
+		if _, err := tx.Exec(`DELETE FROM match_participants WHERE match_id = $1`, decider.MatchID); err != nil {
+			return fmt.Errorf("failed to remove decider participants: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM matches WHERE match_id = $1`, decider.MatchID); err != nil {
+			return fmt.Errorf("failed to remove decider: %w", err)
+		}
+	}
+	return nil
+}
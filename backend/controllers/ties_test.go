@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// tieLegs returns the stage results of the tie opened by match 10 between users 5 and 6, with
+// both legs played and scored as given.
+func tieLegs(first, second [2]int) *sqlmock.Rows {
+	return resultRows().
+		AddRow(10, "", 1, true, 5, nil, false, first[0], "played", nil, nil, 1, 10, "away").
+		AddRow(10, "", 1, true, 6, nil, false, first[1], "played", nil, nil, 1, 10, "home").
+		AddRow(11, "", 1, true, 5, nil, false, second[0], "played", nil, nil, 2, 10, "home").
+		AddRow(11, "", 1, true, 6, nil, false, second[1], "played", nil, nil, 2, 10, "away")
+}
+
+// expectTieLegs expects the leg lookup, stage results and away goals setting read by decideTie
+// for the second leg, match 11, of the tie opened by match 10.
+func expectTieLegs(mock sqlmock.Sqlmock, legs *sqlmock.Rows, awayGoals bool) {
+	mock.ExpectQuery(`SELECT r.stage_id, m.round_id, COALESCE\(m.leg, 0\)`).
+		WithArgs(11).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_id", "leg", "first_leg_id"}).AddRow(1, 4, 2, 10))
+	mock.ExpectQuery(`SELECT m.match_id, COALESCE\(r.bracket, ''\)`).
+		WithArgs(1).
+		WillReturnRows(legs)
+	mock.ExpectQuery(`SELECT COALESCE\(away_goals, false\)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(awayGoals))
+}
+
+func TestDecideTie_LevelAggregateAddsDecider(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectTieLegs(mock, tieLegs([2]int{1, 1}, [2]int{1, 1}), true)
+	mock.ExpectQuery(`INSERT INTO matches`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(12))
+	mock.ExpectExec(`INSERT INTO match_participants`).
+		WithArgs(12, 5, nil, nil, 6, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE matches SET leg = \$1, first_leg_id = \$2`).
+		WithArgs(3, 10, 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decideTie(tx, 11); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDecideTie_AwayGoalsSettleTie(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// 2-1 away and 0-1 at home: 2-2 on aggregate, user 5 through on away goals.
+	mock.ExpectBegin()
+	expectTieLegs(mock, tieLegs([2]int{2, 1}, [2]int{0, 1}), true)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decideTie(tx, 11); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDecideTie_SettledTieRemovesUnplayedDecider(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	// The second leg was corrected to 2-1, which takes user 5 through 3-2 on aggregate.
+	mock.ExpectBegin()
+	expectTieLegs(mock, tieLegs([2]int{1, 1}, [2]int{2, 1}).
+		AddRow(12, "", 1, false, 5, nil, false, nil, "played", nil, nil, 3, 10, nil).
+		AddRow(12, "", 1, false, 6, nil, false, nil, "played", nil, nil, 3, 10, nil), false)
+	mock.ExpectExec(`DELETE FROM match_participants WHERE match_id = \$1`).
+		WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM matches WHERE match_id = \$1`).
+		WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decideTie(tx, 11); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDecideTie_PlayedDeciderCannotBeUndone(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectTieLegs(mock, tieLegs([2]int{1, 1}, [2]int{2, 1}).
+		AddRow(12, "", 1, true, 5, nil, false, 0, "played", nil, nil, 3, 10, nil).
+		AddRow(12, "", 1, true, 6, nil, true, 1, "played", nil, nil, 3, 10, nil), false)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resErr *ResultError
+	if err := decideTie(tx, 11); !errors.As(err, &resErr) || resErr.Code != CodeResultLocked {
+		t.Errorf("expected result_locked, got: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
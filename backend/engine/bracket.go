@@ -0,0 +1,105 @@
+package engine
+
+import "fmt"
+
+// SingleElimBracket plans every round of a single elimination stage at once from its entrants
+// in seed/draw order. The first round is the one SingleElimNextRound would draw; every later
+// match holds slots for the winners of the two matches feeding it, except that a bye's entrant
+// is placed straight into its next match. With thirdPlace set, the final comes with a third
+// place match for the semifinal losers unless a semifinal is a bye.
+func SingleElimBracket(entrants []Entrant, thirdPlace bool) ([]Round, error) {
+	if len(entrants) < 2 {
+		return nil, fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+	}
+	rounds := []Round{{Number: 1, Bracket: NoBracket, Matches: firstRoundWithByes(entrants)}}
+	for last := 0; len(rounds[last].Matches) > 1; last++ {
+		rounds = append(rounds, Round{Number: last + 2, Bracket: NoBracket, Matches: advanceWinners(rounds, last)})
+	}
+
+	semis := len(rounds) - 2
+	if thirdPlace && semis >= 0 {
+		for _, m := range rounds[semis].Matches {
+			if m.IsBye() {
+				return rounds, nil
+			}
+		}
+		third := Match{Slots: []Slot{{Round: semis, Match: 0, Loser: true}, {Round: semis, Match: 1, Loser: true}}}
+		rounds = append(rounds, Round{Number: semis + 2, Bracket: ThirdPlace, Matches: []Match{third}})
+	}
+	return rounds, nil
+}
+
+// DoubleElimBracket plans every round of a double elimination stage at once from its entrants
+// in seed/draw order, which must be a power of two. The winners bracket is planned first. In
+// the losers bracket the losers of the first winners round meet each other, and every later
+// winners round drops its losers into a round against the losers bracket survivors, which then
+// play each other down to the next drop. The two bracket winners meet in the grand final; a
+// reset is not planned, as it is only played if the losers bracket winner takes the grand final.
+func DoubleElimBracket(entrants []Entrant) ([]Round, error) {
+	n := len(entrants)
+	if n < 2 {
+		return nil, fmt.Errorf("expected at least 2 participants, got %d", n)
+	}
+	if n != NextPowerOfTwo(n) {
+		return nil, fmt.Errorf("a full double elimination bracket needs a power of two participants, got %d", n)
+	}
+
+	rounds := []Round{{Number: 1, Bracket: Winners, Matches: pairUp(doubleElimFirstRound(entrants))}}
+	for last := 0; len(rounds[last].Matches) > 1; last++ {
+		rounds = append(rounds, Round{Number: last + 2, Bracket: Winners, Matches: advanceWinners(rounds, last)})
+	}
+	winnersRounds := len(rounds)
+
+	// With two entrants the loser of the only winners match goes straight to the grand final.
+	losersWinner := Slot{Round: 0, Match: 0, Loser: true}
+	if winnersRounds > 1 {
+		var first []Match
+		for i := 0; i+1 < len(rounds[0].Matches); i += 2 {
+			first = append(first, Match{Slots: []Slot{{Round: 0, Match: i, Loser: true}, {Round: 0, Match: i + 1, Loser: true}}})
+		}
+		rounds = append(rounds, Round{Number: 1, Bracket: Losers, Matches: first})
+
+		for w := 1; w < winnersRounds; w++ {
+			// Drops are mirrored every other round so that entrants who met in the winners
+			// bracket do not meet again straight away.
+			survivors := len(rounds) - 1
+			drops := len(rounds[w].Matches)
+			major := make([]Match, drops)
+			for j := range major {
+				from := j
+				if w%2 == 1 {
+					from = drops - 1 - j
+				}
+				major[j] = Match{Slots: []Slot{{Round: survivors, Match: j}, {Round: w, Match: from, Loser: true}}}
+			}
+			rounds = append(rounds, Round{Number: rounds[survivors].Number + 1, Bracket: Losers, Matches: major})
+			if w < winnersRounds-1 {
+				last := len(rounds) - 1
+				rounds = append(rounds, Round{Number: rounds[last].Number + 1, Bracket: Losers, Matches: advanceWinners(rounds, last)})
+			}
+		}
+		losersWinner = Slot{Round: len(rounds) - 1, Match: 0}
+	}
+
+	final := Match{Slots: []Slot{{Round: winnersRounds - 1, Match: 0}, losersWinner}}
+	return append(rounds, Round{Number: 1, Bracket: GrandFinal, Matches: []Match{final}}), nil
+}
+
+// advanceWinners plans the round after the given round of a plan, pairing the winners of its
+// matches in order.
+func advanceWinners(rounds []Round, round int) []Match {
+	feeders := rounds[round].Matches
+	matches := make([]Match, 0, len(feeders)/2)
+	for i := 0; i+1 < len(feeders); i += 2 {
+		var m Match
+		for _, j := range []int{i, i + 1} {
+			if feeders[j].IsBye() {
+				m.Entrants = append(m.Entrants, feeders[j].Entrants[0])
+			} else {
+				m.Slots = append(m.Slots, Slot{Round: round, Match: j})
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSingleElimBracket_ByesGoStraightThrough(t *testing.T) {
+	rounds, err := SingleElimBracket(userEntrants(1, 2, 3, 4, 5), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 4 {
+		t.Fatalf("expected three rounds and a third place match, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1}, {4, 5}, {2}, {3}}) {
+		t.Errorf("unexpected first round: %v", got)
+	}
+	// 1 waits for the winner of 4 v 5; 2 and 3 both had byes and meet at once
+	semis := rounds[1].Matches
+	if got := matchIDs(rounds[1]); !reflect.DeepEqual(got, [][]int{{1}, {2, 3}}) {
+		t.Errorf("unexpected semifinal entrants: %v", got)
+	}
+	if !reflect.DeepEqual(semis[0].Slots, []Slot{{Round: 0, Match: 1}}) || len(semis[1].Slots) != 0 {
+		t.Errorf("unexpected semifinal slots: %+v", semis)
+	}
+	if final := rounds[2].Matches[0]; !reflect.DeepEqual(final.Slots, []Slot{{Round: 1, Match: 0}, {Round: 1, Match: 1}}) {
+		t.Errorf("unexpected final slots: %+v", final.Slots)
+	}
+	third := rounds[3]
+	if third.Bracket != ThirdPlace || third.Number != 3 ||
+		!reflect.DeepEqual(third.Matches[0].Slots, []Slot{{Round: 1, Match: 0, Loser: true}, {Round: 1, Match: 1, Loser: true}}) {
+		t.Errorf("unexpected third place match: %+v", third)
+	}
+}
+
+func TestSingleElimBracket_NoThirdPlaceAfterByeSemifinal(t *testing.T) {
+	rounds, err := SingleElimBracket(userEntrants(1, 2, 3), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 2 || rounds[1].Bracket != NoBracket {
+		t.Fatalf("expected only the first round and the final, got %+v", rounds)
+	}
+}
+
+func TestDoubleElimBracket_EightEntrants(t *testing.T) {
+	rounds, err := DoubleElimBracket(userEntrants(1, 2, 3, 4, 5, 6, 7, 8))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	type shape struct {
+		Bracket string
+		Number  int
+		Matches int
+	}
+	var got []shape
+	for _, r := range rounds {
+		got = append(got, shape{r.Bracket, r.Number, len(r.Matches)})
+	}
+	want := []shape{
+		{Winners, 1, 4}, {Winners, 2, 2}, {Winners, 3, 1},
+		{Losers, 1, 2}, {Losers, 2, 2}, {Losers, 3, 1}, {Losers, 4, 1},
+		{GrandFinal, 1, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected bracket shape:\n got %v\nwant %v", got, want)
+	}
+	// the losers of the second winners round drop in mirrored
+	if s := rounds[4].Matches[0].Slots; !reflect.DeepEqual(s, []Slot{{Round: 3, Match: 0}, {Round: 1, Match: 1, Loser: true}}) {
+		t.Errorf("unexpected drop into losers round 2: %+v", s)
+	}
+	// the winners final loser meets the losers bracket survivor
+	if s := rounds[6].Matches[0].Slots; !reflect.DeepEqual(s, []Slot{{Round: 5, Match: 0}, {Round: 2, Match: 0, Loser: true}}) {
+		t.Errorf("unexpected losers final: %+v", s)
+	}
+	if s := rounds[7].Matches[0].Slots; !reflect.DeepEqual(s, []Slot{{Round: 2, Match: 0}, {Round: 6, Match: 0}}) {
+		t.Errorf("unexpected grand final: %+v", s)
+	}
+}
+
+func TestDoubleElimBracket_TwoEntrants(t *testing.T) {
+	rounds, err := DoubleElimBracket(userEntrants(1, 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 2 || rounds[1].Bracket != GrandFinal {
+		t.Fatalf("expected a winners round and the grand final, got %+v", rounds)
+	}
+	if s := rounds[1].Matches[0].Slots; !reflect.DeepEqual(s, []Slot{{Round: 0, Match: 0}, {Round: 0, Match: 0, Loser: true}}) {
+		t.Errorf("unexpected grand final: %+v", s)
+	}
+}
+
+func TestDoubleElimBracket_NeedsPowerOfTwo(t *testing.T) {
+	if _, err := DoubleElimBracket(userEntrants(1, 2, 3, 4, 5, 6)); err == nil {
+		t.Error("expected an error for six entrants")
+	}
+}
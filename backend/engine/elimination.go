@@ -0,0 +1,261 @@
+package engine
+
+import "fmt"
+
+// SingleElimNextRound plans the next round of a single elimination stage from its entrants (in
+// seed/draw order) and the results so far, in match order. The first round is padded to a full
+// bracket with byes for the top seeds; later rounds pair the winners of neighbouring matches of
+// the previous round, so each bye winner meets the winner of the neighbouring first-round match.
+// A match that sent nobody on, such as a double forfeit, leaves its neighbour's winner with a
+// bye. With thirdPlace set, the final comes with a third place match between the two semifinal
+// losers.
+func SingleElimNextRound(entrants []Entrant, results []Result, thirdPlace bool) ([]Round, error) {
+	last := lastRound(results, NoBracket)
+	if last == 0 {
+		if len(entrants) < 2 {
+			return nil, fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+		}
+		return []Round{{Number: 1, Bracket: NoBracket, Matches: firstRoundWithByes(entrants)}}, nil
+	}
+
+	previous := inRound(results, NoBracket, last)
+	var winners, losers []Entrant
+	for _, m := range previous {
+		winners = append(winners, m.Winners()...)
+		losers = append(losers, m.Losers()...)
+	}
+	switch {
+	case len(winners) == 0:
+		return nil, fmt.Errorf("no winners recorded in round %d", last)
+	case len(previous) == 1:
+		return nil, fmt.Errorf("single elimination stage is already complete")
+	case len(previous)%2 != 0:
+		return nil, fmt.Errorf("expected an even number of matches in round %d, got %d", last, len(previous))
+	}
+
+	var matches []Match
+	for i := 0; i < len(previous); i += 2 {
+		next := append(previous[i].Winners(), previous[i+1].Winners()...)
+		switch len(next) {
+		case 2:
+			matches = append(matches, pair(next[0], next[1]))
+		case 1:
+			matches = append(matches, bye(next[0]))
+		}
+	}
+	rounds := []Round{{Number: last + 1, Bracket: NoBracket, Matches: matches}}
+	// A semifinal decided by a bye has no loser, in which case no third place match is played.
+	if len(previous) == 2 && thirdPlace && len(losers) == 2 {
+		rounds = append(rounds, Round{Number: last + 1, Bracket: ThirdPlace, Matches: []Match{pair(losers[0], losers[1])}})
+	}
+	return rounds, nil
+}
+
+// DoubleElimNextRound plans the next rounds of a double elimination stage from its entrants (in
+// seed/draw order) and the results so far, in match order. Each call advances the winners and
+// the losers bracket by one round. The losers of each winners round drop into the losers
+// bracket once, against as many losers bracket survivors; while the survivors outnumber them,
+// the survivors play each other first. Once both brackets are down to one entrant they meet in
+// the grand final, which is followed by a reset if the losers bracket entrant wins it.
+func DoubleElimNextRound(entrants []Entrant, results []Result) ([]Round, error) {
+	lastWinners := lastRound(results, Winners)
+	if lastWinners == 0 {
+		if len(entrants) < 2 {
+			return nil, fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+		}
+		if len(entrants) != NextPowerOfTwo(len(entrants)) {
+			return nil, fmt.Errorf("a double elimination stage needs a power of two participants, got %d", len(entrants))
+		}
+		return []Round{{Number: 1, Bracket: Winners, Matches: pairUp(doubleElimFirstRound(entrants))}}, nil
+	}
+	// Once the grand final exists both brackets are done; all that can follow is a reset.
+	if lastGrandFinal := lastRound(results, GrandFinal); lastGrandFinal > 0 {
+		return grandFinalReset(results, lastGrandFinal)
+	}
+
+	previous := inRound(results, Winners, lastWinners)
+	var winners []Entrant
+	for _, m := range previous {
+		winners = append(winners, m.Winners()...)
+	}
+	dropping, survivors := losersBracketPool(results)
+	winnersDone := len(previous) == 1
+
+	if winnersDone && len(winners) == 1 && len(dropping)+len(survivors) == 1 {
+		final := append(survivors, dropping...)
+		return []Round{{Number: 1, Bracket: GrandFinal, Matches: []Match{pair(winners[0], final[0])}}}, nil
+	}
+
+	var rounds []Round
+	if !winnersDone {
+		if len(winners)%2 != 0 {
+			return nil, fmt.Errorf("expected even participants in winners bracket, got %d", len(winners))
+		}
+		rounds = append(rounds, Round{Number: lastWinners + 1, Bracket: Winners, Matches: pairUp(winners)})
+	}
+
+	var matches []Match
+	switch {
+	case len(survivors) == 0 && len(dropping)%2 == 0:
+		matches = pairUp(dropping)
+	case len(survivors) > len(dropping) && len(survivors)%2 == 0:
+		matches = pairUp(survivors)
+	case len(survivors) == len(dropping):
+		for i := range survivors {
+			matches = append(matches, pair(survivors[i], dropping[i]))
+		}
+	default:
+		return nil, fmt.Errorf("cannot pair the losers bracket: %d survivors against %d dropping from the winners bracket", len(survivors), len(dropping))
+	}
+	if len(matches) > 0 {
+		rounds = append(rounds, Round{Number: lastRound(results, Losers) + 1, Bracket: Losers, Matches: matches})
+	}
+	return rounds, nil
+}
+
+// losersBracketPool returns the entrants due in the next losers bracket round: the losers of the
+// earliest winners round who have not dropped into the losers bracket yet, and the winners of the
+// last losers round.
+func losersBracketPool(results []Result) (dropping, survivors []Entrant) {
+	dropped := make(map[string]bool)
+	for _, m := range results {
+		if m.Bracket == Losers {
+			for _, e := range m.Entrants {
+				dropped[e.Key()] = true
+			}
+		}
+	}
+	for round := 1; round <= lastRound(results, Winners) && len(dropping) == 0; round++ {
+		for _, m := range inRound(results, Winners, round) {
+			for _, e := range m.Losers() {
+				if !dropped[e.Key()] {
+					dropping = append(dropping, e)
+				}
+			}
+		}
+	}
+	if last := lastRound(results, Losers); last > 0 {
+		for _, m := range inRound(results, Losers, last) {
+			survivors = append(survivors, m.Winners()...)
+		}
+	}
+	return dropping, survivors
+}
+
+// grandFinalReset plans the second grand final match, played only when the entrant coming from
+// the losers bracket won the first one: until then the winners bracket champion had not lost.
+func grandFinalReset(results []Result, lastGrandFinal int) ([]Round, error) {
+	if lastGrandFinal >= 2 {
+		return nil, fmt.Errorf("double elimination stage is already complete")
+	}
+
+	var finalists []Entrant
+	var champion *Entrant
+	decided := true
+	for _, m := range inRound(results, GrandFinal, 1) {
+		for i, e := range m.Entrants {
+			finalists = append(finalists, e)
+			if m.IsWinner[i] {
+				champion = &m.Entrants[i]
+			}
+		}
+		decided = decided && m.Completed
+	}
+	if len(finalists) != 2 {
+		return nil, fmt.Errorf("expected 2 grand finalists, got %d", len(finalists))
+	}
+	if !decided || champion == nil {
+		return nil, fmt.Errorf("the grand final has not been decided yet")
+	}
+
+	winnersChampion, ok := WinnersChampion(results)
+	if !ok {
+		return nil, fmt.Errorf("no winners bracket champion recorded")
+	}
+	if champion.Key() == winnersChampion.Key() {
+		return nil, fmt.Errorf("double elimination stage is already complete")
+	}
+	return []Round{{Number: 2, Bracket: GrandFinal, Matches: []Match{pair(finalists[0], finalists[1])}}}, nil
+}
+
+// WinnersChampion returns the entrant who won the last match of the winners bracket.
+func WinnersChampion(results []Result) (Entrant, bool) {
+	var champion Entrant
+	best, bestMatch, found := 0, 0, false
+	for _, m := range results {
+		if m.Bracket != Winners {
+			continue
+		}
+		for _, e := range m.Winners() {
+			if !found || m.Round > best || (m.Round == best && m.MatchID > bestMatch) {
+				champion, best, bestMatch, found = e, m.Round, m.MatchID, true
+			}
+		}
+	}
+	return champion, found
+}
+
+// pairUp pairs entrants in order, first with second, third with fourth and so on. An odd entrant
+// out is left without a match.
+func pairUp(entrants []Entrant) []Match {
+	matches := make([]Match, 0, len(entrants)/2)
+	for i := 0; i+1 < len(entrants); i += 2 {
+		matches = append(matches, pair(entrants[i], entrants[i+1]))
+	}
+	return matches
+}
+
+// BracketOrder returns the seed numbers (1-based) in bracket slot order for a bracket of the
+// given power-of-two size, e.g. [1 8 4 5 2 7 3 6] for 8, so that seeds 1 and 2 can only meet in the final.
+func BracketOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		n := len(order)*2 + 1
+		for _, s := range order {
+			next = append(next, s, n-s)
+		}
+		order = next
+	}
+	return order
+}
+
+// NextPowerOfTwo returns the smallest power of two that is >= n.
+func NextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+// firstRoundWithByes pads entrants (in seed order) to the next power of two and places them in
+// bracket order. Slots without an opponent become byes, which always fall to the top seeds.
+func firstRoundWithByes(entrants []Entrant) []Match {
+	n := len(entrants)
+	order := BracketOrder(NextPowerOfTwo(n))
+	matches := make([]Match, 0, len(order)/2)
+	for i := 0; i < len(order); i += 2 {
+		a, b := order[i], order[i+1]
+		if a > b {
+			a, b = b, a
+		}
+		if b <= n {
+			matches = append(matches, pair(entrants[a-1], entrants[b-1]))
+		} else {
+			matches = append(matches, bye(entrants[a-1]))
+		}
+	}
+	return matches
+}
+
+// doubleElimFirstRound orders entrants, a power of two of them, so that consecutive pairs form
+// the first winners round, with seeded placement so that the top two can only meet in the
+// winners final.
+func doubleElimFirstRound(entrants []Entrant) []Entrant {
+	seeded := make([]Entrant, 0, len(entrants))
+	for _, m := range firstRoundWithByes(entrants) {
+		seeded = append(seeded, m.Entrants...)
+	}
+	return seeded
+}
@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// played is a completed match between the given users, won by winner.
+func played(matchID int, bracket string, round int, winner int, userIDs ...int) Result {
+	m := Result{MatchID: matchID, Bracket: bracket, Round: round, Completed: true}
+	for _, e := range userEntrants(userIDs...) {
+		m.Entrants = append(m.Entrants, e)
+		m.IsWinner = append(m.IsWinner, *e.UserID == winner)
+	}
+	return m
+}
+
+// matchIDs lists the user ids of every match of a round, byes included.
+func matchIDs(round Round) [][]int {
+	var ids [][]int
+	for _, m := range round.Matches {
+		var match []int
+		for _, e := range m.Entrants {
+			match = append(match, *e.UserID)
+		}
+		ids = append(ids, match)
+	}
+	return ids
+}
+
+func TestFirstRoundWithByes_TwelveEntrants(t *testing.T) {
+	ids := make([]int, 12)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	matches := firstRoundWithByes(userEntrants(ids...))
+	if len(matches) != 8 {
+		t.Fatalf("expected 8 first-round slots, got %d", len(matches))
+	}
+	byes := map[int]bool{}
+	for _, m := range matches {
+		if m.IsBye() {
+			byes[*m.Entrants[0].UserID] = true
+		}
+	}
+	for seed := 1; seed <= 4; seed++ {
+		if !byes[seed] {
+			t.Errorf("expected seed %d to get a bye, byes: %v", seed, byes)
+		}
+	}
+	if len(byes) != 4 {
+		t.Errorf("expected 4 byes, got %d", len(byes))
+	}
+}
+
+func TestBracketOrder(t *testing.T) {
+	got := BracketOrder(8)
+	want := []int{1, 8, 4, 5, 2, 7, 3, 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BracketOrder(8) = %v, want %v", got, want)
+	}
+}
+
+func TestSingleElimNextRound_FirstRound(t *testing.T) {
+	rounds, err := SingleElimNextRound(userEntrants(1, 2, 3), nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 1 || rounds[0].Number != 1 || rounds[0].Bracket != NoBracket {
+		t.Fatalf("expected a single first round, got %+v", rounds)
+	}
+	// Top seed gets the bye
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1}, {2, 3}}) {
+		t.Errorf("unexpected first round: %v", got)
+	}
+}
+
+func TestSingleElimNextRound_ByeWinnerMeetsNeighbour(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1),
+		played(2, NoBracket, 1, 3, 2, 3),
+	}
+	rounds, err := SingleElimNextRound(nil, results, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the semifinal bye leaves no loser for a third place match
+	if len(rounds) != 1 || rounds[0].Number != 2 {
+		t.Fatalf("expected only the final, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1, 3}}) {
+		t.Errorf("unexpected final: %v", got)
+	}
+}
+
+func TestSingleElimNextRound_FinalWithThirdPlace(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1, 4),
+		played(2, NoBracket, 1, 2, 2, 3),
+	}
+	rounds, err := SingleElimNextRound(nil, results, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 2 {
+		t.Fatalf("expected the final and a third place match, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); rounds[0].Bracket != NoBracket || !reflect.DeepEqual(got, [][]int{{1, 2}}) {
+		t.Errorf("unexpected final: %+v", rounds[0])
+	}
+	if got := matchIDs(rounds[1]); rounds[1].Bracket != ThirdPlace || rounds[1].Number != 2 || !reflect.DeepEqual(got, [][]int{{4, 3}}) {
+		t.Errorf("unexpected third place match: %+v", rounds[1])
+	}
+}
+
+func TestSingleElimNextRound_AlreadyComplete(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1, 2),
+	}
+	_, err := SingleElimNextRound(nil, results, false)
+	if err == nil || err.Error() != "single elimination stage is already complete" {
+		t.Errorf("expected complete stage error, got: %v", err)
+	}
+}
+
+func TestDoubleElimNextRound_FirstRoundIsSeeded(t *testing.T) {
+	rounds, err := DoubleElimNextRound(userEntrants(1, 2, 3, 4), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 1 || rounds[0].Bracket != Winners || rounds[0].Number != 1 {
+		t.Fatalf("expected the first winners round, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1, 4}, {2, 3}}) {
+		t.Errorf("unexpected first round: %v", got)
+	}
+}
+
+func TestDoubleElimNextRound_BothBrackets(t *testing.T) {
+	results := []Result{
+		played(1, Winners, 1, 1, 1, 4),
+		played(2, Winners, 1, 2, 2, 3),
+	}
+	rounds, err := DoubleElimNextRound(nil, results)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 2 {
+		t.Fatalf("expected a winners and a losers round, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); rounds[0].Bracket != Winners || rounds[0].Number != 2 || !reflect.DeepEqual(got, [][]int{{1, 2}}) {
+		t.Errorf("unexpected winners round: %+v", rounds[0])
+	}
+	if got := matchIDs(rounds[1]); rounds[1].Bracket != Losers || rounds[1].Number != 1 || !reflect.DeepEqual(got, [][]int{{4, 3}}) {
+		t.Errorf("unexpected losers round: %+v", rounds[1])
+	}
+}
+
+func TestDoubleElimNextRound_GrandFinal(t *testing.T) {
+	results := []Result{
+		played(1, Winners, 1, 1, 1, 2),
+	}
+	rounds, err := DoubleElimNextRound(nil, results)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rounds) != 1 || rounds[0].Bracket != GrandFinal || rounds[0].Number != 1 {
+		t.Fatalf("expected the grand final, got %+v", rounds)
+	}
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1, 2}}) {
+		t.Errorf("unexpected grand final: %v", got)
+	}
+}
+
+// playDoubleElim plays a double elimination stage of n entrants through DoubleElimNextRound
+// until it reports the stage complete. The lower user id wins every match, except the first
+// grand final, which the losers bracket entrant wins when resetGrandFinal is set.
+func playDoubleElim(t *testing.T, n int, resetGrandFinal bool) []Result {
+	t.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	entrants := userEntrants(ids...)
+	var results []Result
+	for call := 0; ; call++ {
+		if call > 4*n {
+			t.Fatalf("%d entrants: no end after %d calls", n, call)
+		}
+		rounds, err := DoubleElimNextRound(entrants, results)
+		if err != nil {
+			if err.Error() != "double elimination stage is already complete" {
+				t.Fatalf("%d entrants: %v", n, err)
+			}
+			return results
+		}
+		for _, round := range rounds {
+			for _, m := range round.Matches {
+				a, b := *m.Entrants[0].UserID, *m.Entrants[1].UserID
+				if a == b {
+					t.Fatalf("%d entrants: user %d paired with themselves in %s round %d", n, a, round.Bracket, round.Number)
+				}
+				winner := min(a, b)
+				if round.Bracket == GrandFinal && round.Number == 1 && resetGrandFinal {
+					winner = b
+				}
+				results = append(results, played(len(results)+1, round.Bracket, round.Number, winner, a, b))
+			}
+		}
+	}
+}
+
+func TestDoubleElimNextRound_PlaysThrough(t *testing.T) {
+	for _, n := range []int{2, 4, 8, 16} {
+		for _, reset := range []bool{false, true} {
+			results := playDoubleElim(t, n, reset)
+			losses := make(map[int]int)
+			for _, m := range results {
+				for _, e := range m.Losers() {
+					losses[*e.UserID]++
+				}
+			}
+			// user 1 wins the stage, losing only the first grand final when it is reset; everyone
+			// else is out after two losses
+			for id := 1; id <= n; id++ {
+				want := 2
+				if id == 1 && reset {
+					want = 1
+				} else if id == 1 {
+					want = 0
+				}
+				if losses[id] != want {
+					t.Errorf("%d entrants (reset %v): user %d lost %d matches, expected %d", n, reset, id, losses[id], want)
+				}
+			}
+			grandFinals := lastRound(results, GrandFinal)
+			if (reset && grandFinals != 2) || (!reset && grandFinals != 1) {
+				t.Errorf("%d entrants (reset %v): expected the reset only when the grand final went to the losers bracket, got %d grand finals", n, reset, grandFinals)
+			}
+		}
+	}
+}
+
+func TestDoubleElimNextRound_LosersBracket(t *testing.T) {
+	results := playDoubleElim(t, 8, false)
+	// W1 losers pair off, W2 losers meet the survivors, the survivors play down to one, and the
+	// winners final loser drops in last.
+	sizes := []int{}
+	for round := 1; round <= lastRound(results, Losers); round++ {
+		sizes = append(sizes, len(inRound(results, Losers, round)))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1, 1}) {
+		t.Errorf("unexpected losers bracket rounds: %v", sizes)
+	}
+	last := inRound(results, Losers, 4)[0]
+	if got := []int{*last.Entrants[0].UserID, *last.Entrants[1].UserID}; !reflect.DeepEqual(got, []int{3, 2}) {
+		t.Errorf("expected the winners final loser to meet the last survivor, got %v", got)
+	}
+}
+
+func TestSingleElimNextRound_DoubleForfeitGivesBye(t *testing.T) {
+	forfeited := played(2, NoBracket, 1, 0, 2, 3)
+	forfeited.Type = ResultDoubleForfeit
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1, 4),
+		forfeited,
+	}
+	if forfeited.IsDraw() {
+		t.Error("a double forfeit is not a draw")
+	}
+	rounds, err := SingleElimNextRound(nil, results, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// nobody goes on from match 2, so user 1 gets the final as a bye and there is no third place match
+	if len(rounds) != 1 || !rounds[0].Matches[0].IsBye() || *rounds[0].Matches[0].Entrants[0].UserID != 1 {
+		t.Errorf("expected a bye final for user 1, got %+v", rounds)
+	}
+}
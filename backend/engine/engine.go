@@ -0,0 +1,207 @@
+// Package engine plans the rounds of a competition stage. It works on plain values: callers pass
+// the stage's entrants and the results played so far and get back the rounds and matches to
+// create next. Nothing here touches the database, so the same planning can run in tools and
+// simulations; the controllers load its input and persist its output.
+package engine
+
+import "strconv"
+
+// Bracket names used on rounds of elimination stages. Stages without brackets use NoBracket.
+const (
+	NoBracket  = ""
+	Winners    = "W"
+	Losers     = "L"
+	GrandFinal = "G"
+	ThirdPlace = "T"
+)
+
+// Result types: how a completed match was decided. A walkover is won because the opponent did
+// not turn up, a forfeit because they conceded, and a retirement because they could not finish.
+// In a double forfeit neither entrant wins and neither goes any further in the stage.
+const (
+	ResultPlayed        = "played"
+	ResultWalkover      = "walkover"
+	ResultForfeit       = "forfeit"
+	ResultRetired       = "retired"
+	ResultDoubleForfeit = "double_forfeit"
+)
+
+// Sides of a match played at one entrant's venue.
+const (
+	Home = "home"
+	Away = "away"
+)
+
+// ValidResultType reports whether t is one of the result types.
+func ValidResultType(t string) bool {
+	switch t {
+	case ResultPlayed, ResultWalkover, ResultForfeit, ResultRetired, ResultDoubleForfeit:
+		return true
+	}
+	return false
+}
+
+// Entrant is a user or a team taking part in a stage. Seed is the entrant's seed, nil if unseeded.
+type Entrant struct {
+	UserID, TeamID *int
+	Seed           *int
+}
+
+// Key identifies an entrant regardless of whether it is a user or a team.
+func (e Entrant) Key() string {
+	if e.UserID != nil {
+		return "u" + strconv.Itoa(*e.UserID)
+	}
+	if e.TeamID != nil {
+		return "t" + strconv.Itoa(*e.TeamID)
+	}
+	return ""
+}
+
+// Result is a match already created in a stage, with its participants in a stable order.
+// Type is one of the result types; results loaded without one count as played. Matches between
+// more than two entrants, such as heats, also record each entrant's finishing place (1 is
+// first, equal places for a dead heat) and optionally a finishing time in milliseconds. Sides
+// holds each entrant's side in matches played home and away. A leg of a two-legged tie has Leg
+// set and FirstLeg pointing at the match id of the tie's first leg.
+type Result struct {
+	MatchID    int
+	Bracket    string
+	Round      int
+	Completed  bool
+	Type       string
+	Entrants   []Entrant
+	IsWinner   []bool
+	Scores     []*int
+	Placements []*int
+	Times      []*int
+	Sides      []string
+	Leg        int
+	FirstLeg   int
+}
+
+// IsDraw reports whether a completed match between two or more entrants has no winner.
+// A double forfeit is lost by both sides rather than drawn.
+func (m Result) IsDraw() bool {
+	if !m.Completed || len(m.Entrants) < 2 || m.Type == ResultDoubleForfeit {
+		return false
+	}
+	for _, w := range m.IsWinner {
+		if w {
+			return false
+		}
+	}
+	return true
+}
+
+// Winners returns the entrants who won the match.
+func (m Result) Winners() []Entrant {
+	var winners []Entrant
+	for i, e := range m.Entrants {
+		if m.IsWinner[i] {
+			winners = append(winners, e)
+		}
+	}
+	return winners
+}
+
+// Forfeited reports whether the losers of a completed match gave it up rather than lost it on
+// the field: a walkover, a forfeit or a double forfeit.
+func (m Result) Forfeited() bool {
+	return m.Completed && (m.Type == ResultWalkover || m.Type == ResultForfeit || m.Type == ResultDoubleForfeit)
+}
+
+// Losers returns the entrants of a completed match who did not win it and go on in the stage,
+// as a double elimination stage's losers bracket does. A double forfeit has none.
+func (m Result) Losers() []Entrant {
+	var losers []Entrant
+	if !m.Completed || m.Type == ResultDoubleForfeit {
+		return nil
+	}
+	for i, e := range m.Entrants {
+		if !m.IsWinner[i] {
+			losers = append(losers, e)
+		}
+	}
+	return losers
+}
+
+// Points is what a stage awards for each match outcome. Forfeit is awarded instead of Loss to
+// an entrant who gave a match up.
+type Points struct {
+	Win, Draw, Loss int
+	Forfeit         int
+}
+
+// Lost returns the points for losing a match: Forfeit if it was given up, Loss otherwise.
+func (p Points) Lost(m Result) int {
+	if m.Forfeited() {
+		return p.Forfeit
+	}
+	return p.Loss
+}
+
+// Match is a planned match. A match with a single entrant is a bye, which that entrant wins.
+// Matches planned before all their entrants are known hold a Slot for each one still to come.
+// Sides, when set, gives the side of each entrant; it is nil for matches without home and away.
+// Leg is set on the legs of a two-legged tie, which follow each other in their round.
+type Match struct {
+	Entrants []Entrant
+	Slots    []Slot
+	Sides    []string
+	Leg      int
+}
+
+// IsBye reports whether the match is a bye.
+func (m Match) IsBye() bool {
+	return len(m.Entrants) == 1 && len(m.Slots) == 0
+}
+
+// Slot is a place in a planned match taken by the winner, or with Loser set the loser, of an
+// earlier match of the same plan. Round and Match index the planned rounds and their matches.
+type Slot struct {
+	Round, Match int
+	Loser        bool
+}
+
+// Round is a planned round of a stage.
+type Round struct {
+	Number  int
+	Bracket string
+	Matches []Match
+}
+
+func pair(a, b Entrant) Match {
+	return Match{Entrants: []Entrant{a, b}}
+}
+
+// homeAway is a match between home and away, in that order.
+func homeAway(home, away Entrant) Match {
+	return Match{Entrants: []Entrant{home, away}, Sides: []string{Home, Away}}
+}
+
+func bye(e Entrant) Match {
+	return Match{Entrants: []Entrant{e}}
+}
+
+// lastRound returns the highest round number played in a bracket, 0 if there is none.
+func lastRound(results []Result, bracket string) int {
+	last := 0
+	for _, m := range results {
+		if m.Bracket == bracket && m.Round > last {
+			last = m.Round
+		}
+	}
+	return last
+}
+
+// inRound returns the results of one round of a bracket, in match order.
+func inRound(results []Result, bracket string, round int) []Result {
+	var matches []Result
+	for _, m := range results {
+		if m.Bracket == bracket && m.Round == round {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
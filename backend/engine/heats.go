@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// HeatsNextRound plans the next round of a heats stage, in which every match is a heat of up to
+// size entrants ranked by finishing place. The first round spreads the entrants (in seed/draw
+// order) over as few heats as hold them, in snake order so the top seeds meet as late as
+// possible. Later rounds take the best advance entrants of every heat of the previous round,
+// rank them across heats (all heat winners first, then the runners-up, ...) and spread them over
+// heats the same way. A round of a single heat is the final, after which the stage is complete.
+// For later rounds entrants, when given, lists who may still qualify, which callers use to pass
+// over disqualified entrants.
+func HeatsNextRound(entrants []Entrant, results []Result, size, advance int) (Round, error) {
+	if size < 2 || advance < 1 || advance >= size {
+		return Round{}, fmt.Errorf("heats of %d entrants cannot advance %d each", size, advance)
+	}
+	last := lastRound(results, NoBracket)
+	if last == 0 {
+		if len(entrants) < 2 {
+			return Round{}, fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+		}
+		return Round{Number: 1, Bracket: NoBracket, Matches: splitHeats(entrants, size)}, nil
+	}
+
+	previous := inRound(results, NoBracket, last)
+	if len(previous) == 1 {
+		return Round{}, fmt.Errorf("heats stage is already complete")
+	}
+	eligible := make(map[string]bool)
+	for _, e := range entrants {
+		eligible[e.Key()] = true
+	}
+	qualified := make(map[string]bool)
+	field := 0
+	for _, m := range previous {
+		field += len(m.Entrants)
+		taken := 0
+		for _, e := range RankHeats([]Result{m}) {
+			if taken < advance && m.Type != ResultDoubleForfeit && (entrants == nil || eligible[e.Key()]) {
+				qualified[e.Key()] = true
+				taken++
+			}
+		}
+	}
+	var qualifiers []Entrant
+	for _, e := range RankHeats(previous) {
+		if qualified[e.Key()] {
+			qualifiers = append(qualifiers, e)
+		}
+	}
+	switch {
+	case len(qualifiers) == 0:
+		return Round{}, fmt.Errorf("no qualifiers recorded in round %d", last)
+	case len(qualifiers) >= field:
+		return Round{}, fmt.Errorf("heats of %d entrants advancing %d each do not narrow the field of %d", size, advance, field)
+	}
+	return Round{Number: last + 1, Bracket: NoBracket, Matches: splitHeats(qualifiers, size)}, nil
+}
+
+// HeatRounds returns how many rounds a heats stage of n entrants plays, the final included, with
+// every heat full as far as the entrants allow. It fails when the heats cannot narrow the field
+// down to a single final heat.
+func HeatRounds(n, size, advance int) (int, error) {
+	if size < 2 || advance < 1 || advance >= size {
+		return 0, fmt.Errorf("heats of %d entrants cannot advance %d each", size, advance)
+	}
+	rounds := 1
+	for n > size {
+		heats := (n + size - 1) / size
+		qualifiers := 0
+		for h := 0; h < heats; h++ {
+			// snake order leaves n%heats of the heats one entrant larger than the rest
+			inHeat := n / heats
+			if h < n%heats {
+				inHeat++
+			}
+			qualifiers += min(inHeat, advance)
+		}
+		if qualifiers >= n {
+			return 0, fmt.Errorf("heats of %d entrants advancing %d each do not narrow the field of %d", size, advance, n)
+		}
+		n = qualifiers
+		rounds++
+	}
+	return rounds, nil
+}
+
+// RankHeats orders the entrants of heats run side by side in one round: by finishing place, then
+// by finishing time where both entrants have one, then by heat. Entrants without a place come
+// after those with one, except the winner of a walkover, who counts as first. Entrants level on
+// all of these keep the order of their heats.
+func RankHeats(heats []Result) []Entrant {
+	type line struct {
+		entrant     Entrant
+		place, heat int
+		time        *int
+	}
+	var lines []line
+	for h, m := range heats {
+		for i, e := range m.Entrants {
+			l := line{entrant: e, place: math.MaxInt, heat: h}
+			switch {
+			case i < len(m.Placements) && m.Placements[i] != nil:
+				l.place = *m.Placements[i]
+			case m.Completed && m.IsWinner[i]:
+				l.place = 1
+			}
+			if i < len(m.Times) {
+				l.time = m.Times[i]
+			}
+			lines = append(lines, l)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if a.place != b.place {
+			return a.place < b.place
+		}
+		if a.time != nil && b.time != nil && *a.time != *b.time {
+			return *a.time < *b.time
+		}
+		return a.heat < b.heat
+	})
+	ranked := make([]Entrant, len(lines))
+	for i, l := range lines {
+		ranked[i] = l.entrant
+	}
+	return ranked
+}
+
+// splitHeats spreads entrants over as few heats of up to size as hold them, in snake order.
+// A heat left with a single entrant is a bye.
+func splitHeats(entrants []Entrant, size int) []Match {
+	heats := SnakeGroups(entrants, (len(entrants)+size-1)/size)
+	matches := make([]Match, len(heats))
+	for i, heat := range heats {
+		matches[i] = Match{Entrants: heat}
+	}
+	return matches
+}
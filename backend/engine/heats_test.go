@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// heat is a completed heat of the given round, finished by the users in the given order.
+func heat(matchID, round int, finishOrder ...int) Result {
+	m := Result{MatchID: matchID, Round: round, Completed: true, Type: ResultPlayed}
+	for i, e := range userEntrants(finishOrder...) {
+		place := i + 1
+		m.Entrants = append(m.Entrants, e)
+		m.IsWinner = append(m.IsWinner, place == 1)
+		m.Scores = append(m.Scores, nil)
+		m.Placements = append(m.Placements, &place)
+		m.Times = append(m.Times, nil)
+	}
+	return m
+}
+
+func TestHeatsNextRound_FirstRoundSnakesSeeds(t *testing.T) {
+	round, err := HeatsNextRound(userEntrants(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), nil, 4, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := matchIDs(round); !reflect.DeepEqual(got, [][]int{{1, 6, 7}, {2, 5, 8}, {3, 4, 9, 10}}) {
+		t.Errorf("unexpected heats: %v", got)
+	}
+}
+
+func TestHeatsNextRound_AdvancesTopOfEveryHeat(t *testing.T) {
+	results := []Result{
+		heat(1, 1, 7, 1, 6),
+		heat(2, 1, 2, 5, 8),
+		heat(3, 1, 3, 4, 9, 10),
+	}
+	round, err := HeatsNextRound(nil, results, 4, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if round.Number != 2 {
+		t.Errorf("expected round 2, got %d", round.Number)
+	}
+	// heat winners 7, 2, 3 rank ahead of the runners-up 1, 5, 4 and are spread over both heats
+	if got := matchIDs(round); !reflect.DeepEqual(got, [][]int{{7, 1, 5}, {2, 3, 4}}) {
+		t.Errorf("unexpected heats: %v", got)
+	}
+}
+
+func TestHeatsNextRound_PassesOverIneligible(t *testing.T) {
+	results := []Result{
+		heat(1, 1, 1, 2, 3),
+		heat(2, 1, 4, 5, 6),
+	}
+	// user 1 was disqualified, so the third placed entrant of the first heat goes through
+	round, err := HeatsNextRound(userEntrants(2, 3, 4, 5, 6), results, 4, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := matchIDs(round); !reflect.DeepEqual(got, [][]int{{4, 2, 5, 3}}) {
+		t.Errorf("unexpected final: %v", got)
+	}
+}
+
+func TestHeatsNextRound_AlreadyComplete(t *testing.T) {
+	_, err := HeatsNextRound(nil, []Result{heat(1, 2, 1, 2, 3)}, 4, 2)
+	if err == nil || err.Error() != "heats stage is already complete" {
+		t.Errorf("expected complete stage error, got: %v", err)
+	}
+}
+
+func TestRankHeats_TimesSeparateEqualPlaces(t *testing.T) {
+	a, b := heat(1, 1, 1, 2), heat(2, 1, 3, 4)
+	fast, slow := 61000, 62500
+	a.Times[0], b.Times[0] = &slow, &fast
+	ranked := RankHeats([]Result{a, b})
+	var got []int
+	for _, e := range ranked {
+		got = append(got, *e.UserID)
+	}
+	if !reflect.DeepEqual(got, []int{3, 1, 2, 4}) {
+		t.Errorf("unexpected ranking: %v", got)
+	}
+}
+
+func TestHeatRounds(t *testing.T) {
+	// 24 -> three heats of 8 -> 12 -> two heats of 6 -> 8 in the final
+	if rounds, err := HeatRounds(24, 8, 4); err != nil || rounds != 3 {
+		t.Errorf("HeatRounds(24, 8, 4) = %d, %v; want 3 rounds", rounds, err)
+	}
+	// heats of 3 and 2 advancing 3 each would send all 5 on
+	if _, err := HeatRounds(5, 4, 3); err == nil {
+		t.Error("expected an error for heats that do not narrow the field")
+	}
+}
@@ -0,0 +1,120 @@
+package engine
+
+import "fmt"
+
+// RoundRobin plans the whole schedule of a round robin stage. Entrants (in seed/draw order) are
+// split over numGroups groups in snake order and every group plays its own schedule, side by side
+// in the same rounds. With an odd group size each round leaves one entrant of that group without
+// a match. Every match has a home and an away side, spread so that no entrant has more than one
+// home game more than away games or the other way round. With two legs a second cycle follows in
+// which every pairing meets again with the sides swapped, so each entrant hosts every opponent
+// once. It returns the groups together with the rounds.
+func RoundRobin(entrants []Entrant, numGroups, legs int) ([][]Entrant, []Round, error) {
+	n := len(entrants)
+	if n == 0 {
+		return nil, nil, fmt.Errorf("no participants in stage")
+	}
+	if numGroups < 1 {
+		numGroups = 1
+	}
+	if n < numGroups*2 {
+		return nil, nil, fmt.Errorf("expected at least 2 participants per group, got %d for %d groups", n, numGroups)
+	}
+	if legs < 1 {
+		legs = 1
+	}
+	if legs > 2 {
+		return nil, nil, fmt.Errorf("a round robin is played over 1 or 2 legs, got %d", legs)
+	}
+	groups := SnakeGroups(entrants, numGroups)
+
+	var rounds []Round
+	for _, group := range groups {
+		schedule := roundRobinSchedule(len(group))
+		if legs == 2 {
+			schedule = append(schedule, returnLeg(schedule)...)
+		}
+		for r, pairs := range schedule {
+			if r >= len(rounds) {
+				rounds = append(rounds, Round{Number: r + 1, Bracket: NoBracket})
+			}
+			for _, p := range pairs {
+				rounds[r].Matches = append(rounds[r].Matches, homeAway(group[p[0]], group[p[1]]))
+			}
+		}
+	}
+	return groups, rounds, nil
+}
+
+// roundRobinSchedule builds a circle-method schedule for n entrants and returns, per round,
+// the index pairs that meet, home entrant first. An odd n gets a phantom bye slot, kept fixed in
+// the circle; pairings against it are left out, so every entrant sits out exactly once.
+//
+// Sides follow the canonical pattern: the entrant fixed in the circle is at home every other
+// round, and every other pairing takes its side from how far the two entrants sit from the fixed
+// slot. Each entrant then has at most one home game more than away games or the other way round,
+// and never three of either in a row, not even when returnLeg follows.
+func roundRobinSchedule(n int) [][][2]int {
+	slots := n
+	if slots%2 != 0 {
+		slots++
+	}
+	// build circle; with an odd n the bye slot is the one kept fixed
+	idx := make([]int, slots)
+	for i := range idx {
+		idx[i] = i
+		if slots != n {
+			idx[i] = (i + n) % slots
+		}
+	}
+
+	schedule := make([][][2]int, 0, slots-1)
+	for r := 0; r < slots-1; r++ {
+		var pairs [][2]int
+		for i := 0; i < slots/2; i++ {
+			a, b := idx[i], idx[slots-1-i]
+			if a >= n || b >= n {
+				continue // bye
+			}
+			// the fixed entrant is at home every other round; the rest by their distance i
+			if (i == 0 && r%2 == 0) || (i > 0 && i%2 == 0) {
+				a, b = b, a
+			}
+			pairs = append(pairs, [2]int{a, b})
+		}
+		schedule = append(schedule, pairs)
+		// rotate (keep the first slot fixed)
+		tmp := idx[1]
+		copy(idx[1:], idx[2:])
+		idx[slots-1] = tmp
+	}
+	return schedule
+}
+
+// returnLeg mirrors a schedule with the sides swapped. It starts from the second round and plays
+// the first round last, so that no entrant is home or away three times in a row at the turn.
+func returnLeg(schedule [][][2]int) [][][2]int {
+	leg := make([][][2]int, len(schedule))
+	for r := range schedule {
+		pairs := schedule[(r+1)%len(schedule)]
+		leg[r] = make([][2]int, len(pairs))
+		for i, p := range pairs {
+			leg[r][i] = [2]int{p[1], p[0]}
+		}
+	}
+	return leg
+}
+
+// SnakeGroups distributes entrants (in seed/draw order) over n groups in snake order:
+// 1..n into groups A..n, then n+1..2n back from the last group to A, and so on.
+func SnakeGroups(entrants []Entrant, n int) [][]Entrant {
+	groups := make([][]Entrant, n)
+	for i, e := range entrants {
+		row, pos := i/n, i%n
+		if row%2 == 1 {
+			pos = n - 1 - pos
+		}
+		groups[pos] = append(groups[pos], e)
+	}
+	return groups
+}
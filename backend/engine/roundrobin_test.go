@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func userEntrants(ids ...int) []Entrant {
+	entrants := make([]Entrant, len(ids))
+	for i := range ids {
+		id := ids[i]
+		entrants[i] = Entrant{UserID: &id}
+	}
+	return entrants
+}
+
+func TestRoundRobinSchedule_Even(t *testing.T) {
+	schedule := roundRobinSchedule(4)
+	if len(schedule) != 3 {
+		t.Fatalf("expected 3 rounds, got %d", len(schedule))
+	}
+	for r, pairs := range schedule {
+		if len(pairs) != 2 {
+			t.Errorf("round %d: expected 2 matches, got %d", r+1, len(pairs))
+		}
+	}
+}
+
+func TestRoundRobinSchedule_OddEachEntrantSitsOutOnce(t *testing.T) {
+	n := 7
+	schedule := roundRobinSchedule(n)
+	if len(schedule) != n {
+		t.Fatalf("expected %d rounds, got %d", n, len(schedule))
+	}
+	sitOuts := make([]int, n)
+	met := map[[2]int]int{}
+	for _, pairs := range schedule {
+		playing := make([]bool, n)
+		for _, p := range pairs {
+			playing[p[0]], playing[p[1]] = true, true
+			a, b := p[0], p[1]
+			if a > b {
+				a, b = b, a
+			}
+			met[[2]int{a, b}]++
+		}
+		for i, ok := range playing {
+			if !ok {
+				sitOuts[i]++
+			}
+		}
+	}
+	for i, c := range sitOuts {
+		if c != 1 {
+			t.Errorf("entrant %d sat out %d times, want 1", i, c)
+		}
+	}
+	if len(met) != n*(n-1)/2 {
+		t.Errorf("expected %d distinct pairings, got %d", n*(n-1)/2, len(met))
+	}
+	for pair, c := range met {
+		if c != 1 {
+			t.Errorf("pair %v met %d times", pair, c)
+		}
+	}
+}
+
+func TestSnakeGroups(t *testing.T) {
+	groups := SnakeGroups(userEntrants(1, 2, 3, 4, 5, 6, 7, 8), 3)
+	want := [][]int{{1, 6, 7}, {2, 5, 8}, {3, 4}}
+	for g := range want {
+		if len(groups[g]) != len(want[g]) {
+			t.Fatalf("group %d: expected %v, got %+v", g, want[g], groups[g])
+		}
+		for i, id := range want[g] {
+			if *groups[g][i].UserID != id {
+				t.Errorf("group %d: expected %v, got %+v", g, want[g], groups[g])
+			}
+		}
+	}
+}
+
+func TestRoundRobin_KeepsGroupsApart(t *testing.T) {
+	groups, rounds, err := RoundRobin(userEntrants(1, 2, 3, 4, 5, 6, 7, 8), 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inGroup := map[string]int{}
+	for g, group := range groups {
+		for _, e := range group {
+			inGroup[e.Key()] = g
+		}
+	}
+	if len(rounds) != 3 {
+		t.Fatalf("expected 3 rounds, got %d", len(rounds))
+	}
+	for r, round := range rounds {
+		if round.Number != r+1 || len(round.Matches) != 4 {
+			t.Errorf("round %d: expected 4 matches, got %+v", r+1, round)
+		}
+		for _, m := range round.Matches {
+			a, b := m.Entrants[0], m.Entrants[1]
+			if inGroup[a.Key()] != inGroup[b.Key()] {
+				t.Errorf("round %d pairs %s and %s from different groups", r+1, a.Key(), b.Key())
+			}
+		}
+	}
+}
+
+func TestRoundRobin_TooFewPerGroup(t *testing.T) {
+	if _, _, err := RoundRobin(userEntrants(1, 2, 3), 2, 1); err == nil {
+		t.Error("expected an error for a group of one")
+	}
+}
+
+func TestRoundRobin_TwoLegsSwapSides(t *testing.T) {
+	for n := 2; n <= 12; n++ {
+		ids := make([]int, n)
+		for i := range ids {
+			ids[i] = i + 1
+		}
+		_, rounds, err := RoundRobin(userEntrants(ids...), 1, 2)
+		if err != nil {
+			t.Fatalf("n=%d: unexpected error: %v", n, err)
+		}
+		hosted := map[[2]int]int{}
+		sides := make(map[int]string)
+		for _, round := range rounds {
+			for _, m := range round.Matches {
+				if len(m.Sides) != 2 || m.Sides[0] != Home || m.Sides[1] != Away {
+					t.Fatalf("n=%d round %d: expected home and away, got %v", n, round.Number, m.Sides)
+				}
+				home, away := *m.Entrants[0].UserID, *m.Entrants[1].UserID
+				hosted[[2]int{home, away}]++
+				sides[home] += "H"
+				sides[away] += "A"
+			}
+		}
+		if len(hosted) != n*(n-1) {
+			t.Errorf("n=%d: expected every entrant to host every opponent, got %d pairings", n, len(hosted))
+		}
+		for pair, c := range hosted {
+			if c != 1 {
+				t.Errorf("n=%d: %d hosted %d %d times", n, pair[0], pair[1], c)
+			}
+		}
+		for id, seq := range sides {
+			if strings.Contains(seq, "HHH") || strings.Contains(seq, "AAA") {
+				t.Errorf("n=%d: entrant %d plays %s", n, id, seq)
+			}
+			if first := seq[:len(seq)/2]; strings.Count(first, "H")-strings.Count(first, "A") > 1 || strings.Count(first, "A")-strings.Count(first, "H") > 1 {
+				t.Errorf("n=%d: entrant %d is unbalanced in the first leg: %s", n, id, first)
+			}
+		}
+	}
+}
+
+func TestRoundRobin_ThreeLegs(t *testing.T) {
+	if _, _, err := RoundRobin(userEntrants(1, 2, 3, 4), 1, 3); err == nil {
+		t.Error("expected an error for three legs")
+	}
+}
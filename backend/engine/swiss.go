@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// swissHistory is what previous Swiss rounds tell us about each entrant, keyed by Entrant.Key().
+type swissHistory struct {
+	Points map[string]int
+	Played map[string]map[string]bool
+	HadBye map[string]bool
+}
+
+func newSwissHistory() swissHistory {
+	return swissHistory{
+		Points: make(map[string]int),
+		Played: make(map[string]map[string]bool),
+		HadBye: make(map[string]bool),
+	}
+}
+
+func (h swissHistory) markPlayed(a, b string) {
+	if h.Played[a] == nil {
+		h.Played[a] = make(map[string]bool)
+	}
+	if h.Played[b] == nil {
+		h.Played[b] = make(map[string]bool)
+	}
+	h.Played[a][b] = true
+	h.Played[b][a] = true
+}
+
+// SwissNextRound plans the next round of a Swiss stage of totalRounds rounds. Entrants are
+// paired by current score without rematches, keeping their incoming (seed/draw) order on equal
+// scores, and with an odd count the lowest-ranked entrant without a bye sits out and is credited
+// with a win.
+func SwissNextRound(entrants []Entrant, results []Result, points Points, totalRounds int) (Round, error) {
+	if totalRounds < 1 {
+		return Round{}, fmt.Errorf("swiss stage has no round count configured")
+	}
+	next := lastRound(results, NoBracket) + 1
+	if next > totalRounds {
+		return Round{}, fmt.Errorf("all %d swiss rounds have already been generated", totalRounds)
+	}
+	if len(entrants) < 2 {
+		return Round{}, fmt.Errorf("expected at least 2 participants, got %d", len(entrants))
+	}
+
+	history := swissHistoryOf(results, points)
+	pairs, byeEntrant, err := pairSwiss(rankSwiss(entrants, history), history)
+	if err != nil {
+		return Round{}, err
+	}
+	round := Round{Number: next, Bracket: NoBracket}
+	for _, p := range pairs {
+		round.Matches = append(round.Matches, pair(p[0], p[1]))
+	}
+	if byeEntrant != nil {
+		round.Matches = append(round.Matches, bye(*byeEntrant))
+	}
+	return round, nil
+}
+
+// swissHistoryOf tallies points, previous opponents and byes per entrant from every match already
+// created in the stage. A bye is worth a win.
+func swissHistoryOf(results []Result, points Points) swissHistory {
+	history := newSwissHistory()
+	for _, m := range results {
+		if len(m.Entrants) == 1 {
+			history.HadBye[m.Entrants[0].Key()] = true
+			history.Points[m.Entrants[0].Key()] += points.Win
+			continue
+		}
+		for i := 0; i < len(m.Entrants); i++ {
+			for j := i + 1; j < len(m.Entrants); j++ {
+				history.markPlayed(m.Entrants[i].Key(), m.Entrants[j].Key())
+			}
+		}
+		if !m.Completed {
+			continue
+		}
+		draw := m.IsDraw()
+		for i, e := range m.Entrants {
+			switch {
+			case draw:
+				history.Points[e.Key()] += points.Draw
+			case m.IsWinner[i]:
+				history.Points[e.Key()] += points.Win
+			default:
+				history.Points[e.Key()] += points.Lost(m)
+			}
+		}
+	}
+	return history
+}
+
+// rankSwiss orders entrants by points, keeping the incoming order for entrants on the same score.
+func rankSwiss(entrants []Entrant, history swissHistory) []Entrant {
+	ranked := make([]Entrant, len(entrants))
+	copy(ranked, entrants)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return history.Points[ranked[i].Key()] > history.Points[ranked[j].Key()]
+	})
+	return ranked
+}
+
+// pairSwiss pairs ranked entrants top-down while avoiding rematches. With an odd count the
+// lowest-ranked entrant who has not had a bye yet is left out and returned as the bye.
+func pairSwiss(ranked []Entrant, history swissHistory) ([][2]Entrant, *Entrant, error) {
+	if len(ranked)%2 == 0 {
+		pairs, ok := pairWithoutRematch(ranked, history)
+		if !ok {
+			return nil, nil, fmt.Errorf("no swiss pairing possible without rematches")
+		}
+		return pairs, nil, nil
+	}
+
+	for i := len(ranked) - 1; i >= 0; i-- {
+		if history.HadBye[ranked[i].Key()] {
+			continue
+		}
+		rest := make([]Entrant, 0, len(ranked)-1)
+		rest = append(rest, ranked[:i]...)
+		rest = append(rest, ranked[i+1:]...)
+		if pairs, ok := pairWithoutRematch(rest, history); ok {
+			bye := ranked[i]
+			return pairs, &bye, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no swiss pairing possible without rematches or repeated byes")
+}
+
+func pairWithoutRematch(pool []Entrant, history swissHistory) ([][2]Entrant, bool) {
+	if len(pool) == 0 {
+		return nil, true
+	}
+	a := pool[0]
+	for j := 1; j < len(pool); j++ {
+		b := pool[j]
+		if history.Played[a.Key()][b.Key()] {
+			continue
+		}
+		rest := make([]Entrant, 0, len(pool)-2)
+		rest = append(rest, pool[1:j]...)
+		rest = append(rest, pool[j+1:]...)
+		if pairs, ok := pairWithoutRematch(rest, history); ok {
+			return append([][2]Entrant{{a, b}}, pairs...), true
+		}
+	}
+	return nil, false
+}
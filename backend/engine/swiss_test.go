@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPairSwiss_FirstRoundPairsTopDown(t *testing.T) {
+	history := newSwissHistory()
+	pairs, bye, err := pairSwiss(userEntrants(1, 2, 3, 4), history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bye != nil {
+		t.Errorf("expected no bye, got %+v", bye)
+	}
+	if len(pairs) != 2 || *pairs[0][0].UserID != 1 || *pairs[0][1].UserID != 2 || *pairs[1][0].UserID != 3 || *pairs[1][1].UserID != 4 {
+		t.Errorf("unexpected pairs: %+v", pairs)
+	}
+}
+
+func TestPairSwiss_AvoidsRematch(t *testing.T) {
+	history := newSwissHistory()
+	history.markPlayed("u1", "u2")
+	history.markPlayed("u3", "u4")
+	pairs, _, err := pairSwiss(userEntrants(1, 2, 3, 4), history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range pairs {
+		if history.Played[p[0].Key()][p[1].Key()] {
+			t.Errorf("rematch between %s and %s", p[0].Key(), p[1].Key())
+		}
+	}
+}
+
+func TestPairSwiss_ByeGoesToLowestWithoutBye(t *testing.T) {
+	history := newSwissHistory()
+	history.HadBye["u5"] = true
+	_, bye, err := pairSwiss(userEntrants(1, 2, 3, 4, 5), history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bye == nil || *bye.UserID != 4 {
+		t.Errorf("expected bye for user 4, got %+v", bye)
+	}
+}
+
+func TestPairSwiss_NoPairingLeft(t *testing.T) {
+	history := newSwissHistory()
+	history.markPlayed("u1", "u2")
+	if _, _, err := pairSwiss(userEntrants(1, 2), history); err == nil {
+		t.Error("expected error when only rematches are left")
+	}
+}
+
+func TestRankSwiss_ByPoints(t *testing.T) {
+	history := newSwissHistory()
+	history.Points["u3"] = 6
+	history.Points["u2"] = 1
+	ranked := rankSwiss(userEntrants(1, 2, 3), history)
+	if *ranked[0].UserID != 3 || *ranked[1].UserID != 2 || *ranked[2].UserID != 1 {
+		t.Errorf("unexpected ranking: %+v", ranked)
+	}
+}
+
+func TestSwissNextRound_PairsByScore(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1, 2),
+		played(2, NoBracket, 1, 3, 3, 4),
+		played(3, NoBracket, 1, 5, 5),
+	}
+	round, err := SwissNextRound(userEntrants(1, 2, 3, 4, 5), results, Points{Win: 3, Draw: 1}, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if round.Number != 2 {
+		t.Errorf("expected round 2, got %d", round.Number)
+	}
+	// 1, 3 and 5 lead on 3 points; 5 already had the bye, so the lowest entrant without one sits out
+	if got := matchIDs(round); !reflect.DeepEqual(got, [][]int{{1, 3}, {5, 2}, {4}}) {
+		t.Errorf("unexpected pairings: %v", got)
+	}
+}
+
+func TestSwissNextRound_AllRoundsGenerated(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 3, 1, 1, 2),
+	}
+	_, err := SwissNextRound(userEntrants(1, 2), results, Points{Win: 3}, 3)
+	if err == nil || err.Error() != "all 3 swiss rounds have already been generated" {
+		t.Errorf("expected rounds exhausted error, got: %v", err)
+	}
+}
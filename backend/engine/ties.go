@@ -0,0 +1,158 @@
+package engine
+
+// Legs of a knockout tie: the two legs are played home and away, and the decider only when they
+// leave the tie level.
+const (
+	FirstLeg  = 1
+	SecondLeg = 2
+	Decider   = 3
+)
+
+// TwoLegged turns every pairing of the planned rounds into a tie over two legs that follow each
+// other in the round. The second entrant of a pairing, the lower seed, hosts the first leg, so
+// the higher seed plays the second leg at home. Byes stay as they are. Matches waiting on slots
+// are not split, so pre-generated brackets cannot be played over two legs.
+func TwoLegged(rounds []Round) []Round {
+	legged := make([]Round, len(rounds))
+	for r, round := range rounds {
+		legged[r] = Round{Number: round.Number, Bracket: round.Bracket}
+		for _, m := range round.Matches {
+			if len(m.Entrants) != 2 || len(m.Slots) > 0 {
+				legged[r].Matches = append(legged[r].Matches, m)
+				continue
+			}
+			first := homeAway(m.Entrants[1], m.Entrants[0])
+			first.Leg = FirstLeg
+			second := homeAway(m.Entrants[0], m.Entrants[1])
+			second.Leg = SecondLeg
+			legged[r].Matches = append(legged[r].Matches, first, second)
+		}
+	}
+	return legged
+}
+
+// FoldTies replaces the legs of every two-legged tie with a single result for the whole tie, in
+// the place of its first leg, so that the knockout formats advance the winner of the tie as they
+// would the winner of a match. Results that are not legs of a tie are kept as they are.
+func FoldTies(results []Result, awayGoals bool) []Result {
+	var folded []Result
+	at := make(map[int]int)
+	legs := make(map[int][]Result)
+	for _, m := range results {
+		if m.Leg == 0 {
+			folded = append(folded, m)
+			continue
+		}
+		if _, ok := at[m.FirstLeg]; !ok {
+			at[m.FirstLeg] = len(folded)
+			folded = append(folded, Result{})
+		}
+		legs[m.FirstLeg] = append(legs[m.FirstLeg], m)
+	}
+	for id, i := range at {
+		folded[i], _ = settleTie(legs[id], awayGoals)
+	}
+	return folded
+}
+
+// NeedsDecider reports whether both legs of a tie have been played and leave it level, away
+// goals included when they count, with no decider created yet.
+func NeedsDecider(legs []Result, awayGoals bool) bool {
+	for _, m := range legs {
+		if m.Leg == Decider {
+			return false
+		}
+	}
+	_, level := settleTie(legs, awayGoals)
+	return level
+}
+
+// settleTie works out the result of a tie from its legs. The tie is won on the aggregate score of
+// the two legs; when that is level and away goals count, by the entrant who scored more in their
+// away leg; and otherwise by the winner of the decider. A leg that was not played out, such as a
+// walkover or a forfeit, gives the tie to its winner, and a double forfeit to nobody. The tie's
+// scores are the aggregate. level reports a tie whose two legs are played and leave it level.
+func settleTie(legs []Result, awayGoals bool) (tie Result, level bool) {
+	first := legs[0]
+	for _, m := range legs {
+		if m.Leg == FirstLeg {
+			first = m
+		}
+	}
+	tie = Result{
+		MatchID:  first.MatchID,
+		Bracket:  first.Bracket,
+		Round:    first.Round,
+		Type:     ResultPlayed,
+		Entrants: first.Entrants,
+		IsWinner: make([]bool, len(first.Entrants)),
+		Scores:   make([]*int, len(first.Entrants)),
+	}
+	if len(first.Entrants) != 2 {
+		return first, false
+	}
+
+	index := map[string]int{first.Entrants[0].Key(): 0, first.Entrants[1].Key(): 1}
+	var aggregate, away [2]int
+	var decider *Result
+	played := 0
+	for l := range legs {
+		m := legs[l]
+		if m.Leg == Decider {
+			decider = &legs[l]
+			continue
+		}
+		if !m.Completed {
+			continue
+		}
+		if m.Type != "" && m.Type != ResultPlayed {
+			tie.Type, tie.Completed = m.Type, true
+			for i, e := range m.Entrants {
+				if m.IsWinner[i] {
+					tie.IsWinner[index[e.Key()]] = true
+				}
+			}
+			return tie, false
+		}
+		played++
+		for i, e := range m.Entrants {
+			if i >= len(m.Scores) || m.Scores[i] == nil {
+				continue
+			}
+			aggregate[index[e.Key()]] += *m.Scores[i]
+			if i < len(m.Sides) && m.Sides[i] == Away {
+				away[index[e.Key()]] += *m.Scores[i]
+			}
+		}
+	}
+	if played < 2 {
+		return tie, false
+	}
+	for i := range aggregate {
+		score := aggregate[i]
+		tie.Scores[i] = &score
+	}
+
+	switch {
+	case aggregate[0] != aggregate[1]:
+		tie.IsWinner[0] = aggregate[0] > aggregate[1]
+	case awayGoals && away[0] != away[1]:
+		tie.IsWinner[0] = away[0] > away[1]
+	case decider != nil && decider.Completed:
+		for i, e := range decider.Entrants {
+			if decider.IsWinner[i] {
+				tie.IsWinner[index[e.Key()]] = true
+			}
+		}
+		if decider.Type == ResultDoubleForfeit {
+			tie.Type = ResultDoubleForfeit
+		}
+		tie.Completed = true
+		return tie, false
+	default:
+		return tie, true
+	}
+	tie.IsWinner[1] = !tie.IsWinner[0]
+	tie.Completed = true
+	return tie, false
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// leg is a played leg of the tie first played in match firstLeg, home entrant first.
+func leg(matchID, firstLeg, number, home, homeScore, away, awayScore int) Result {
+	m := played(matchID, NoBracket, 1, 0, home, away)
+	m.Leg, m.FirstLeg = number, firstLeg
+	m.Sides = []string{Home, Away}
+	m.Scores = []*int{&homeScore, &awayScore}
+	m.IsWinner = []bool{homeScore > awayScore, awayScore > homeScore}
+	return m
+}
+
+func TestTwoLegged_HigherSeedHostsSecondLeg(t *testing.T) {
+	rounds := TwoLegged([]Round{{Number: 1, Matches: []Match{bye(userEntrants(1)[0]), pair(userEntrants(2)[0], userEntrants(3)[0])}}})
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{1}, {3, 2}, {2, 3}}) {
+		t.Fatalf("unexpected legs: %v", got)
+	}
+	if m := rounds[0].Matches[1]; m.Leg != FirstLeg || !reflect.DeepEqual(m.Sides, []string{Home, Away}) {
+		t.Errorf("unexpected first leg: %+v", m)
+	}
+	if rounds[0].Matches[2].Leg != SecondLeg || rounds[0].Matches[0].Leg != 0 {
+		t.Errorf("unexpected legs: %+v", rounds[0].Matches)
+	}
+}
+
+func TestFoldTies_Aggregate(t *testing.T) {
+	results := []Result{
+		played(1, NoBracket, 1, 1, 1),
+		leg(2, 2, FirstLeg, 3, 2, 2, 1),
+		leg(3, 2, SecondLeg, 2, 2, 3, 0),
+	}
+	folded := FoldTies(results, true)
+	if len(folded) != 2 || folded[1].MatchID != 2 || !folded[1].Completed {
+		t.Fatalf("expected the bye and a completed tie, got %+v", folded)
+	}
+	// 3 leads 2-1 from the first leg, 2 wins 3-2 on aggregate
+	if w := folded[1].Winners(); len(w) != 1 || *w[0].UserID != 2 {
+		t.Errorf("expected user 2 to win the tie, got %+v", w)
+	}
+	if *folded[1].Scores[0] != 2 || *folded[1].Scores[1] != 3 {
+		t.Errorf("expected an aggregate of 2-3, got %d-%d", *folded[1].Scores[0], *folded[1].Scores[1])
+	}
+}
+
+func TestFoldTies_AwayGoals(t *testing.T) {
+	// 2-2 on aggregate; user 2 scored 2 away, user 3 scored 1
+	legs := []Result{
+		leg(2, 2, FirstLeg, 3, 1, 2, 2),
+		leg(3, 2, SecondLeg, 2, 0, 3, 1),
+	}
+	if w := FoldTies(legs, true)[0].Winners(); len(w) != 1 || *w[0].UserID != 2 {
+		t.Errorf("expected user 2 to win on away goals, got %+v", w)
+	}
+	if FoldTies(legs, false)[0].Completed || !NeedsDecider(legs, false) {
+		t.Error("expected a decider without away goals")
+	}
+	if NeedsDecider(legs, true) {
+		t.Error("expected no decider with away goals")
+	}
+}
+
+func TestFoldTies_Decider(t *testing.T) {
+	legs := []Result{
+		leg(2, 2, FirstLeg, 3, 1, 2, 1),
+		leg(3, 2, SecondLeg, 2, 0, 3, 0),
+	}
+	if !NeedsDecider(legs, false) {
+		t.Fatal("expected a level tie to need a decider")
+	}
+	decider := played(4, NoBracket, 1, 3, 2, 3)
+	decider.Leg, decider.FirstLeg = Decider, 2
+	legs = append(legs, decider)
+	if NeedsDecider(legs, false) {
+		t.Error("expected no second decider")
+	}
+	if w := FoldTies(legs, false)[0].Winners(); len(w) != 1 || *w[0].UserID != 3 {
+		t.Errorf("expected user 3 to win the decider, got %+v", w)
+	}
+}
+
+func TestFoldTies_WalkoverDecidesTie(t *testing.T) {
+	walkover := played(2, NoBracket, 1, 2, 3, 2)
+	walkover.Leg, walkover.FirstLeg, walkover.Type = FirstLeg, 2, ResultWalkover
+	second := leg(3, 2, SecondLeg, 2, 0, 3, 0)
+	second.Completed = false
+	tie := FoldTies([]Result{walkover, second}, false)[0]
+	if !tie.Completed || tie.Type != ResultWalkover {
+		t.Fatalf("expected the walkover to decide the tie, got %+v", tie)
+	}
+	if w := tie.Winners(); len(w) != 1 || *w[0].UserID != 2 {
+		t.Errorf("expected user 2 to win the tie, got %+v", w)
+	}
+}
+
+func TestSingleElimNextRound_AdvancesTieWinners(t *testing.T) {
+	results := FoldTies([]Result{
+		leg(1, 1, FirstLeg, 4, 0, 1, 1),
+		leg(2, 1, SecondLeg, 1, 0, 4, 2),
+		leg(3, 3, FirstLeg, 3, 1, 2, 1),
+		leg(4, 3, SecondLeg, 2, 2, 3, 0),
+	}, false)
+	rounds, err := SingleElimNextRound(nil, results, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := matchIDs(rounds[0]); !reflect.DeepEqual(got, [][]int{{4, 2}}) {
+		t.Errorf("expected the tie winners in the final, got %v", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Drodrl/competition-engine/controllers"
 	"github.com/Drodrl/competition-engine/models"
 	"github.com/gorilla/mux"
 )
@@ -252,8 +253,8 @@ func ChangeCompetitionStatus(w http.ResponseWriter, r *http.Request) {
 		}
 		// Insert users
 		res, err := db.Exec(`
-            INSERT INTO stage_participants (stage_id, user_id)
-            SELECT $1, user_id FROM competition_participants WHERE competition_id = $2 AND user_id IS NOT NULL
+            INSERT INTO stage_participants (stage_id, user_id, seed)
+            SELECT $1, user_id, seed FROM competition_participants WHERE competition_id = $2 AND user_id IS NOT NULL AND disqualified_at IS NULL
             ON CONFLICT DO NOTHING
         `, firstStageID, id)
 		if err != nil {
@@ -264,8 +265,8 @@ func ChangeCompetitionStatus(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Inserted %d user participants into stage_participants", count)
 		// Insert teams
 		if _, err = db.Exec(`
-            INSERT INTO stage_participants (stage_id, team_id)
-            SELECT $1, team_id FROM competition_participants WHERE competition_id = $2 AND team_id IS NOT NULL
+            INSERT INTO stage_participants (stage_id, team_id, seed)
+            SELECT $1, team_id, seed FROM competition_participants WHERE competition_id = $2 AND team_id IS NOT NULL AND disqualified_at IS NULL
             ON CONFLICT DO NOTHING
         `, firstStageID, id); err != nil {
 			sendJSONError(w, "Failed to insert teams into stage_participants: "+err.Error(), http.StatusInternalServerError)
@@ -293,27 +294,15 @@ func canOpenCompetition(competitionID int, maxParticipants int) error {
 	if err != nil {
 		return err
 	}
-	prevParticipants := maxParticipants
-	for i, s := range stages {
-		minimum := formatMin[s.TourneyFormatID]
-		if s.ParticipantsAtStart < minimum {
-			return errors.New("Stage '" + s.StageName + "' requires at least " + strconv.Itoa(minimum) + " participants.")
-		}
-		if s.ParticipantsAtStart%2 != 0 {
-			return errors.New("Stage '" + s.StageName + "' must have an even number of participants at start.")
-		}
-		if i > 0 && s.ParticipantsAtStart > prevParticipants-2 {
-			return errors.New("Stage '" + s.StageName + "' cannot have more participants at start than previous stage's end minus 2 (" + strconv.Itoa(prevParticipants-2) + ").")
-		}
-		prevParticipants = s.ParticipantsAtStart
-	}
-	return nil
+	return checkStagePipeline(stages, maxParticipants, func(formatID int) (int, error) {
+		return formatMin[formatID], nil
+	})
 }
 
 // Helper: Get all stages for a competition
 func getCompetitionStages(competitionID int) ([]models.StageDTO, error) {
 	rows, err := db.Query(`
-        SELECT stage_id, stage_name, stage_order, tourney_format_id, participants_at_start, participants_at_end
+        SELECT stage_id, stage_name, stage_order, tourney_format_id, participants_at_start, participants_at_end, swiss_rounds, COALESCE(draw_mode, 'seeded'), COALESCE(num_groups, 1), COALESCE(advancement_map, ''), COALESCE(third_place_match, false), points_win, points_draw, points_loss, COALESCE(tiebreakers, ''), COALESCE(full_bracket, false), best_of, forfeit_points, awarded_score, COALESCE(retired_as_forfeit, false), heat_size, advance_per_heat, challenge_range, challenge_cooldown_hours, legs, COALESCE(away_goals, false)
         FROM competition_stages WHERE competition_id = $1 ORDER BY stage_order ASC
     `, competitionID)
 	if err != nil {
@@ -327,7 +316,7 @@ func getCompetitionStages(competitionID int) ([]models.StageDTO, error) {
 	var stages []models.StageDTO
 	for rows.Next() {
 		var s models.StageDTO
-		if err := rows.Scan(&s.StageID, &s.StageName, &s.StageOrder, &s.TourneyFormatID, &s.ParticipantsAtStart, &s.ParticipantsAtEnd); err != nil {
+		if err := rows.Scan(&s.StageID, &s.StageName, &s.StageOrder, &s.TourneyFormatID, &s.ParticipantsAtStart, &s.ParticipantsAtEnd, &s.SwissRounds, &s.DrawMode, &s.NumGroups, &s.AdvancementMap, &s.ThirdPlaceMatch, &s.PointsWin, &s.PointsDraw, &s.PointsLoss, &s.Tiebreakers, &s.FullBracket, &s.BestOf, &s.ForfeitPoints, &s.AwardedScore, &s.RetiredAsForfeit, &s.HeatSize, &s.AdvancePerHeat, &s.ChallengeRange, &s.ChallengeCooldownHours, &s.Legs, &s.AwayGoals); err != nil {
 			return nil, errors.New("DB error: " + err.Error())
 		}
 		stages = append(stages, s)
@@ -335,6 +324,55 @@ func getCompetitionStages(competitionID int) ([]models.StageDTO, error) {
 	return stages, nil
 }
 
+// stagePlacements returns the names of a finished stage's entrants in the order the stage's
+// format ranks them, so a tie, table or heat is won as its format decides rather than by the last
+// match. The winner comes first, with place 1.
+func stagePlacements(stageID int) ([]map[string]interface{}, error) {
+	ranked, err := controllers.StageRanking(db, stageID)
+	if err != nil {
+		return nil, err
+	}
+	placements := make([]map[string]interface{}, len(ranked))
+	for i, e := range ranked {
+		name, teamName := entrantNames(e.UserID, e.TeamID)
+		placements[i] = map[string]interface{}{
+			"place":     i + 1,
+			"name":      name,
+			"team_name": teamName,
+		}
+	}
+	return placements, nil
+}
+
+// entrantNames looks up the user and team names of an entrant.
+func entrantNames(userID, teamID *int) (name, teamName string) {
+	if userID != nil {
+		_ = db.QueryRow(`SELECT name_user FROM users WHERE id_user = $1`, *userID).Scan(&name)
+	}
+	if teamID != nil {
+		_ = db.QueryRow(`SELECT team_name FROM teams WHERE team_id = $1`, *teamID).Scan(&teamName)
+	}
+	return name, teamName
+}
+
+// getThirdPlaceFinisher returns the names of the winner of the stage's third place match, or nil
+// when the stage has none.
+func getThirdPlaceFinisher(stageID int) map[string]interface{} {
+	userID, teamID, err := controllers.ThirdPlaceWinner(db, stageID)
+	if err != nil {
+		log.Printf("third place lookup error: %v", err)
+		return nil
+	}
+	if userID == nil && teamID == nil {
+		return nil
+	}
+	name, teamName := entrantNames(userID, teamID)
+	return map[string]interface{}{
+		"name":      name,
+		"team_name": teamName,
+	}
+}
+
 // Helper: Get minimum participants for each tournament format
 func getTournamentFormatMinimums() (map[int]int, error) {
 	rows, err := db.Query(`SELECT tourney_format_id, min_participants FROM tournament_formats`)
@@ -408,7 +446,7 @@ func GetStagesByCompetitionID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := db.Query(`
-        SELECT stage_id, stage_name, stage_order, tourney_format_id, participants_at_start, participants_at_end
+        SELECT stage_id, stage_name, stage_order, tourney_format_id, participants_at_start, participants_at_end, swiss_rounds, COALESCE(draw_mode, 'seeded'), COALESCE(num_groups, 1), COALESCE(advancement_map, ''), COALESCE(third_place_match, false), points_win, points_draw, points_loss, COALESCE(tiebreakers, ''), COALESCE(full_bracket, false), best_of, forfeit_points, awarded_score, COALESCE(retired_as_forfeit, false), heat_size, advance_per_heat, challenge_range, challenge_cooldown_hours, legs, COALESCE(away_goals, false)
         FROM competition_stages WHERE competition_id = $1 ORDER BY stage_order ASC
     `, competitionID)
 	if err != nil {
@@ -423,7 +461,7 @@ func GetStagesByCompetitionID(w http.ResponseWriter, r *http.Request) {
 	var stages []models.StageDTO
 	for rows.Next() {
 		var s models.StageDTO
-		if err := rows.Scan(&s.StageID, &s.StageName, &s.StageOrder, &s.TourneyFormatID, &s.ParticipantsAtStart, &s.ParticipantsAtEnd); err != nil {
+		if err := rows.Scan(&s.StageID, &s.StageName, &s.StageOrder, &s.TourneyFormatID, &s.ParticipantsAtStart, &s.ParticipantsAtEnd, &s.SwissRounds, &s.DrawMode, &s.NumGroups, &s.AdvancementMap, &s.ThirdPlaceMatch, &s.PointsWin, &s.PointsDraw, &s.PointsLoss, &s.Tiebreakers, &s.FullBracket, &s.BestOf, &s.ForfeitPoints, &s.AwardedScore, &s.RetiredAsForfeit, &s.HeatSize, &s.AdvancePerHeat, &s.ChallengeRange, &s.ChallengeCooldownHours, &s.Legs, &s.AwayGoals); err != nil {
 			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -454,6 +492,12 @@ func AddStageToCompetition(w http.ResponseWriter, r *http.Request) {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if stage.DrawMode == "" {
+		stage.DrawMode = controllers.DrawSeeded
+	}
+	if stage.NumGroups == 0 {
+		stage.NumGroups = 1
+	}
 	stages = append(stages, stage)
 	maxParticipants, _ := getCompetitionMaxParticipants(competitionID)
 	if err := validateStagesBusinessRules(competitionID, stages, maxParticipants); err != nil {
@@ -461,9 +505,9 @@ func AddStageToCompetition(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, err = db.Exec(`
-        INSERT INTO competition_stages (competition_id, stage_order, stage_name, tourney_format_id, participants_at_start, participants_at_end)
-        VALUES ($1, $2, $3, $4, $5, $6)
-    `, competitionID, stage.StageOrder, stage.StageName, stage.TourneyFormatID, stage.ParticipantsAtStart, stage.ParticipantsAtEnd); err != nil {
+        INSERT INTO competition_stages (competition_id, stage_order, stage_name, tourney_format_id, participants_at_start, participants_at_end, swiss_rounds, draw_mode, num_groups, advancement_map, third_place_match, points_win, points_draw, points_loss, tiebreakers, full_bracket, best_of, forfeit_points, awarded_score, retired_as_forfeit, heat_size, advance_per_heat, challenge_range, challenge_cooldown_hours, legs, away_goals)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13, $14, NULLIF($15, ''), $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)
+    `, competitionID, stage.StageOrder, stage.StageName, stage.TourneyFormatID, stage.ParticipantsAtStart, stage.ParticipantsAtEnd, stage.SwissRounds, stage.DrawMode, stage.NumGroups, stage.AdvancementMap, stage.ThirdPlaceMatch, stage.PointsWin, stage.PointsDraw, stage.PointsLoss, stage.Tiebreakers, stage.FullBracket, stage.BestOf, stage.ForfeitPoints, stage.AwardedScore, stage.RetiredAsForfeit, stage.HeatSize, stage.AdvancePerHeat, stage.ChallengeRange, stage.ChallengeCooldownHours, stage.Legs, stage.AwayGoals); err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -499,6 +543,12 @@ func UpdateStage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if stage.DrawMode == "" {
+		stage.DrawMode = controllers.DrawSeeded
+	}
+	if stage.NumGroups == 0 {
+		stage.NumGroups = 1
+	}
 	for i := range stages {
 		if stages[i].StageID == stageID {
 			stage.StageID = stageID
@@ -515,9 +565,13 @@ func UpdateStage(w http.ResponseWriter, r *http.Request) {
 
 	if _, err = db.Exec(`
         UPDATE competition_stages
-        SET stage_name = $1, stage_order = $2, tourney_format_id = $3, participants_at_start = $4, participants_at_end = $5
-        WHERE stage_id = $6
-    `, stage.StageName, stage.StageOrder, stage.TourneyFormatID, stage.ParticipantsAtStart, stage.ParticipantsAtEnd, stageID); err != nil {
+        SET stage_name = $1, stage_order = $2, tourney_format_id = $3, participants_at_start = $4, participants_at_end = $5, swiss_rounds = $6, draw_mode = $7, num_groups = $8, advancement_map = NULLIF($9, ''), third_place_match = $10,
+            points_win = $11, points_draw = $12, points_loss = $13, tiebreakers = NULLIF($14, ''), full_bracket = $15, best_of = $16,
+            forfeit_points = $17, awarded_score = $18, retired_as_forfeit = $19, heat_size = $20, advance_per_heat = $21,
+            challenge_range = $22, challenge_cooldown_hours = $23, legs = $24, away_goals = $25
+        WHERE stage_id = $26
+    `, stage.StageName, stage.StageOrder, stage.TourneyFormatID, stage.ParticipantsAtStart, stage.ParticipantsAtEnd, stage.SwissRounds, stage.DrawMode, stage.NumGroups, stage.AdvancementMap, stage.ThirdPlaceMatch,
+		stage.PointsWin, stage.PointsDraw, stage.PointsLoss, stage.Tiebreakers, stage.FullBracket, stage.BestOf, stage.ForfeitPoints, stage.AwardedScore, stage.RetiredAsForfeit, stage.HeatSize, stage.AdvancePerHeat, stage.ChallengeRange, stage.ChallengeCooldownHours, stage.Legs, stage.AwayGoals, stageID); err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -551,12 +605,12 @@ func GetParticipantsByCompetitionID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := db.Query(`
-        SELECT u.id_user, u.name_user, u.lname1_user
+        SELECT u.id_user, u.name_user, u.lname1_user, cp.disqualified_at IS NOT NULL
         FROM competition_participants cp
         JOIN users u ON cp.user_id = u.id_user
         WHERE cp.competition_id = $1
         UNION
-        SELECT t.team_id, t.team_name, NULL
+        SELECT t.team_id, t.team_name, NULL, cp.disqualified_at IS NOT NULL
         FROM competition_participants cp
         JOIN teams t ON cp.team_id = t.team_id
         WHERE cp.competition_id = $1
@@ -572,14 +626,15 @@ func GetParticipantsByCompetitionID(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	type Participant struct {
-		ID       int     `json:"id"`
-		Name     string  `json:"name"`
-		LastName *string `json:"last_name,omitempty"`
+		ID           int     `json:"id"`
+		Name         string  `json:"name"`
+		LastName     *string `json:"last_name,omitempty"`
+		Disqualified bool    `json:"disqualified"`
 	}
 	var participants []Participant
 	for rows.Next() {
 		var p Participant
-		if err := rows.Scan(&p.ID, &p.Name, &p.LastName); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.LastName, &p.Disqualified); err != nil {
 			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -591,6 +646,45 @@ func GetParticipantsByCompetitionID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// POST /api/competitions/{competitionId}/disqualify
+func DisqualifyParticipant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	competitionID, err := strconv.Atoi(vars["competitionId"])
+	if err != nil {
+		sendJSONError(w, "Invalid competition ID", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		UserID *int `json:"user_id"`
+		TeamID *int `json:"team_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (body.UserID == nil) == (body.TeamID == nil) {
+		sendJSONError(w, "Either user_id or team_id is required", http.StatusBadRequest)
+		return
+	}
+
+	dq, err := controllers.DisqualifyEntrant(db, competitionID, models.Entrant{UserID: body.UserID, TeamID: body.TeamID})
+	switch {
+	case errors.Is(err, controllers.ErrNotParticipant):
+		sendJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, controllers.ErrAlreadyDisqualified):
+		sendJSONError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dq); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
 // POST /api/competitions/{competitionId}/finish
 func FinishCompetition(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -628,52 +722,36 @@ func FinishCompetition(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Find the last round in the last stage
-	var lastRoundID int
-	if err = db.QueryRow(`
-        SELECT round_id FROM rounds
-        WHERE stage_id = $1
-        ORDER BY round_number DESC LIMIT 1
-    `, lastStageID).Scan(&lastRoundID); err != nil {
-		sendJSONError(w, "No rounds found in last stage", http.StatusBadRequest)
+	// 3. The stage's format decides who won it
+	placements, err := stagePlacements(lastStageID)
+	if errors.Is(err, controllers.ErrStageNotFinished) {
+		sendJSONError(w, "No winner found in last stage", http.StatusBadRequest)
 		return
-	}
-
-	// 4. Find the winner(s) in the last match of the last round
-	var winnerUserID, winnerTeamID sql.NullInt64
-	if err = db.QueryRow(`
-        SELECT mp.user_id, mp.team_id
-        FROM matches m
-        JOIN match_participants mp ON mp.match_id = m.match_id
-        WHERE m.round_id = $1 AND mp.is_winner = true
-        LIMIT 1
-    `, lastRoundID).Scan(&winnerUserID, &winnerTeamID); err != nil {
-		sendJSONError(w, "No winner found in last round", http.StatusBadRequest)
+	} else if errors.Is(err, controllers.ErrUnsupportedFormat) {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var winnerName, teamName string
-	if winnerUserID.Valid {
-		_ = db.QueryRow(`SELECT name_user FROM users WHERE id_user = $1`, winnerUserID.Int64).Scan(&winnerName)
-	}
-	if winnerTeamID.Valid {
-		_ = db.QueryRow(`SELECT team_name FROM teams WHERE team_id = $1`, winnerTeamID.Int64).Scan(&teamName)
-	}
+	thirdPlace := getThirdPlaceFinisher(lastStageID)
 
-	// 5. Update competition status
+	// 4. Update competition status
 	if _, err = db.Exec(`UPDATE competitions SET status = 3 WHERE competition_id = $1`, competitionID); err != nil {
 		sendJSONError(w, "Failed to update competition status: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 6. Return winner info in response
+	// 5. Return the winner and the final placements in response
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]interface{}{
-		"finished": true,
-		"winner": map[string]interface{}{
-			"name":      winnerName,
-			"team_name": teamName,
-		},
+		"finished":   true,
+		"winner":     placements[0],
+		"placements": placements,
+	}
+	if thirdPlace != nil {
+		resp["third_place"] = thirdPlace
 	}
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Printf("encode error: %v", err)
@@ -753,45 +831,9 @@ func GetCompetitionsByFlagTeams(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Helper: Validate stage business rules
+// Helper: Validate stage business rules (see stageRules)
 func validateStagesBusinessRules(competitionID int, stages []models.StageDTO, maxParticipants int) error {
-	if len(stages) == 0 {
-		return errors.New("please add at least one stage before saving")
-	}
-	for i, stage := range stages {
-		// 1st stage, only one stage: must be single or double elim
-		if i == 0 && len(stages) == 1 && !(stage.TourneyFormatID == 1 || stage.TourneyFormatID == 2) {
-			return errors.New("if there is only one stage, it must be Single or Double Elimination")
-		}
-		// 1st stage, two stages: must be RR
-		if i == 0 && len(stages) == 2 && stage.TourneyFormatID != 3 {
-			return errors.New("if there are two stages, the first must be Round Robin")
-		}
-		// 2nd stage, two stages: must be single or double elim
-		if i == 1 && len(stages) == 2 && !(stage.TourneyFormatID == 1 || stage.TourneyFormatID == 2) {
-			return errors.New("the last stage must be Single or Double Elimination")
-		}
-		// Minimum participants
-		minParticipants, err := getFormatMinParticipants(stage.TourneyFormatID)
-		if err != nil {
-			return err
-		}
-		if stage.ParticipantsAtStart < minParticipants {
-			return errors.New("stage requires at least the minimum number of participants")
-		}
-		// Even number check
-		if stage.ParticipantsAtStart%2 != 0 {
-			return errors.New("participants at start must be an even number")
-		}
-		// Participants at start for subsequent stages
-		if i > 0 {
-			prev := stages[i-1]
-			if stage.ParticipantsAtStart > prev.ParticipantsAtStart-2 {
-				return errors.New("participants at start cannot exceed participants at start of previous stage (at least 2 less)")
-			}
-		}
-	}
-	return nil
+	return checkStagePipeline(stages, maxParticipants, getFormatMinParticipants)
 }
 
 func getFormatMinParticipants(formatID int) (int, error) {
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -16,6 +18,10 @@ import (
 func ptr(s string) *string { return &s }
 func ptrInt(i int) *int    { return &i }
 
+var stageColumns = []string{
+	"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end", "swiss_rounds", "draw_mode", "num_groups", "advancement_map", "third_place_match", "points_win", "points_draw", "points_loss", "tiebreakers", "full_bracket", "best_of", "forfeit_points", "awarded_score", "retired_as_forfeit", "heat_size", "advance_per_heat", "challenge_range", "challenge_cooldown_hours", "legs", "away_goals",
+}
+
 func TestCreateDraftCompetition_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
@@ -318,9 +324,7 @@ func TestGetStagesByCompetitionID_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}).AddRow(1, "Stage 1", 1, 1, 8, 4))
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Stage 1", 1, 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/competitions/1/stages", nil)
 	req = muxSetVars(req, map[string]string{"competitionId": "1"})
@@ -407,9 +411,7 @@ func TestAddStageToCompetition_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}))
+		WillReturnRows(sqlmock.NewRows(stageColumns))
 
 	mock.ExpectQuery("SELECT max_participants FROM competitions").
 		WithArgs(1).
@@ -420,7 +422,7 @@ func TestAddStageToCompetition_Success(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"minimum_participants"}).AddRow(2))
 
 	mock.ExpectExec("INSERT INTO competition_stages").
-		WithArgs(1, 1, "Stage 1", 1, 8, 4).
+		WithArgs(1, 1, "Stage 1", 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	stage := models.StageDTO{
@@ -468,9 +470,7 @@ func TestAddStageToCompetition_BusinessRuleFail(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}).AddRow(1, "Stage 1", 1, 1, 8, 4))
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Stage 1", 1, 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
 
 	mock.ExpectQuery("SELECT max_participants FROM competitions").
 		WithArgs(1).
@@ -503,9 +503,7 @@ func TestUpdateStage_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}).AddRow(1, "Stage 1", 1, 1, 8, 4))
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Stage 1", 1, 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
 
 	mock.ExpectQuery("SELECT max_participants FROM competitions").
 		WithArgs(1).
@@ -516,7 +514,7 @@ func TestUpdateStage_Success(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"minimum_participants"}).AddRow(2))
 
 	mock.ExpectExec("UPDATE competition_stages").
-		WithArgs("Stage 1", 1, 1, 8, 4, 1).
+		WithArgs("Stage 1", 1, 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	stage := models.StageDTO{
@@ -569,9 +567,7 @@ func TestChangeCompetitionStatus_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}).AddRow(1, "Stage 1", 1, 1, 8, 4))
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Stage 1", 1, 1, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
 
 	mock.ExpectQuery("SELECT tourney_format_id, min_participants FROM tournament_formats").
 		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "min_participants"}).AddRow(1, 2))
@@ -594,6 +590,45 @@ func TestChangeCompetitionStatus_Success(t *testing.T) {
 	}
 }
 
+// expectNoneDisqualified mocks the lookup of the entrants disqualified from a stage's
+// competition, finding none.
+func expectNoneDisqualified(mock sqlmock.Sqlmock, stageID int) {
+	mock.ExpectQuery("SELECT cp.user_id, cp.team_id\\s+FROM competition_participants cp").
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id"}))
+}
+
+// expectSingleElimFinal mocks a single elimination stage decided by one final that the given
+// entrant won against user 6.
+func expectSingleElimFinal(mock sqlmock.Sqlmock, stageID int, winnerUserID int, winnerTeamID interface{}) {
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.SingleElimination))
+	mock.ExpectQuery("SELECT user_id, team_id, seed FROM stage_participants").
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "seed"}).
+			AddRow(winnerUserID, winnerTeamID, 1).
+			AddRow(6, nil, 2))
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(stageID).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}).
+			AddRow(1, "", 1, true, winnerUserID, winnerTeamID, true, nil, "played", nil, nil, 0, 0, nil).
+			AddRow(1, "", 1, true, 6, nil, false, nil, "played", nil, nil, 0, 0, nil))
+	expectNoneDisqualified(mock, stageID)
+}
+
+// expectThirdPlaceResults mocks the stage results the third place finisher is read from.
+func expectThirdPlaceResults(mock sqlmock.Sqlmock, stageID int, rows *sqlmock.Rows) {
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(stageID).
+		WillReturnRows(rows)
+}
+
+// knockoutResultRows is an empty set of stage results.
+func knockoutResultRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"})
+}
+
 func TestFinishCompetition_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
@@ -606,13 +641,7 @@ func TestFinishCompetition_Success(t *testing.T) {
 		WithArgs(2).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
-	mock.ExpectQuery("SELECT round_id FROM rounds").
-		WithArgs(2).
-		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(3))
-
-	mock.ExpectQuery("SELECT mp.user_id, mp.team_id").
-		WithArgs(3).
-		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id"}).AddRow(5, 7))
+	expectSingleElimFinal(mock, 2, 5, 7)
 
 	mock.ExpectQuery("SELECT name_user FROM users").
 		WithArgs(int64(5)).
@@ -621,6 +650,13 @@ func TestFinishCompetition_Success(t *testing.T) {
 	mock.ExpectQuery("SELECT team_name FROM teams").
 		WithArgs(int64(7)).
 		WillReturnRows(sqlmock.NewRows([]string{"team_name"}).AddRow("Winner Team"))
+	mock.ExpectQuery("SELECT name_user FROM users").
+		WithArgs(int64(6)).
+		WillReturnRows(sqlmock.NewRows([]string{"name_user"}).AddRow("Runner Up"))
+
+	expectThirdPlaceResults(mock, 2, knockoutResultRows().
+		AddRow(1, "", 1, true, 5, 7, true, nil, "played", nil, nil, 0, 0, nil).
+		AddRow(1, "", 1, true, 6, nil, false, nil, "played", nil, nil, 0, 0, nil))
 
 	mock.ExpectExec("UPDATE competitions SET status = 3").
 		WithArgs(1).
@@ -640,6 +676,150 @@ func TestFinishCompetition_Success(t *testing.T) {
 	if !resp["finished"].(bool) {
 		t.Errorf("expected finished true, got %+v", resp)
 	}
+	if _, ok := resp["third_place"]; ok {
+		t.Errorf("expected no third place, got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetPublicCompetitionResults_TwoLeggedFinal(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT status FROM competitions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(3))
+	mock.ExpectQuery("SELECT stage_id FROM competition_stages WHERE competition_id = \\$1 ORDER BY stage_order DESC").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(2))
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.SingleElimination))
+	mock.ExpectQuery("SELECT user_id, team_id, seed FROM stage_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "seed"}).AddRow(5, nil, 1).AddRow(6, nil, 2))
+	// user 5 wins the first leg 3-0 away and loses the second 0-1 at home: 3-1 on aggregate
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}).
+			AddRow(1, "", 1, true, 6, nil, false, 0, "played", nil, nil, 1, 1, "home").
+			AddRow(1, "", 1, true, 5, nil, true, 3, "played", nil, nil, 1, 1, "away").
+			AddRow(2, "", 1, true, 5, nil, false, 0, "played", nil, nil, 2, 1, "home").
+			AddRow(2, "", 1, true, 6, nil, true, 1, "played", nil, nil, 2, 1, "away"))
+	mock.ExpectQuery("SELECT COALESCE\\(away_goals, false\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(false))
+	expectNoneDisqualified(mock, 2)
+	mock.ExpectQuery("SELECT name_user FROM users").
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"name_user"}).AddRow("Aggregate Winner"))
+	mock.ExpectQuery("SELECT name_user FROM users").
+		WithArgs(int64(6)).
+		WillReturnRows(sqlmock.NewRows([]string{"name_user"}).AddRow("Runner Up"))
+	expectThirdPlaceResults(mock, 2, knockoutResultRows().
+		AddRow(1, "", 1, true, 6, nil, false, 0, "played", nil, nil, 1, 1, "home").
+		AddRow(1, "", 1, true, 5, nil, true, 3, "played", nil, nil, 1, 1, "away").
+		AddRow(2, "", 1, true, 5, nil, false, 0, "played", nil, nil, 2, 1, "home").
+		AddRow(2, "", 1, true, 6, nil, true, 1, "played", nil, nil, 2, 1, "away"))
+	mock.ExpectQuery("SELECT COALESCE\\(away_goals, false\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(false))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/public/competitions/1/results", nil)
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	GetPublicCompetitionResults(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if winner, ok := resp["winner"].(map[string]interface{}); !ok || winner["name"] != "Aggregate Winner" {
+		t.Errorf("expected the aggregate winner, got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFinishCompetition_WithThirdPlace(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stage_id FROM competition_stages").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(2))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// the third place match is two-legged: user 7 wins the first leg 1-0 but loses 0-2 on aggregate
+	results := func() *sqlmock.Rows {
+		return knockoutResultRows().
+			AddRow(1, "", 1, true, 5, nil, true, nil, "played", nil, nil, 0, 0, nil).
+			AddRow(1, "", 1, true, 6, nil, false, nil, "played", nil, nil, 0, 0, nil).
+			AddRow(2, "T", 1, true, 7, nil, true, 1, "played", nil, nil, 1, 2, "home").
+			AddRow(2, "T", 1, true, 8, nil, false, 0, "played", nil, nil, 1, 2, "away").
+			AddRow(3, "T", 1, true, 8, nil, true, 2, "played", nil, nil, 2, 2, "home").
+			AddRow(3, "T", 1, true, 7, nil, false, 0, "played", nil, nil, 2, 2, "away")
+	}
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.SingleElimination))
+	mock.ExpectQuery("SELECT user_id, team_id, seed FROM stage_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "seed"}).
+			AddRow(5, nil, 1).AddRow(6, nil, 2).AddRow(7, nil, 3).AddRow(8, nil, 4))
+	expectThirdPlaceResults(mock, 2, results())
+	mock.ExpectQuery("SELECT COALESCE\\(away_goals, false\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(false))
+	expectNoneDisqualified(mock, 2)
+	for _, u := range []struct {
+		id   int
+		name string
+	}{{5, "Winner User"}, {6, "Finalist User"}, {8, "Bronze User"}, {7, "Fourth User"}} {
+		mock.ExpectQuery("SELECT name_user FROM users").
+			WithArgs(int64(u.id)).
+			WillReturnRows(sqlmock.NewRows([]string{"name_user"}).AddRow(u.name))
+	}
+	expectThirdPlaceResults(mock, 2, results())
+	mock.ExpectQuery("SELECT COALESCE\\(away_goals, false\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(false))
+	mock.ExpectQuery("SELECT name_user FROM users").
+		WithArgs(int64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"name_user"}).AddRow("Bronze User"))
+	mock.ExpectExec("UPDATE competitions SET status = 3").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/finish", nil)
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	FinishCompetition(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", rr.Code)
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	third, ok := resp["third_place"].(map[string]interface{})
+	if !ok || third["name"] != "Bronze User" {
+		t.Errorf("expected third place Bronze User, got %+v", resp)
+	}
+	var names []interface{}
+	placements, _ := resp["placements"].([]interface{})
+	for _, p := range placements {
+		names = append(names, p.(map[string]interface{})["name"])
+	}
+	if !reflect.DeepEqual(names, []interface{}{"Winner User", "Finalist User", "Bronze User", "Fourth User"}) {
+		t.Errorf("expected the final placements in order, got %+v", resp["placements"])
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unmet expectations: %v", err)
 	}
@@ -651,9 +831,7 @@ func TestGetStagesByCompetitionID_Empty(t *testing.T) {
 
 	mock.ExpectQuery("SELECT stage_id, stage_name").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{
-			"stage_id", "stage_name", "stage_order", "tourney_format_id", "participants_at_start", "participants_at_end",
-		}))
+		WillReturnRows(sqlmock.NewRows(stageColumns))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/competitions/1/stages", nil)
 	req = muxSetVars(req, map[string]string{"competitionId": "1"})
@@ -680,9 +858,9 @@ func TestGetParticipantsByCompetitionID_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT u.id_user, u.name_user, u.lname1_user").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"id_user", "name_user", "lname1_user"}).
-			AddRow(10, "Alice", "Smith").
-			AddRow(11, "Bob", "Jones"))
+		WillReturnRows(sqlmock.NewRows([]string{"id_user", "name_user", "lname1_user", "disqualified"}).
+			AddRow(10, "Alice", "Smith", false).
+			AddRow(11, "Bob", "Jones", true))
 
 	mock.ExpectQuery("SELECT t.team_id, t.team_name, NULL").
 		WithArgs(1).
@@ -772,13 +950,15 @@ func TestFinishCompetition_NoWinner(t *testing.T) {
 		WithArgs(2).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
-	mock.ExpectQuery("SELECT round_id FROM rounds").
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
 		WithArgs(2).
-		WillReturnRows(sqlmock.NewRows([]string{"round_id"}).AddRow(3))
-
-	mock.ExpectQuery("SELECT mp.user_id, mp.team_id").
-		WithArgs(3).
-		WillReturnError(sql.ErrNoRows)
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.SingleElimination))
+	mock.ExpectQuery("SELECT user_id, team_id, seed FROM stage_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "seed"}).AddRow(5, nil, 1).AddRow(6, nil, 2))
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}))
 
 	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/finish", nil)
 	req = muxSetVars(req, map[string]string{"competitionId": "1"})
@@ -809,10 +989,10 @@ func TestChangeCompetitionStatus_CloseSignup_Success(t *testing.T) {
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{"stage_id"}).AddRow(2))
 
-	mock.ExpectExec("INSERT INTO stage_participants \\(stage_id, user_id\\)").
+	mock.ExpectExec("INSERT INTO stage_participants \\(stage_id, user_id, seed\\)").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	mock.ExpectExec("INSERT INTO stage_participants \\(stage_id, team_id\\)").
+	mock.ExpectExec("INSERT INTO stage_participants \\(stage_id, team_id, seed\\)").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec("UPDATE competitions SET status = .*date_updated = .*WHERE competition_id = .*").
@@ -890,3 +1070,203 @@ func TestChangeCompetitionStatus_CloseSignup_NoStages(t *testing.T) {
 		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
 	}
 }
+
+func TestAddStageToCompetition_SwissWithoutRounds(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stage_id, stage_name").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Swiss", 1, 5, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
+
+	mock.ExpectQuery("SELECT max_participants FROM competitions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"max_participants"}).AddRow(8))
+
+	stage := models.StageDTO{
+		StageName:           "Playoffs",
+		StageOrder:          2,
+		TourneyFormatID:     1,
+		ParticipantsAtStart: 4,
+		ParticipantsAtEnd:   1,
+	}
+	body, _ := json.Marshal(stage)
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/stages", bytes.NewReader(body))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	AddStageToCompetition(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestAddStageToCompetition_GroupsUnevenAdvancement(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stage_id, stage_name").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Groups", 1, 3, 8, 3, nil, "seeded", 2, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
+
+	mock.ExpectQuery("SELECT max_participants FROM competitions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"max_participants"}).AddRow(8))
+
+	stage := models.StageDTO{
+		StageName:           "Playoffs",
+		StageOrder:          2,
+		TourneyFormatID:     1,
+		ParticipantsAtStart: 3,
+		ParticipantsAtEnd:   1,
+	}
+	body, _ := json.Marshal(stage)
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/stages", bytes.NewReader(body))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	AddStageToCompetition(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "divisible by the number of groups") {
+		t.Errorf("unexpected error body: %s", rr.Body.String())
+	}
+}
+
+func TestAddStageToCompetition_InvalidAdvancementMap(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stage_id, stage_name").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Groups", 1, 3, 8, 4, nil, "seeded", 2, "", false, nil, nil, nil, "", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
+
+	mock.ExpectQuery("SELECT max_participants FROM competitions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"max_participants"}).AddRow(8))
+
+	mock.ExpectQuery("SELECT minimum_participants FROM tournament_formats").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"minimum_participants"}).AddRow(2))
+
+	stage := models.StageDTO{
+		StageName:           "Playoffs",
+		StageOrder:          2,
+		TourneyFormatID:     1,
+		ParticipantsAtStart: 4,
+		ParticipantsAtEnd:   1,
+		AdvancementMap:      "A1,B1,A3,B2",
+	}
+	body, _ := json.Marshal(stage)
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/stages", bytes.NewReader(body))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	AddStageToCompetition(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "A3") {
+		t.Errorf("unexpected error body: %s", rr.Body.String())
+	}
+}
+
+func TestAddStageToCompetition_TiebreakersOnKnockout(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stage_id, stage_name").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(stageColumns).AddRow(1, "Groups", 1, 3, 8, 4, nil, "seeded", 1, "", false, nil, nil, nil, "buchholz,wins", false, nil, nil, nil, false, nil, nil, nil, nil, nil, false))
+
+	mock.ExpectQuery("SELECT max_participants FROM competitions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"max_participants"}).AddRow(8))
+
+	mock.ExpectQuery("SELECT minimum_participants FROM tournament_formats").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"minimum_participants"}).AddRow(2))
+
+	stage := models.StageDTO{
+		StageName:           "Playoffs",
+		StageOrder:          2,
+		TourneyFormatID:     1,
+		ParticipantsAtStart: 4,
+		ParticipantsAtEnd:   1,
+		Tiebreakers:         "score_diff",
+	}
+	body, _ := json.Marshal(stage)
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/stages", bytes.NewReader(body))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	AddStageToCompetition(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "tiebreakers can only be set") {
+		t.Errorf("unexpected error body: %s", rr.Body.String())
+	}
+}
+
+func disqualify(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/competitions/1/disqualify", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	DisqualifyParticipant(rr, req)
+	return rr
+}
+
+func TestDisqualifyParticipant_NeedsOneEntrant(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	for _, body := range []string{`{}`, `{"user_id":5,"team_id":3}`} {
+		if rr := disqualify(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 BadRequest, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestDisqualifyParticipant_AlreadyDisqualified(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT disqualified_at IS NOT NULL FROM competition_participants").
+		WithArgs(1, 5, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disqualified"}).AddRow(true))
+	mock.ExpectRollback()
+	if rr := disqualify(`{"user_id":5}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDisqualifyParticipant_Success(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT disqualified_at IS NOT NULL FROM competition_participants").
+		WithArgs(1, nil, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"disqualified"}).AddRow(false))
+	mock.ExpectExec("UPDATE competition_participants SET disqualified_at").
+		WithArgs(1, nil, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT m.match_id").
+		WithArgs(1, nil, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}))
+	mock.ExpectCommit()
+
+	rr := disqualify(`{"team_id":3}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var dq models.Disqualification
+	if err := json.NewDecoder(rr.Body).Decode(&dq); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if dq.TeamID == nil || *dq.TeamID != 3 || len(dq.Walkovers) != 0 {
+		t.Errorf("unexpected response: %+v", dq)
+	}
+}
@@ -13,3 +13,12 @@ func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
 		log.Printf("Failed to encode JSON error response: %v", err)
 	}
 }
+
+// sendJSONErrorCode is sendJSONError with a machine-readable error code next to the message.
+func sendJSONErrorCode(w http.ResponseWriter, message, code string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": message, "code": code}); err != nil {
+		log.Printf("Failed to encode JSON error response: %v", err)
+	}
+}
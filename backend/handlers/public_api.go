@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/Drodrl/competition-engine/controllers"
 	"github.com/Drodrl/competition-engine/models"
 	"github.com/gorilla/mux"
 )
@@ -99,29 +101,31 @@ func GetPublicCompetitionResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get winner info
-	var winnerName, teamName string
-	_ = db.QueryRow(`
-        SELECT u.name_user, t.team_name
-        FROM matches m
-        JOIN rounds r ON m.round_id = r.round_id
-        JOIN match_participants mp ON mp.match_id = m.match_id
-        LEFT JOIN users u ON mp.user_id = u.id_user
-        LEFT JOIN teams t ON mp.team_id = t.team_id
-        WHERE r.stage_id = (
-            SELECT stage_id FROM competition_stages WHERE competition_id = $1 ORDER BY stage_order DESC LIMIT 1
-        )
-        AND mp.is_winner = true
-        ORDER BY m.match_id DESC
-        LIMIT 1
-    `, id).Scan(&winnerName, &teamName)
+	// Get winner info: the last stage's format decides who won it
+	var lastStageID int
+	if err := db.QueryRow(`SELECT stage_id FROM competition_stages WHERE competition_id = $1 ORDER BY stage_order DESC LIMIT 1`, id).Scan(&lastStageID); err != nil {
+		sendJSONError(w, "No stages found for competition", http.StatusBadRequest)
+		return
+	}
+	placements, err := stagePlacements(lastStageID)
+	if err != nil && !errors.Is(err, controllers.ErrStageNotFinished) {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	winner := map[string]interface{}{"name": "", "team_name": ""}
+	if len(placements) > 0 {
+		winner = placements[0]
+	} else {
+		placements = []map[string]interface{}{}
+	}
 
 	resp := map[string]interface{}{
 		"competition_id": id,
-		"winner": map[string]interface{}{
-			"name":      winnerName,
-			"team_name": teamName,
-		},
+		"winner":         winner,
+		"placements":     placements,
+	}
+	if thirdPlace := getThirdPlaceFinisher(lastStageID); thirdPlace != nil {
+		resp["third_place"] = thirdPlace
 	}
 
 	w.Header().Set("Content-Type", "application/json")
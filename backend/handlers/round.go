@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -22,9 +23,9 @@ func GetRoundsByStageID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := db.Query(`
-        SELECT round_id, stage_id, round_number 
-        FROM rounds WHERE stage_id = $1 
-        ORDER BY round_number
+        SELECT round_id, stage_id, round_number, bracket
+        FROM rounds WHERE stage_id = $1
+        ORDER BY round_number, round_id
     `, stageID)
 	if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
@@ -38,7 +39,7 @@ func GetRoundsByStageID(w http.ResponseWriter, r *http.Request) {
 	var rounds []models.StageRound
 	for rows.Next() {
 		var s models.StageRound
-		if err := rows.Scan(&s.RoundID, &s.StageID, &s.RoundNumber); err != nil {
+		if err := rows.Scan(&s.RoundID, &s.StageID, &s.RoundNumber, &s.Bracket); err != nil {
 			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -51,6 +52,114 @@ func GetRoundsByStageID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /api/stages/{stageId}/standings
+func GetStageStandings(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stageID, err := strconv.Atoi(vars["stageId"])
+	if err != nil {
+		sendJSONError(w, "Invalid stage ID", http.StatusBadRequest)
+		return
+	}
+	standings, err := controllers.StageStandings(db, stageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendJSONError(w, "Stage not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, controllers.ErrNoStandings) {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		sendJSONError(w, "Failed to compute standings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(standings); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// GET /api/stages/{stageId}/bracket
+func GetStageBracket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stageID, err := strconv.Atoi(vars["stageId"])
+	if err != nil {
+		sendJSONError(w, "Invalid stage ID", http.StatusBadRequest)
+		return
+	}
+	bracket, err := controllers.StageBracket(db, stageID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bracket); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// GET /api/stages/{stageId}/ladder
+func GetStageLadder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stageID, err := strconv.Atoi(vars["stageId"])
+	if err != nil {
+		sendJSONError(w, "Invalid stage ID", http.StatusBadRequest)
+		return
+	}
+	ladder, err := controllers.StageLadder(db, stageID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ladder); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// POST /api/stages/{stageId}/challenges
+func CreateChallenge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stageID, err := strconv.Atoi(vars["stageId"])
+	if err != nil {
+		sendJSONError(w, "Invalid stage ID", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		ChallengerID int `json:"challenger_id"`
+		ChallengedID int `json:"challenged_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := controllers.Challenge(db, stageID, body.ChallengerID, body.ChallengedID)
+	var chErr *controllers.ChallengeError
+	switch {
+	case errors.As(err, &chErr):
+		// Challenges that only have to wait conflict with the ladder's current state
+		status := http.StatusBadRequest
+		if chErr.Code == controllers.CodeChallengePending || chErr.Code == controllers.CodeCooldown {
+			status = http.StatusConflict
+		}
+		sendJSONErrorCode(w, chErr.Message, chErr.Code, status)
+		return
+	case errors.Is(err, controllers.ErrStageNotFound):
+		sendJSONError(w, "Stage not found", http.StatusNotFound)
+		return
+	case errors.Is(err, controllers.ErrNotLadder):
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(challenge); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
 // GET /api/rounds/{roundId}/matches
 func GetMatchesByRoundID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -62,9 +171,11 @@ func GetMatchesByRoundID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := db.Query(`
-        SELECT match_id, round_id, scheduled_at, completed_at
-        FROM matches
-        WHERE round_id = $1
+        SELECT m.match_id, m.round_id, m.scheduled_at, m.completed_at, m.result_type, COALESCE(r.best_of, cs.best_of, 1), m.leg, m.first_leg_id
+        FROM matches m
+        JOIN rounds r ON m.round_id = r.round_id
+        JOIN competition_stages cs ON cs.stage_id = r.stage_id
+        WHERE m.round_id = $1
     `, roundID)
 	if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
@@ -79,12 +190,20 @@ func GetMatchesByRoundID(w http.ResponseWriter, r *http.Request) {
 	var matches []models.Match
 	for rows.Next() {
 		var m models.Match
-		if err := rows.Scan(&m.MatchID, &m.RoundID, &m.ScheduledAt, &m.CompletedAt); err != nil {
+		if err := rows.Scan(&m.MatchID, &m.RoundID, &m.ScheduledAt, &m.CompletedAt, &m.ResultType, &m.BestOf, &m.Leg, &m.FirstLegID); err != nil {
 			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 		matches = append(matches, m)
 	}
+	games, err := controllers.RoundGames(db, roundID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range matches {
+		matches[i].Games = games[matches[i].MatchID]
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(matches); err != nil {
 		log.Printf("encode error: %v", err)
@@ -92,6 +211,79 @@ func GetMatchesByRoundID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PUT /api/rounds/{roundId}/best-of
+func SetRoundBestOf(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roundID, err := strconv.Atoi(vars["roundId"])
+	if err != nil {
+		sendJSONError(w, "Invalid round ID", http.StatusBadRequest)
+		return
+	}
+	// A null best_of falls back to the stage's series length
+	var body struct {
+		BestOf *int `json:"best_of"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.BestOf != nil {
+		if err := controllers.ValidateBestOf(*body.BestOf); err != nil {
+			sendJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The round's stage must allow series at all, by the same rules as the stage's own best_of
+		stage := models.StageDTO{BestOf: body.BestOf}
+		err := db.QueryRow(`
+            SELECT cs.tourney_format_id, cs.legs
+            FROM rounds r JOIN competition_stages cs ON cs.stage_id = r.stage_id
+            WHERE r.round_id = $1
+        `, roundID).Scan(&stage.TourneyFormatID, &stage.Legs)
+		if errors.Is(err, sql.ErrNoRows) {
+			sendJSONError(w, "Round not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, rule := range []stageRule{ruleHeats, ruleLegs} {
+			if err := rule(stageContext{Stage: stage}); err != nil {
+				sendJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	res, err := db.Exec(`UPDATE rounds SET best_of = $1 WHERE round_id = $2`, body.BestOf, roundID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		sendJSONError(w, "Round not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GET /api/rounds/{roundId}/draw
+func GetRoundDrawAudit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roundID, err := strconv.Atoi(vars["roundId"])
+	if err != nil {
+		sendJSONError(w, "Invalid round ID", http.StatusBadRequest)
+		return
+	}
+	audit, err := controllers.AuditDraw(db, roundID)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(audit); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
 // PUT /api/matches/{matchId}/participants
 func UpdateMatchResult(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -102,31 +294,62 @@ func UpdateMatchResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var results []struct {
-		ParticipantID int  `json:"participant_id"`
-		Score         int  `json:"score"`
-		IsWinner      bool `json:"is_winner"`
-	}
+	var results []controllers.ParticipantResult
 	if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
 		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-
-	for _, res := range results {
-		_, err := db.Exec(`
-            UPDATE match_participants
-            SET score = $1, is_winner = $2
-            WHERE match_id = $3 AND (user_id = $4 OR team_id = $4)
-        `, res.Score, res.IsWinner, matchID, res.ParticipantID)
-		if err != nil {
-			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// Completed matches are changed through PUT /api/matches/{matchId}/correction
+	if err := controllers.UpdateResult(db, matchID, results); err != nil {
+		sendResultError(w, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// PUT /api/matches/{matchId}/correction
+func CorrectMatchResult(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		sendJSONError(w, "Invalid match ID", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Results []controllers.ParticipantResult `json:"results"`
+		Confirm bool                            `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	correction, err := controllers.CorrectResult(db, matchID, body.Results, body.Confirm)
+	var blocked *controllers.CorrectionBlockedError
+	if errors.As(err, &blocked) {
+		// The caller can resend with confirm set to void the listed matches.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": blocked.Error(),
+			"code":    controllers.CodeDownstreamPlayed,
+			"matches": blocked.Played,
+		}); err != nil {
+			log.Printf("encode error: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		sendResultError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(correction); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
 // GET /api/matches/{matchId}/participants
 func GetMatchParticipants(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -138,9 +361,10 @@ func GetMatchParticipants(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := db.Query(`
-        SELECT match_id, user_id, team_id, is_winner, score
+        SELECT match_id, user_id, team_id, is_winner, score, placement, time_ms, side
         FROM match_participants
         WHERE match_id = $1
+        ORDER BY placement NULLS LAST, side = 'away'
     `, matchID)
 	if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
@@ -155,7 +379,7 @@ func GetMatchParticipants(w http.ResponseWriter, r *http.Request) {
 	var partsList []models.MatchParticipant
 	for rows.Next() {
 		var p models.MatchParticipant
-		if err := rows.Scan(&p.MatchID, &p.UserID, &p.TeamID, &p.IsWinner, &p.Score); err != nil {
+		if err := rows.Scan(&p.MatchID, &p.UserID, &p.TeamID, &p.IsWinner, &p.Score, &p.Placement, &p.TimeMs, &p.Side); err != nil {
 			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -178,58 +402,104 @@ func SaveMatchResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var results []struct {
-		ParticipantID int  `json:"participant_id"`
-		Score         *int `json:"score"`
-		IsWinner      bool `json:"is_winner"`
-	}
+	var results []controllers.ParticipantResult
 	if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
 		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	// Draws are only allowed in table formats; see ValidateResult for the other checks. Later
+	// matches of a pre-generated bracket take their entrants from this result, and a winning
+	// ladder challenger moves up
+	if err := controllers.SaveResult(db, matchID, results); err != nil {
+		sendResultError(w, err)
+		return
+	}
 
-	tx, err := db.Begin()
+	w.WriteHeader(http.StatusOK)
+}
+
+// PUT /api/matches/{matchId}/outcome
+func RecordMatchOutcome(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
 	if err != nil {
-		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		sendJSONError(w, "Invalid match ID", http.StatusBadRequest)
 		return
 	}
-	rollback := func() {
-		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
-			log.Printf("rollback error: %v", err)
-		}
+	var outcome controllers.Outcome
+	if err := json.NewDecoder(r.Body).Decode(&outcome); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			rollback()
-			panic(p)
-		}
-	}()
+	if err := controllers.RecordOutcome(db, matchID, outcome); err != nil {
+		sendResultError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
 
-	for _, res := range results {
-		_, err := tx.Exec(`
-            UPDATE match_participants
-            SET score = $1, is_winner = $2
-            WHERE match_id = $3
-              AND (user_id = $4 OR team_id = $4)
-        `, res.Score, res.IsWinner, matchID, res.ParticipantID)
-		if err != nil {
-			rollback()
-			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+// GET /api/matches/{matchId}/games
+func GetMatchGames(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		sendJSONError(w, "Invalid match ID", http.StatusBadRequest)
+		return
 	}
-	_, err = tx.Exec(`UPDATE matches SET completed_at = NOW() WHERE match_id = $1`, matchID)
+	games, err := controllers.MatchGames(db, matchID)
 	if err != nil {
-		rollback()
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := tx.Commit(); err != nil {
-		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(games); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// POST /api/matches/{matchId}/games
+func RecordMatchGame(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		sendJSONError(w, "Invalid match ID", http.StatusBadRequest)
+		return
+	}
+	var results []controllers.ParticipantResult
+	if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	err = controllers.RecordGame(db, matchID, results)
+	switch {
+	case errors.Is(err, controllers.ErrSeriesDecided), errors.Is(err, controllers.ErrGameWinner), errors.Is(err, controllers.ErrNotInMatch):
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		sendResultError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Helper: sendResultError reports a rejected match result with its error code. Results that
+// were already carried forward conflict with the bracket and get 409, as do updates to a match
+// that is already completed.
+func sendResultError(w http.ResponseWriter, err error) {
+	var resErr *controllers.ResultError
+	switch {
+	case errors.As(err, &resErr):
+		status := http.StatusBadRequest
+		if resErr.Code == controllers.CodeResultLocked || resErr.Code == controllers.CodeMatchCompleted {
+			status = http.StatusConflict
+		}
+		sendJSONErrorCode(w, resErr.Message, resErr.Code, status)
+	case errors.Is(err, controllers.ErrMatchNotFound):
+		sendJSONError(w, "Match not found", http.StatusNotFound)
+	default:
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // POST /api/stages/{stageId}/rounds
@@ -242,56 +512,36 @@ func GenerateNextRound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find the latest round number for this stage
-	var lastRoundNumber int
-	if err := db.QueryRow(`SELECT COALESCE(MAX(round_number), 0) FROM rounds WHERE stage_id = $1`, stageID).Scan(&lastRoundNumber); err != nil {
+	// Every match generated so far must be finished
+	unfinished, err := countUnfinishedMatches(stageID)
+	if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Check if all matches in the latest round are finished
-	if lastRoundNumber > 0 {
-		var unfinished int
-		if err := db.QueryRow(`
-            SELECT COUNT(*) FROM matches
-            WHERE round_id = (
-                SELECT round_id FROM rounds WHERE stage_id = $1 AND round_number = $2
-            ) AND completed_at IS NULL
-        `, stageID, lastRoundNumber).Scan(&unfinished); err != nil {
-			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if unfinished > 0 {
-			sendJSONError(w, "All matches in the current round must be finished before generating the next round.", http.StatusBadRequest)
-			return
-		}
+	if unfinished > 0 {
+		sendJSONError(w, "All matches in the current round must be finished before generating the next round.", http.StatusBadRequest)
+		return
 	}
 
-	// look up the stage format
-	var fmtNumber int
-	if err := db.QueryRow(`SELECT tourney_format_id FROM competition_stages WHERE stage_id=$1`, stageID).Scan(&fmtNumber); err != nil {
+	format, err := controllers.StageFormat(db, stageID)
+	if errors.Is(err, controllers.ErrUnsupportedFormat) {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	switch fmtNumber {
-	case 1:
-		if err := controllers.GenerateRoundSingleElim(db, stageID); err != nil {
-			sendJSONError(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	case 2:
-		if err := controllers.GenerateRoundDoubleElim(db, stageID); err != nil {
-			sendJSONError(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	case 3:
-		if err := controllers.GenerateRoundRobin(db, stageID); err != nil {
-			sendJSONError(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	default:
-		sendJSONError(w, "unsupported format", http.StatusBadRequest)
+	finished, err := format.Finished(db, stageID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if finished {
+		sendJSONError(w, "stage is already complete", http.StatusBadRequest)
+		return
+	}
+	if err := format.GenerateNextRound(db, stageID); err != nil {
+		sendJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -331,36 +581,39 @@ func CanGenerateNextRound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find the latest round number for this stage
-	var lastRoundNumber int
-	if err := db.QueryRow(`SELECT COALESCE(MAX(round_number), 0) FROM rounds WHERE stage_id = $1`, stageID).Scan(&lastRoundNumber); err != nil {
+	// Every match generated so far must be finished
+	unfinished, err := countUnfinishedMatches(stageID)
+	if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// If no rounds, allow generation
-	if lastRoundNumber == 0 {
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{"canGenerate": true}); err != nil {
+	if unfinished > 0 {
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"canGenerate": false,
+			"reason":      "All matches in the current round must be finished before generating the next round.",
+		}); err != nil {
 			log.Printf("encode error: %v", err)
 		}
 		return
 	}
 
-	// Check if all matches in the latest round are finished
-	var unfinished int
-	if err := db.QueryRow(`
-        SELECT COUNT(*) FROM matches
-        WHERE round_id = (
-            SELECT round_id FROM rounds WHERE stage_id = $1 AND round_number = $2
-        ) AND completed_at IS NULL
-    `, stageID, lastRoundNumber).Scan(&unfinished); err != nil {
+	format, err := controllers.StageFormat(db, stageID)
+	if errors.Is(err, controllers.ErrUnsupportedFormat) {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
 		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if unfinished > 0 {
+	finished, err := format.Finished(db, stageID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if finished {
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
 			"canGenerate": false,
-			"reason":      "All matches in the current round must be finished before generating the next round.",
+			"reason":      "This stage is already complete.",
 		}); err != nil {
 			log.Printf("encode error: %v", err)
 		}
@@ -371,8 +624,19 @@ func CanGenerateNextRound(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Helper: Count the unplayed matches of a stage, across all of its rounds and brackets
+func countUnfinishedMatches(stageID int) (int, error) {
+	var unfinished int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM matches m
+        JOIN rounds r ON m.round_id = r.round_id
+        WHERE r.stage_id = $1 AND m.completed_at IS NULL
+    `, stageID).Scan(&unfinished)
+	return unfinished, err
+}
+
 // POST /api/stages/{stageId}/advance
-func AdvanceAfterRoundRobin(w http.ResponseWriter, r *http.Request) {
+func AdvanceStage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	stageIDStr := vars["stageId"]
 	stageID, err := strconv.Atoi(stageIDStr)
@@ -397,12 +661,13 @@ func AdvanceAfterRoundRobin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Find next stage (by stage_order)
-	var nextStageID, participantsAtStart int
+	var nextStageID, participantsAtEnd int
+	var advancementMap sql.NullString
 	err = db.QueryRow(`
-        SELECT stage_id, participants_at_start FROM competition_stages
+        SELECT stage_id, (SELECT participants_at_end FROM competition_stages WHERE stage_id = $1), advancement_map FROM competition_stages
         WHERE competition_id = (SELECT competition_id FROM competition_stages WHERE stage_id = $1)
         AND stage_order = (SELECT stage_order FROM competition_stages WHERE stage_id = $1) + 1
-    `, stageID).Scan(&nextStageID, &participantsAtStart)
+    `, stageID).Scan(&nextStageID, &participantsAtEnd, &advancementMap)
 
 	if err == sql.ErrNoRows {
 		// No next stage: mark competition as finished
@@ -423,22 +688,37 @@ func AdvanceAfterRoundRobin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Get top N from this stage
-	top, err := controllers.GetTopNFromPrevRoundRobin(db, nextStageID, participantsAtStart)
-	if err != nil {
+	// 3. Get the top participants_at_end of this stage, ranked by its own format
+	top, err := controllers.GetTopNFromPrevStage(db, nextStageID, participantsAtEnd)
+	if errors.Is(err, controllers.ErrStageNotFinished) {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
 		sendJSONError(w, "Failed to get top participants: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 4. Insert into stage_participants for next stage
-	for _, e := range top {
+	// 4. Seed the advancing entrants across groups
+	var numGroups int
+	if err := db.QueryRow(`SELECT COALESCE(num_groups, 1) FROM competition_stages WHERE stage_id = $1`, stageID).Scan(&numGroups); err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seeded, err := controllers.AdvancementSeeds(top, numGroups, controllers.ParseAdvancementMap(advancementMap.String))
+	if err != nil {
+		sendJSONError(w, "Failed to seed next stage: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 5. Insert into stage_participants for next stage
+	for _, e := range seeded {
 		if e.UserID != nil {
-			if _, err := db.Exec(`INSERT INTO stage_participants (stage_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, nextStageID, *e.UserID); err != nil {
+			if _, err := db.Exec(`INSERT INTO stage_participants (stage_id, user_id, seed) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, nextStageID, *e.UserID, *e.Seed); err != nil {
 				sendJSONError(w, "Failed to insert participant: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
 		} else if e.TeamID != nil {
-			if _, err := db.Exec(`INSERT INTO stage_participants (stage_id, team_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, nextStageID, *e.TeamID); err != nil {
+			if _, err := db.Exec(`INSERT INTO stage_participants (stage_id, team_id, seed) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, nextStageID, *e.TeamID, *e.Seed); err != nil {
 				sendJSONError(w, "Failed to insert participant: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -18,9 +18,9 @@ func TestGetRoundsByStageID_Success(t *testing.T) {
 	defer db.Close()
 	mock.ExpectQuery("SELECT round_id, stage_id, round_number").
 		WithArgs(5).
-		WillReturnRows(sqlmock.NewRows([]string{"round_id", "stage_id", "round_number"}).
-			AddRow(1, 5, 1).
-			AddRow(2, 5, 2))
+		WillReturnRows(sqlmock.NewRows([]string{"round_id", "stage_id", "round_number", "bracket"}).
+			AddRow(1, 5, 1, nil).
+			AddRow(2, 5, 2, nil))
 	req := httptest.NewRequest(http.MethodGet, "/api/stages/5/rounds", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "5"})
 	rr := httptest.NewRecorder()
@@ -64,13 +64,70 @@ func TestGetRoundsByStageID_DBError(t *testing.T) {
 	}
 }
 
+func TestGetStageBracket_Success(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT r.round_id, r.round_number, r.bracket, m.match_id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"round_id", "round_number", "bracket", "match_id", "completed"}).
+			AddRow(10, 1, "W", 100, true).
+			AddRow(10, 1, "W", 101, false).
+			AddRow(11, 2, "W", 102, false))
+	mock.ExpectQuery("SELECT mp.match_id, mp.user_id, mp.team_id, mp.is_winner, mp.score").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "user_id", "team_id", "is_winner", "score"}).
+			AddRow(100, 1, nil, true, 2).
+			AddRow(100, 4, nil, false, 0).
+			AddRow(101, 2, nil, false, nil).
+			AddRow(101, 3, nil, false, nil).
+			AddRow(102, 1, nil, false, nil))
+	mock.ExpectQuery("SELECT s.match_id, s.source_match_id, s.source_outcome").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_match_id", "source_outcome"}).AddRow(102, 101, "W"))
+	req := httptest.NewRequest(http.MethodGet, "/api/stages/1/bracket", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "1"})
+	rr := httptest.NewRecorder()
+	GetStageBracket(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", rr.Code)
+	}
+	var rounds []models.BracketRound
+	if err := json.NewDecoder(rr.Body).Decode(&rounds); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(rounds) != 2 || len(rounds[0].Matches) != 2 || len(rounds[1].Matches) != 1 {
+		t.Fatalf("unexpected bracket: %+v", rounds)
+	}
+	final := rounds[1].Matches[0]
+	if len(final.Participants) != 1 || len(final.Placeholders) != 1 || final.Placeholders[0].Label != "winner of match 101" {
+		t.Errorf("unexpected final: %+v", final)
+	}
+}
+
+func TestGetStageBracket_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodGet, "/api/stages/abc/bracket", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "abc"})
+	rr := httptest.NewRecorder()
+	GetStageBracket(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
 func TestGetMatchesByRoundID_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	mock.ExpectQuery("SELECT match_id, round_id, scheduled_at, completed_at").
+	mock.ExpectQuery("SELECT m.match_id, m.round_id, m.scheduled_at, m.completed_at").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "round_id", "scheduled_at", "completed_at", "result_type", "best_of", "leg", "first_leg_id"}).
+			AddRow(1, 3, nil, nil, "played", 3, nil, nil))
+	mock.ExpectQuery("SELECT g.match_id, g.game_number").
 		WithArgs(3).
-		WillReturnRows(sqlmock.NewRows([]string{"match_id", "round_id", "scheduled_at", "completed_at"}).
-			AddRow(1, 3, nil, nil))
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "game_number", "user_id", "team_id", "score", "is_winner"}).
+			AddRow(1, 1, 5, nil, 11, true).
+			AddRow(1, 1, 6, nil, 7, false))
 	req := httptest.NewRequest(http.MethodGet, "/api/rounds/3/matches", nil)
 	req = muxSetVars(req, map[string]string{"roundId": "3"})
 	rr := httptest.NewRecorder()
@@ -82,9 +139,12 @@ func TestGetMatchesByRoundID_Success(t *testing.T) {
 	if err := json.NewDecoder(rr.Body).Decode(&matches); err != nil {
 		t.Fatalf("decode error: %v", err)
 	}
-	if len(matches) != 1 || matches[0].MatchID != 1 {
+	if len(matches) != 1 || matches[0].MatchID != 1 || matches[0].BestOf != 3 {
 		t.Errorf("unexpected matches: %+v", matches)
 	}
+	if games := matches[0].Games; len(games) != 1 || len(games[0].Results) != 2 || !games[0].Results[0].IsWinner {
+		t.Errorf("unexpected games: %+v", matches[0].Games)
+	}
 }
 
 func TestGetMatchesByRoundID_BadID(t *testing.T) {
@@ -114,12 +174,53 @@ func TestGetMatchesByRoundID_DBError(t *testing.T) {
 	}
 }
 
+func matchStateRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"stage_id", "tourney_format_id", "completed", "pending", "downstream", "stage_advanced", "leg"})
+}
+
+// expectResultChecks mocks the lookups ValidateResult makes for match 2: its format and state,
+// and its participants (users) with no result stored yet.
+func expectResultChecks(mock sqlmock.Sqlmock, formatID int, pending, advanced bool, userIDs ...int) {
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, formatID, advanced, pending, advanced, false, 0))
+	rows := sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"})
+	for _, id := range userIDs {
+		rows.AddRow(id, nil, false, nil, nil, nil)
+	}
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(rows)
+}
+
+// expectNothingCarried mocks carrying a result that fills no bracket slots and is not a ladder
+// challenge.
+func expectNothingCarried(mock sqlmock.Sqlmock, matchID int) {
+	mock.ExpectQuery("SELECT match_id, source_outcome FROM match_slots").
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "source_outcome"}))
+	mock.ExpectQuery("SELECT sp.stage_id, sp.ladder_position, mp.is_winner").
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "ladder_position", "is_winner"}))
+	expectNoTie(mock, matchID)
+}
+
+// expectNoTie mocks the leg lookup of a match that is not part of a two-legged tie.
+func expectNoTie(mock sqlmock.Sqlmock, matchID int) {
+	mock.ExpectQuery("SELECT r.stage_id, m.round_id, COALESCE\\(m.leg, 0\\)").
+		WithArgs(matchID).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_id", "leg", "first_leg_id"}).AddRow(1, 1, 0, 0))
+}
+
 func TestUpdateMatchResult_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
+	mock.ExpectBegin()
+	expectResultChecks(mock, 1, false, false, 5, 6)
 	mock.ExpectExec("UPDATE match_participants").
-		WithArgs(10, true, 2, 5).
+		WithArgs(10, true, nil, nil, 2, 5).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 	body := `[{"participant_id":5,"score":10,"is_winner":true}]`
 	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/participants", bytes.NewReader([]byte(body)))
 	req = muxSetVars(req, map[string]string{"matchId": "2"})
@@ -128,6 +229,42 @@ func TestUpdateMatchResult_Success(t *testing.T) {
 	if rr.Code != http.StatusOK {
 		t.Errorf("expected 200 OK, got %d", rr.Code)
 	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpdateMatchResult_Completed(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, 1, true, false, false, false, 0))
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, true, 10, nil, nil).
+			AddRow(6, nil, false, 4, nil, nil))
+	mock.ExpectRollback()
+	body := `[{"participant_id":6,"score":12,"is_winner":true},{"participant_id":5,"score":10,"is_winner":false}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/participants", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	UpdateMatchResult(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %d", rr.Code)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["code"] != "match_completed" {
+		t.Errorf("expected code %q, got %q (%s)", "match_completed", resp["code"], resp["message"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
 }
 
 func TestUpdateMatchResult_BadID(t *testing.T) {
@@ -157,9 +294,12 @@ func TestUpdateMatchResult_BadJSON(t *testing.T) {
 func TestUpdateMatchResult_DBError(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
+	mock.ExpectBegin()
+	expectResultChecks(mock, 1, false, false, 5, 6)
 	mock.ExpectExec("UPDATE match_participants").
-		WithArgs(10, true, 2, 5).
+		WithArgs(10, true, nil, nil, 2, 5).
 		WillReturnError(errors.New("db fail"))
+	mock.ExpectRollback()
 	body := `[{"participant_id":5,"score":10,"is_winner":true}]`
 	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/participants", bytes.NewReader([]byte(body)))
 	req = muxSetVars(req, map[string]string{"matchId": "2"})
@@ -175,8 +315,8 @@ func TestGetMatchParticipants_Success(t *testing.T) {
 	defer db.Close()
 	mock.ExpectQuery("SELECT match_id, user_id, team_id, is_winner, score").
 		WithArgs(3).
-		WillReturnRows(sqlmock.NewRows([]string{"match_id", "user_id", "team_id", "is_winner", "score"}).
-			AddRow(3, 1, nil, true, 10))
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "user_id", "team_id", "is_winner", "score", "placement", "time_ms", "side"}).
+			AddRow(3, 1, nil, true, 10, nil, nil, "home"))
 	req := httptest.NewRequest(http.MethodGet, "/api/matches/3/participants", nil)
 	req = muxSetVars(req, map[string]string{"matchId": "3"})
 	rr := httptest.NewRecorder()
@@ -188,7 +328,7 @@ func TestGetMatchParticipants_Success(t *testing.T) {
 	if err := json.NewDecoder(rr.Body).Decode(&parts); err != nil {
 		t.Fatalf("decode error: %v", err)
 	}
-	if len(parts) != 1 || parts[0].MatchID != 3 {
+	if len(parts) != 1 || parts[0].MatchID != 3 || parts[0].Side == nil || *parts[0].Side != "home" {
 		t.Errorf("unexpected participants: %+v", parts)
 	}
 }
@@ -224,12 +364,14 @@ func TestSaveMatchResults_Success(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	mock.ExpectBegin()
+	expectResultChecks(mock, 1, false, false, 5, 6)
 	mock.ExpectExec("UPDATE match_participants").
-		WithArgs(10, true, 2, 5).
+		WithArgs(10, true, nil, nil, 2, 5).
 		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec("UPDATE matches SET completed_at = NOW\\(\\) WHERE match_id = \\$1").
+	mock.ExpectExec("UPDATE matches SET completed_at = NOW\\(\\), result_type = 'played' WHERE match_id = \\$1").
 		WithArgs(2).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectNothingCarried(mock, 2)
 	mock.ExpectCommit()
 	body := `[{"participant_id":5,"score":10,"is_winner":true}]`
 	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/results", bytes.NewReader([]byte(body)))
@@ -241,6 +383,118 @@ func TestSaveMatchResults_Success(t *testing.T) {
 	}
 }
 
+func TestSaveMatchResults_Draw(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	expectResultChecks(mock, 3, false, false, 5, 6)
+	mock.ExpectExec("UPDATE match_participants").
+		WithArgs(1, false, nil, nil, 2, 5).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE match_participants").
+		WithArgs(1, false, nil, nil, 2, 6).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE matches SET completed_at = NOW\\(\\), result_type = 'played' WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectNothingCarried(mock, 2)
+	mock.ExpectCommit()
+	body := `[{"participant_id":5,"score":1,"is_winner":false},{"participant_id":6,"score":1,"is_winner":false}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/results", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	SaveMatchResults(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSaveMatchResults_DrawInKnockout(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	expectResultChecks(mock, 1, false, false, 5, 6)
+	mock.ExpectRollback()
+	body := `[{"participant_id":5,"score":1,"is_winner":false},{"participant_id":6,"score":1,"is_winner":false}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/results", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	SaveMatchResults(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+// saveResult posts body as the result of match 2 and returns the response.
+func saveResult(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/results", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	SaveMatchResults(rr, req)
+	return rr
+}
+
+func TestSaveMatchResults_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		advanced bool
+		body     string
+		status   int
+		code     string
+	}{
+		{"unknown participant", false, `[{"participant_id":9,"score":2,"is_winner":true}]`, http.StatusBadRequest, "participant_not_in_match"},
+		{"two winners", false, `[{"participant_id":5,"is_winner":true},{"participant_id":6,"is_winner":true}]`, http.StatusBadRequest, "multiple_winners"},
+		{"winner scored less", false, `[{"participant_id":5,"score":1,"is_winner":true},{"participant_id":6,"score":3,"is_winner":false}]`, http.StatusBadRequest, "winner_score_mismatch"},
+		{"already advanced", true, `[{"participant_id":5,"score":3,"is_winner":true}]`, http.StatusConflict, "result_locked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+				WithArgs(2).
+				WillReturnRows(matchStateRows().AddRow(1, 1, tt.advanced, false, tt.advanced, false, 0))
+			mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+					AddRow(5, nil, false, nil, nil, nil).
+					AddRow(6, nil, false, nil, nil, nil))
+			mock.ExpectRollback()
+			rr := saveResult(tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rr.Code)
+			}
+			var resp map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp["code"] != tt.code {
+				t.Errorf("expected code %q, got %q (%s)", tt.code, resp["code"], resp["message"])
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestSaveMatchResults_MatchNotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	if rr := saveResult(`[{"participant_id":5,"is_winner":true}]`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 NotFound, got %d", rr.Code)
+	}
+}
+
 func TestSaveMatchResults_BadID(t *testing.T) {
 	db, _ := setupMockDB(t)
 	defer db.Close()
@@ -269,8 +523,9 @@ func TestSaveMatchResults_DBError(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	mock.ExpectBegin()
+	expectResultChecks(mock, 1, false, false, 5, 6)
 	mock.ExpectExec("UPDATE match_participants").
-		WithArgs(10, true, 2, 5).
+		WithArgs(10, true, nil, nil, 2, 5).
 		WillReturnError(errors.New("db fail"))
 	mock.ExpectRollback()
 	body := `[{"participant_id":5,"score":10,"is_winner":true}]`
@@ -283,6 +538,123 @@ func TestSaveMatchResults_DBError(t *testing.T) {
 	}
 }
 
+func TestRecordMatchGame_NoWinner(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	body := `[{"participant_id":5,"score":1,"is_winner":false},{"participant_id":6,"score":1,"is_winner":false}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/matches/2/games", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	RecordMatchGame(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestRecordMatchGame_MatchNotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	body := `[{"participant_id":5,"score":11,"is_winner":true}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/matches/2/games", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	RecordMatchGame(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 NotFound, got %d", rr.Code)
+	}
+}
+
+func TestRecordMatchGame_NotReady(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	expectResultChecks(mock, 1, true, false, 5, 6)
+	mock.ExpectRollback()
+	body := `[{"participant_id":5,"score":11,"is_winner":true},{"participant_id":6,"score":7,"is_winner":false}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/matches/2/games", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	RecordMatchGame(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["code"] != "match_not_ready" {
+		t.Errorf("expected code %q, got %q (%s)", "match_not_ready", resp["code"], resp["message"])
+	}
+}
+
+func TestSetRoundBestOf_EvenLength(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/rounds/3/best-of", bytes.NewReader([]byte(`{"best_of":4}`)))
+	req = muxSetVars(req, map[string]string{"roundId": "3"})
+	rr := httptest.NewRecorder()
+	SetRoundBestOf(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestSetRoundBestOf_Success(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT cs.tourney_format_id, cs.legs").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "legs"}).AddRow(models.SingleElimination, nil))
+	mock.ExpectExec("UPDATE rounds SET best_of = \\$1 WHERE round_id = \\$2").
+		WithArgs(5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	req := httptest.NewRequest(http.MethodPut, "/api/rounds/3/best-of", bytes.NewReader([]byte(`{"best_of":5}`)))
+	req = muxSetVars(req, map[string]string{"roundId": "3"})
+	rr := httptest.NewRecorder()
+	SetRoundBestOf(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSetRoundBestOf_StageRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		formatID int
+		legs     interface{}
+	}{
+		{"heats", models.Heats, nil},
+		{"two-legged ties", models.SingleElimination, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := setupMockDB(t)
+			defer db.Close()
+			mock.ExpectQuery("SELECT cs.tourney_format_id, cs.legs").
+				WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "legs"}).AddRow(tt.formatID, tt.legs))
+			req := httptest.NewRequest(http.MethodPut, "/api/rounds/3/best-of", bytes.NewReader([]byte(`{"best_of":3}`)))
+			req = muxSetVars(req, map[string]string{"roundId": "3"})
+			rr := httptest.NewRecorder()
+			SetRoundBestOf(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
 func TestGenerateNextRound_BadID(t *testing.T) {
 	db, _ := setupMockDB(t)
 	defer db.Close()
@@ -367,9 +739,15 @@ func TestCanGenerateNextRound_NoRounds(t *testing.T) {
 	mock.ExpectQuery("SELECT status FROM competitions").
 		WithArgs(2).
 		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(2))
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.RoundRobin))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COUNT\\(\\*\\) FILTER").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "open"}).AddRow(0, 0))
 	req := httptest.NewRequest(http.MethodGet, "/api/stages/1/can-generate-next-round", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
 	rr := httptest.NewRecorder()
@@ -388,11 +766,8 @@ func TestCanGenerateNextRound_UnfinishedMatches(t *testing.T) {
 	mock.ExpectQuery("SELECT status FROM competitions").
 		WithArgs(2).
 		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(2))
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(1))
-	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches").
-		WithArgs(1, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
 	req := httptest.NewRequest(http.MethodGet, "/api/stages/1/can-generate-next-round", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
@@ -403,19 +778,19 @@ func TestCanGenerateNextRound_UnfinishedMatches(t *testing.T) {
 	}
 }
 
-func TestAdvanceAfterRoundRobin_BadID(t *testing.T) {
+func TestAdvanceStage_BadID(t *testing.T) {
 	db, _ := setupMockDB(t)
 	defer db.Close()
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/abc/advance", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "abc"})
 	rr := httptest.NewRecorder()
-	AdvanceAfterRoundRobin(rr, req)
+	AdvanceStage(rr, req)
 	if rr.Code != http.StatusBadRequest {
 		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
 	}
 }
 
-func TestAdvanceAfterRoundRobin_UnfinishedMatches(t *testing.T) {
+func TestAdvanceStage_UnfinishedMatches(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
@@ -424,19 +799,19 @@ func TestAdvanceAfterRoundRobin_UnfinishedMatches(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/advance", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
 	rr := httptest.NewRecorder()
-	AdvanceAfterRoundRobin(rr, req)
+	AdvanceStage(rr, req)
 	if rr.Code != http.StatusBadRequest {
 		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
 	}
 }
 
-func TestAdvanceAfterRoundRobin_NoNextStage_FinishCompetition(t *testing.T) {
+func TestAdvanceStage_NoNextStage_FinishCompetition(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-	mock.ExpectQuery("SELECT stage_id, participants_at_start FROM competition_stages").
+	mock.ExpectQuery("SELECT stage_id, \\(SELECT participants_at_end FROM competition_stages WHERE stage_id = \\$1\\), advancement_map FROM competition_stages").
 		WithArgs(1).
 		WillReturnError(sql.ErrNoRows)
 	mock.ExpectExec("UPDATE competitions SET status = 3").
@@ -445,34 +820,34 @@ func TestAdvanceAfterRoundRobin_NoNextStage_FinishCompetition(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/advance", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
 	rr := httptest.NewRecorder()
-	AdvanceAfterRoundRobin(rr, req)
+	AdvanceStage(rr, req)
 	if rr.Code != http.StatusOK {
 		t.Errorf("expected 200 OK, got %d", rr.Code)
 	}
 }
 
-func TestAdvanceAfterRoundRobin_DBError(t *testing.T) {
+func TestAdvanceStage_DBError(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
 	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-	mock.ExpectQuery("SELECT stage_id, participants_at_start FROM competition_stages").
+	mock.ExpectQuery("SELECT stage_id, \\(SELECT participants_at_end FROM competition_stages WHERE stage_id = \\$1\\), advancement_map FROM competition_stages").
 		WithArgs(1).
 		WillReturnError(errors.New("db fail"))
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/advance", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
 	rr := httptest.NewRecorder()
-	AdvanceAfterRoundRobin(rr, req)
+	AdvanceStage(rr, req)
 	if rr.Code != http.StatusInternalServerError {
 		t.Errorf("expected 500 InternalServerError, got %d", rr.Code)
 	}
 }
 
-func TestGenerateNextRound_DBErrorOnLastRound(t *testing.T) {
+func TestGenerateNextRound_DBErrorOnUnfinishedCount(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
 		WillReturnError(errors.New("db fail"))
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/rounds", nil)
@@ -487,11 +862,8 @@ func TestGenerateNextRound_DBErrorOnLastRound(t *testing.T) {
 func TestGenerateNextRound_UnfinishedMatches(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(2))
-	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches").
-		WithArgs(1, 2).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/rounds", nil)
 	req = muxSetVars(req, map[string]string{"stageId": "1"})
@@ -505,9 +877,9 @@ func TestGenerateNextRound_UnfinishedMatches(t *testing.T) {
 func TestGenerateNextRound_DBErrorOnFormat(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
 		WithArgs(1).
 		WillReturnError(errors.New("db fail"))
@@ -523,9 +895,9 @@ func TestGenerateNextRound_DBErrorOnFormat(t *testing.T) {
 func TestGenerateNextRound_UnsupportedFormat(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
-	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(round_number\\), 0\\) FROM rounds WHERE stage_id = \\$1").
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(99))
@@ -537,3 +909,386 @@ func TestGenerateNextRound_UnsupportedFormat(t *testing.T) {
 		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
 	}
 }
+
+func TestGenerateNextRound_StageComplete(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM matches m").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT tourney_format_id FROM competition_stages WHERE stage_id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id"}).AddRow(models.RoundRobin))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COUNT\\(\\*\\) FILTER").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "open"}).AddRow(6, 0))
+	req := httptest.NewRequest(http.MethodPost, "/api/stages/1/rounds", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "1"})
+	rr := httptest.NewRecorder()
+	GenerateNextRound(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetRoundDrawAudit_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodGet, "/api/rounds/abc/draw", nil)
+	req = muxSetVars(req, map[string]string{"roundId": "abc"})
+	rr := httptest.NewRecorder()
+	GetRoundDrawAudit(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestGetRoundDrawAudit_NotRandom(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT r.stage_id, r.round_number, r.rng_seed, r.draw_entrants, cs.tourney_format_id").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_number", "rng_seed", "draw_entrants", "tourney_format_id", "num_groups", "legs", "heat_size", "advance_per_heat"}).AddRow(1, 1, nil, nil, 1, 1, 1, 0, 0))
+	req := httptest.NewRequest(http.MethodGet, "/api/rounds/3/draw", nil)
+	req = muxSetVars(req, map[string]string{"roundId": "3"})
+	rr := httptest.NewRecorder()
+	GetRoundDrawAudit(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestGetStageStandings_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodGet, "/api/stages/abc/standings", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "abc"})
+	rr := httptest.NewRecorder()
+	GetStageStandings(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestGetStageStandings_NotFound(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT tourney_format_id, COALESCE\\(num_groups, 1\\) FROM competition_stages").
+		WithArgs(9).
+		WillReturnError(sql.ErrNoRows)
+	req := httptest.NewRequest(http.MethodGet, "/api/stages/9/standings", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "9"})
+	rr := httptest.NewRecorder()
+	GetStageStandings(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 NotFound, got %d", rr.Code)
+	}
+}
+
+func TestGetStageStandings_Success(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectQuery("SELECT tourney_format_id, COALESCE\\(num_groups, 1\\) FROM competition_stages").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"tourney_format_id", "num_groups"}).AddRow(3, 1))
+	mock.ExpectQuery("SELECT user_id, team_id, group_number FROM stage_participants").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "group_number"}).AddRow(1, nil, nil).AddRow(2, nil, nil))
+	mock.ExpectQuery("SELECT COALESCE\\(points_win, 3\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"points_win", "points_draw", "points_loss", "tiebreakers", "forfeit_points", "awarded_score", "retired_as_forfeit"}).AddRow(3, 1, 0, "", 0, nil, false))
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}).
+			AddRow(10, "", 1, true, 1, nil, false, 0, "played", nil, nil, 0, 0, nil).AddRow(10, "", 1, true, 2, nil, true, 2, "played", nil, nil, 0, 0, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stages/1/standings", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "1"})
+	rr := httptest.NewRecorder()
+	GetStageStandings(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var standings []models.Standing
+	if err := json.Unmarshal(rr.Body.Bytes(), &standings); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(standings) != 2 || *standings[0].UserID != 2 || standings[0].Rank != 1 || standings[1].ScoreDiff != -2 {
+		t.Errorf("unexpected standings: %+v", standings)
+	}
+}
+
+// expectCorrection mocks CorrectResult reading match 2 (user 5 beat user 6) and storing user 6
+// as the winner of a played match, up to loading the stage with the given later match, 5 against 7.
+func expectCorrection(mock sqlmock.Sqlmock, laterCompleted bool) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, 1, true, false, true, false, 0))
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, true, 2, nil, nil).
+			AddRow(6, nil, false, 1, nil, nil))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(1, false, nil, nil, 2, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(3, true, nil, nil, 2, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM match_games WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE matches SET result_type = 'played' WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}).
+			AddRow(2, "", 1, true, 5, nil, false, 1, "played", nil, nil, 0, 0, nil).
+			AddRow(2, "", 1, true, 6, nil, true, 3, "played", nil, nil, 0, 0, nil).
+			AddRow(3, "", 2, laterCompleted, 5, nil, laterCompleted, nil, "played", nil, nil, 0, 0, nil).
+			AddRow(3, "", 2, laterCompleted, 7, nil, false, nil, "played", nil, nil, 0, 0, nil))
+}
+
+func correctResult(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/correction", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	CorrectMatchResult(rr, req)
+	return rr
+}
+
+const correctionBody = `{"results":[{"participant_id":5,"score":1,"is_winner":false},{"participant_id":6,"score":3,"is_winner":true}]}`
+
+func TestCorrectMatchResult_SwapsUnplayedMatch(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	expectCorrection(mock, false)
+	mock.ExpectExec("UPDATE match_participants SET user_id").
+		WithArgs(6, nil, 3, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := correctResult(correctionBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var correction models.Correction
+	if err := json.NewDecoder(rr.Body).Decode(&correction); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(correction.Swapped) != 1 || correction.Swapped[0] != 3 {
+		t.Errorf("expected match 3 to be swapped, got %+v", correction)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCorrectMatchResult_BlockedByPlayedMatch(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	expectCorrection(mock, true)
+	mock.ExpectRollback()
+
+	rr := correctResult(correctionBody)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %d", rr.Code)
+	}
+	var resp struct {
+		Code    string `json:"code"`
+		Matches []int  `json:"matches"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Code != "downstream_played" || len(resp.Matches) != 1 || resp.Matches[0] != 3 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCorrectMatchResult_WalkoverBecomesPlayed(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, 1, true, false, false, false, 0))
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, true, nil, nil, nil).
+			AddRow(6, nil, false, nil, nil, nil))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(2, true, nil, nil, 2, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(0, false, nil, nil, 2, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM match_games WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE matches SET result_type = 'played' WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := correctResult(`{"results":[{"participant_id":5,"score":2,"is_winner":true},{"participant_id":6,"score":0,"is_winner":false}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCorrectMatchResult_LevelledTieAddsDecider(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	// Match 2 is the second leg of the tie opened by match 1, which was drawn 1-1; correcting
+	// the second leg from 2-0 to 1-1 leaves the tie level.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, 1, true, false, false, false, 2))
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, true, 2, nil, nil).
+			AddRow(6, nil, false, 0, nil, nil))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(1, false, nil, nil, 2, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(1, false, nil, nil, 2, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM match_games WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE matches SET result_type = 'played' WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT r.stage_id, m.round_id, COALESCE\\(m.leg, 0\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"stage_id", "round_id", "leg", "first_leg_id"}).AddRow(1, 4, 2, 1))
+	mock.ExpectQuery("SELECT m.match_id, COALESCE\\(r.bracket, ''\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id", "bracket", "round_number", "completed", "user_id", "team_id", "is_winner", "score", "result_type", "placement", "time_ms", "leg", "first_leg_id", "side"}).
+			AddRow(1, "", 1, true, 5, nil, false, 1, "played", nil, nil, 1, 1, "away").
+			AddRow(1, "", 1, true, 6, nil, false, 1, "played", nil, nil, 1, 1, "home").
+			AddRow(2, "", 1, true, 5, nil, false, 1, "played", nil, nil, 2, 1, "home").
+			AddRow(2, "", 1, true, 6, nil, false, 1, "played", nil, nil, 2, 1, "away"))
+	mock.ExpectQuery("SELECT COALESCE\\(away_goals, false\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"away_goals"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO matches").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"match_id"}).AddRow(3))
+	mock.ExpectExec("INSERT INTO match_participants").
+		WithArgs(3, 5, nil, nil, 6, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE matches SET leg = \\$1, first_leg_id = \\$2").
+		WithArgs(3, 1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := correctResult(`{"results":[{"participant_id":5,"score":1,"is_winner":false},{"participant_id":6,"score":1,"is_winner":false}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCorrectMatchResult_DoubleForfeitCarriedForward(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT r.stage_id, cs.tourney_format_id").
+		WithArgs(2).
+		WillReturnRows(matchStateRows().AddRow(1, 1, true, false, true, false, 0))
+	mock.ExpectQuery("SELECT user_id, team_id, is_winner, score, placement, time_ms FROM match_participants").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "team_id", "is_winner", "score", "placement", "time_ms"}).
+			AddRow(5, nil, false, nil, nil, nil).
+			AddRow(6, nil, false, nil, nil, nil))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(1, true, nil, nil, 2, 5, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE match_participants SET score").
+		WithArgs(0, false, nil, nil, 2, 6, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM match_games WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE matches SET result_type = 'played' WHERE match_id = \\$1").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	rr := correctResult(`{"results":[{"participant_id":5,"score":1,"is_winner":true},{"participant_id":6,"score":0,"is_winner":false}]}`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["code"] != "result_locked" {
+		t.Errorf("expected code %q, got %q (%s)", "result_locked", resp["code"], resp["message"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCorrectMatchResult_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/abc/correction", nil)
+	req = muxSetVars(req, map[string]string{"matchId": "abc"})
+	rr := httptest.NewRecorder()
+	CorrectMatchResult(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestRecordMatchOutcome_UnknownType(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/2/outcome", bytes.NewReader([]byte(`{"result_type":"abandoned"}`)))
+	req = muxSetVars(req, map[string]string{"matchId": "2"})
+	rr := httptest.NewRecorder()
+	RecordMatchOutcome(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp["code"] != "unknown_result_type" {
+		t.Errorf("expected unknown_result_type, got %q", resp["code"])
+	}
+}
+
+func TestRecordMatchOutcome_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/matches/abc/outcome", nil)
+	req = muxSetVars(req, map[string]string{"matchId": "abc"})
+	rr := httptest.NewRecorder()
+	RecordMatchOutcome(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type seedEntry struct {
+	UserID *int `json:"user_id"`
+	TeamID *int `json:"team_id"`
+	Seed   *int `json:"seed"`
+}
+
+// GET /api/competitions/{competitionId}/seeds
+func GetCompetitionSeeds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	competitionID, err := strconv.Atoi(vars["competitionId"])
+	if err != nil {
+		sendJSONError(w, "Invalid competition ID", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.Query(`
+        SELECT user_id, team_id, seed
+        FROM competition_participants
+        WHERE competition_id = $1
+        ORDER BY seed NULLS LAST
+    `, competitionID)
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close error: %v", err)
+		}
+	}()
+	var seeds []seedEntry
+	for rows.Next() {
+		var s seedEntry
+		if err := rows.Scan(&s.UserID, &s.TeamID, &s.Seed); err != nil {
+			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		seeds = append(seeds, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(seeds); err != nil {
+		log.Printf("encode error: %v", err)
+	}
+}
+
+// PUT /api/competitions/{competitionId}/seeds
+func SetCompetitionSeeds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	competitionID, err := strconv.Atoi(vars["competitionId"])
+	if err != nil {
+		sendJSONError(w, "Invalid competition ID", http.StatusBadRequest)
+		return
+	}
+	saveSeeds(w, r, "competition_participants", "competition_id", competitionID)
+}
+
+// PUT /api/stages/{stageId}/seeds
+func SetStageSeeds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stageID, err := strconv.Atoi(vars["stageId"])
+	if err != nil {
+		sendJSONError(w, "Invalid stage ID", http.StatusBadRequest)
+		return
+	}
+	saveSeeds(w, r, "stage_participants", "stage_id", stageID)
+}
+
+// Helper: Validate a seed list and write it to the given participants table.
+// table and scopeColumn are always constants from the callers above.
+func saveSeeds(w http.ResponseWriter, r *http.Request, table, scopeColumn string, scopeID int) {
+	var entries []seedEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		sendJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateSeeds(entries); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rollback := func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("rollback error: %v", err)
+		}
+	}
+
+	// Clear existing seeds first so that swapping two seeds never trips a uniqueness check.
+	if _, err := tx.Exec(`UPDATE `+table+` SET seed = NULL WHERE `+scopeColumn+` = $1`, scopeID); err != nil {
+		rollback()
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, e := range entries {
+		var res sql.Result
+		if e.UserID != nil {
+			res, err = tx.Exec(`UPDATE `+table+` SET seed = $1 WHERE `+scopeColumn+` = $2 AND user_id = $3`, e.Seed, scopeID, *e.UserID)
+		} else {
+			res, err = tx.Exec(`UPDATE `+table+` SET seed = $1 WHERE `+scopeColumn+` = $2 AND team_id = $3`, e.Seed, scopeID, *e.TeamID)
+		}
+		if err != nil {
+			rollback()
+			sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			rollback()
+			sendJSONError(w, "Seeded participant is not registered", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		sendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Helper: Each entry names exactly one participant and seeds are positive and unique
+func validateSeeds(entries []seedEntry) error {
+	used := make(map[int]bool)
+	for _, e := range entries {
+		if (e.UserID == nil) == (e.TeamID == nil) {
+			return errors.New("each seed must reference either a user_id or a team_id")
+		}
+		if e.Seed == nil {
+			continue
+		}
+		if *e.Seed < 1 {
+			return errors.New("seeds must be positive")
+		}
+		if used[*e.Seed] {
+			return errors.New("seed " + strconv.Itoa(*e.Seed) + " is assigned more than once")
+		}
+		used[*e.Seed] = true
+	}
+	return nil
+}
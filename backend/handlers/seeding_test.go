@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetCompetitionSeeds_Success(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE competition_participants SET seed = NULL WHERE competition_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE competition_participants SET seed = \\$1 WHERE competition_id = \\$2 AND user_id = \\$3").
+		WithArgs(1, 1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE competition_participants SET seed = \\$1 WHERE competition_id = \\$2 AND user_id = \\$3").
+		WithArgs(2, 1, 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := `[{"user_id":10,"seed":1},{"user_id":11,"seed":2}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/competitions/1/seeds", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	SetCompetitionSeeds(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSetCompetitionSeeds_DuplicateSeed(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	body := `[{"user_id":10,"seed":1},{"user_id":11,"seed":1}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/competitions/1/seeds", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"competitionId": "1"})
+	rr := httptest.NewRecorder()
+	SetCompetitionSeeds(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
+
+func TestSetStageSeeds_UnknownParticipant(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE stage_participants SET seed = NULL WHERE stage_id = \\$1").
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE stage_participants SET seed = \\$1 WHERE stage_id = \\$2 AND team_id = \\$3").
+		WithArgs(1, 4, 99).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	body := `[{"team_id":99,"seed":1}]`
+	req := httptest.NewRequest(http.MethodPut, "/api/stages/4/seeds", bytes.NewReader([]byte(body)))
+	req = muxSetVars(req, map[string]string{"stageId": "4"})
+	rr := httptest.NewRecorder()
+	SetStageSeeds(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSetStageSeeds_BadID(t *testing.T) {
+	db, _ := setupMockDB(t)
+	defer db.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/stages/abc/seeds", nil)
+	req = muxSetVars(req, map[string]string{"stageId": "abc"})
+	rr := httptest.NewRecorder()
+	SetStageSeeds(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 BadRequest, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Drodrl/competition-engine/controllers"
+	"github.com/Drodrl/competition-engine/models"
+)
+
+// stageContext is what a stage rule sees: the stage being checked, its position and the stage
+// that feeds it (nil for the first stage).
+type stageContext struct {
+	Index           int
+	Stage           models.StageDTO
+	Prev            *models.StageDTO
+	MaxParticipants int
+	MinParticipants func(formatID int) (int, error)
+}
+
+// stageRule checks one stage of a competition and returns why the stage breaks it, or nil.
+type stageRule func(c stageContext) error
+
+// stageRules are applied in order to every stage of a competition, first stage first.
+var stageRules = []stageRule{
+	ruleDrawMode,
+	ruleFormat,
+	rulePoints,
+	ruleResultRules,
+	ruleTiebreakers,
+	ruleThirdPlace,
+	ruleFullBracket,
+	ruleBestOf,
+	ruleHeats,
+	ruleLadder,
+	ruleLegs,
+	ruleAdvancementMap,
+	ruleEntrantCount,
+	ruleStageChain,
+}
+
+// checkStagePipeline runs every stage rule over the stages in order and reports the first
+// failure together with the stage it was found on.
+func checkStagePipeline(stages []models.StageDTO, maxParticipants int, minParticipants func(formatID int) (int, error)) error {
+	if len(stages) == 0 {
+		return errors.New("please add at least one stage before saving")
+	}
+	for i, stage := range stages {
+		c := stageContext{Index: i, Stage: stage, MaxParticipants: maxParticipants, MinParticipants: minParticipants}
+		if i > 0 {
+			c.Prev = &stages[i-1]
+		}
+		for _, rule := range stageRules {
+			if err := rule(c); err != nil {
+				return fmt.Errorf("stage %d (%s): %w", i+1, stage.StageName, err)
+			}
+		}
+	}
+	return nil
+}
+
+func ruleDrawMode(c stageContext) error {
+	if c.Stage.DrawMode != "" && c.Stage.DrawMode != controllers.DrawSeeded && c.Stage.DrawMode != controllers.DrawRandom {
+		return errors.New("draw mode must be 'seeded' or 'random'")
+	}
+	return nil
+}
+
+// ruleEntrantCount checks the stage's entrant count against the format minimum and the
+// competition maximum, and that the stage keeps at least one entrant.
+func ruleEntrantCount(c stageContext) error {
+	s := c.Stage
+	minimum, err := c.MinParticipants(s.TourneyFormatID)
+	if err != nil {
+		return err
+	}
+	if s.ParticipantsAtStart < minimum {
+		return errors.New("this format requires at least " + strconv.Itoa(minimum) + " participants at start")
+	}
+	if s.ParticipantsAtEnd < 1 || s.ParticipantsAtEnd > s.ParticipantsAtStart {
+		return errors.New("participants at end must be between 1 and participants at start")
+	}
+	if c.Index == 0 && c.MaxParticipants > 0 && s.ParticipantsAtStart > c.MaxParticipants {
+		return errors.New("participants at start cannot exceed the competition's maximum of " + strconv.Itoa(c.MaxParticipants))
+	}
+	return nil
+}
+
+// ruleStageChain checks that a stage starts with exactly the entrants the previous stage advances.
+func ruleStageChain(c stageContext) error {
+	if c.Prev == nil || c.Stage.ParticipantsAtStart == c.Prev.ParticipantsAtEnd {
+		return nil
+	}
+	return fmt.Errorf("participants at start (%d) must equal participants at end of stage %d (%d)",
+		c.Stage.ParticipantsAtStart, c.Index, c.Prev.ParticipantsAtEnd)
+}
+
+// ruleFormat checks the stage against the entrant rules of its own format, such as group sizes
+// or the number of Swiss rounds.
+func ruleFormat(c stageContext) error {
+	if c.Stage.NumGroups < 0 {
+		return errors.New("number of groups must be at least 1")
+	}
+	format, err := controllers.LookupFormat(c.Stage.TourneyFormatID)
+	if err != nil {
+		return err
+	}
+	return format.ValidateEntrants(c.Stage)
+}
+
+// rulePoints checks that points are only set on table formats, and that a win is worth at least
+// a draw and a draw at least a loss.
+func rulePoints(c stageContext) error {
+	s := c.Stage
+	if s.PointsWin == nil && s.PointsDraw == nil && s.PointsLoss == nil {
+		return nil
+	}
+	if !controllers.FormatAllowsDraws(s.TourneyFormatID) {
+		return errors.New("points per result can only be set on Round Robin or Swiss stages")
+	}
+	win, draw, loss := 3, 1, 0
+	if s.PointsWin != nil {
+		win = *s.PointsWin
+	}
+	if s.PointsDraw != nil {
+		draw = *s.PointsDraw
+	}
+	if s.PointsLoss != nil {
+		loss = *s.PointsLoss
+	}
+	if win <= loss || draw > win || draw < loss {
+		return errors.New("points must satisfy win > loss and win >= draw >= loss")
+	}
+	return nil
+}
+
+// ruleResultRules checks how walkovers, forfeits and retirements count in a table: only table
+// formats have one, an awarded score cannot be negative and giving a match up cannot be worth
+// more than losing it.
+func ruleResultRules(c stageContext) error {
+	s := c.Stage
+	if s.ForfeitPoints == nil && s.AwardedScore == nil && !s.RetiredAsForfeit {
+		return nil
+	}
+	if !controllers.FormatAllowsDraws(s.TourneyFormatID) {
+		return errors.New("forfeit rules can only be set on Round Robin or Swiss stages")
+	}
+	if s.AwardedScore != nil && *s.AwardedScore < 0 {
+		return errors.New("the awarded score cannot be negative")
+	}
+	loss := 0
+	if s.PointsLoss != nil {
+		loss = *s.PointsLoss
+	}
+	if s.ForfeitPoints != nil && *s.ForfeitPoints > loss {
+		return errors.New("forfeit points cannot be more than the points for a loss")
+	}
+	return nil
+}
+
+// ruleTiebreakers checks the tiebreaker chain; tiebreakers order entrants level on points, so
+// they only apply to table formats.
+func ruleTiebreakers(c stageContext) error {
+	s := c.Stage
+	if s.Tiebreakers == "" {
+		return nil
+	}
+	if s.TourneyFormatID != models.RoundRobin && s.TourneyFormatID != models.Swiss {
+		return errors.New("tiebreakers can only be set on Round Robin or Swiss stages")
+	}
+	_, err := controllers.ParseTiebreakers(s.Tiebreakers)
+	return err
+}
+
+func ruleThirdPlace(c stageContext) error {
+	if c.Stage.ThirdPlaceMatch && c.Stage.TourneyFormatID != models.SingleElimination {
+		return errors.New("a third place match is only available in Single Elimination stages")
+	}
+	return nil
+}
+
+func ruleFullBracket(c stageContext) error {
+	if c.Stage.FullBracket && c.Stage.TourneyFormatID != models.SingleElimination && c.Stage.TourneyFormatID != models.DoubleElimination {
+		return errors.New("a full bracket can only be generated for Single or Double Elimination stages")
+	}
+	return nil
+}
+
+func ruleBestOf(c stageContext) error {
+	if c.Stage.BestOf == nil {
+		return nil
+	}
+	return controllers.ValidateBestOf(*c.Stage.BestOf)
+}
+
+// ruleHeats keeps the heat settings to heats stages. Heats race every entrant at once, so they
+// are not played as series.
+func ruleHeats(c stageContext) error {
+	s := c.Stage
+	if s.TourneyFormatID != models.Heats {
+		if s.HeatSize != nil || s.AdvancePerHeat != nil {
+			return errors.New("heat size and qualifiers per heat can only be set on Heats stages")
+		}
+		return nil
+	}
+	if s.BestOf != nil {
+		return errors.New("heats cannot be played as best-of series")
+	}
+	return nil
+}
+
+// ruleLadder keeps the challenge settings to ladder stages, which always start in seed order.
+func ruleLadder(c stageContext) error {
+	s := c.Stage
+	if s.TourneyFormatID != models.Ladder && (s.ChallengeRange != nil || s.ChallengeCooldownHours != nil) {
+		return errors.New("challenge range and cooldown can only be set on Ladder stages")
+	}
+	if s.TourneyFormatID == models.Ladder && s.DrawMode == controllers.DrawRandom {
+		return errors.New("ladder stages start in seed order and cannot be drawn at random")
+	}
+	return nil
+}
+
+// ruleLegs checks the number of legs: a round robin is played once or home and away, and the
+// pairings of an elimination stage as single matches or two-legged ties. Ties are created round
+// by round and each leg is a single game, so they rule out a full bracket and series. Away goals
+// only settle two-legged ties.
+func ruleLegs(c stageContext) error {
+	s := c.Stage
+	elimination := s.TourneyFormatID == models.SingleElimination || s.TourneyFormatID == models.DoubleElimination
+	twoLegged := s.Legs != nil && *s.Legs == 2
+	if s.AwayGoals && (!elimination || !twoLegged) {
+		return errors.New("away goals only apply to two-legged Single or Double Elimination stages")
+	}
+	if s.Legs == nil {
+		return nil
+	}
+	if s.TourneyFormatID != models.RoundRobin && !elimination {
+		return errors.New("legs can only be set on Round Robin and Single or Double Elimination stages")
+	}
+	if *s.Legs != 1 && !twoLegged {
+		return errors.New("a stage is played over 1 or 2 legs")
+	}
+	if elimination && twoLegged && (s.FullBracket || s.BestOf != nil) {
+		return errors.New("two-legged ties cannot be played as a full bracket or as best-of series")
+	}
+	return nil
+}
+
+// ruleAdvancementMap checks a mapping that seeds this stage from the previous stage's group places.
+func ruleAdvancementMap(c stageContext) error {
+	s := c.Stage
+	if s.AdvancementMap == "" {
+		return nil
+	}
+	if c.Prev == nil {
+		return errors.New("the first stage cannot have an advancement mapping")
+	}
+	prevGroups := c.Prev.NumGroups
+	if prevGroups < 1 {
+		prevGroups = 1
+	}
+	labels := controllers.ParseAdvancementMap(s.AdvancementMap)
+	if len(labels) != s.ParticipantsAtStart {
+		return errors.New("advancement mapping must list one group place per participant at start")
+	}
+	return controllers.ValidateAdvancementMap(labels, prevGroups, c.Prev.ParticipantsAtEnd/prevGroups)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Drodrl/competition-engine/models"
+)
+
+func minTwo(int) (int, error) { return 2, nil }
+
+func TestCheckStagePipeline_ThreeStages(t *testing.T) {
+	rounds := 4
+	stages := []models.StageDTO{
+		{StageName: "Swiss", TourneyFormatID: models.Swiss, ParticipantsAtStart: 16, ParticipantsAtEnd: 8, SwissRounds: &rounds},
+		{StageName: "Playoffs", TourneyFormatID: models.DoubleElimination, ParticipantsAtStart: 8, ParticipantsAtEnd: 4},
+		{StageName: "Final group", TourneyFormatID: models.RoundRobin, ParticipantsAtStart: 4, ParticipantsAtEnd: 1},
+	}
+	if err := checkStagePipeline(stages, 16, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_ChainMismatch(t *testing.T) {
+	stages := []models.StageDTO{
+		{StageName: "Groups", TourneyFormatID: models.RoundRobin, ParticipantsAtStart: 8, ParticipantsAtEnd: 4},
+		{StageName: "Playoffs", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 2, ParticipantsAtEnd: 1},
+	}
+	err := checkStagePipeline(stages, 8, minTwo)
+	want := "stage 2 (Playoffs): participants at start (2) must equal participants at end of stage 1 (4)"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got: %v", want, err)
+	}
+}
+
+func TestCheckStagePipeline_FormatEntrantCount(t *testing.T) {
+	stages := []models.StageDTO{
+		{StageName: "Bracket", TourneyFormatID: models.DoubleElimination, ParticipantsAtStart: 7, ParticipantsAtEnd: 1},
+	}
+	err := checkStagePipeline(stages, 8, minTwo)
+	if err == nil || !strings.HasPrefix(err.Error(), "stage 1 (Bracket): a Double Elimination stage needs a power of two participants at start") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	stages[0].ParticipantsAtStart = 16
+	err = checkStagePipeline(stages, 8, minTwo)
+	if err == nil || !strings.Contains(err.Error(), "maximum of 8") {
+		t.Errorf("expected maximum participants error, got: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_FullBracket(t *testing.T) {
+	stages := []models.StageDTO{
+		{StageName: "Groups", TourneyFormatID: models.RoundRobin, ParticipantsAtStart: 8, ParticipantsAtEnd: 4, FullBracket: true},
+	}
+	err := checkStagePipeline(stages, 8, minTwo)
+	if err == nil || !strings.Contains(err.Error(), "a full bracket can only be generated") {
+		t.Errorf("expected full bracket format error, got: %v", err)
+	}
+
+	stages[0] = models.StageDTO{StageName: "Bracket", TourneyFormatID: models.DoubleElimination, ParticipantsAtStart: 6, ParticipantsAtEnd: 1, FullBracket: true}
+	err = checkStagePipeline(stages, 8, minTwo)
+	if err == nil || !strings.Contains(err.Error(), "needs a power of two") {
+		t.Errorf("expected power of two error, got: %v", err)
+	}
+
+	stages[0].ParticipantsAtStart = 8
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_BestOf(t *testing.T) {
+	bestOf := 4
+	stages := []models.StageDTO{
+		{StageName: "Bracket", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 8, ParticipantsAtEnd: 1, BestOf: &bestOf},
+	}
+	err := checkStagePipeline(stages, 8, minTwo)
+	if err == nil || !strings.Contains(err.Error(), "best of must be a positive odd number") {
+		t.Errorf("expected best of error, got: %v", err)
+	}
+
+	bestOf = 5
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_ResultRules(t *testing.T) {
+	penalty, loss := -1, 0
+	stages := []models.StageDTO{
+		{StageName: "League", TourneyFormatID: models.RoundRobin, ParticipantsAtStart: 8, ParticipantsAtEnd: 4, ForfeitPoints: &penalty, PointsLoss: &loss},
+	}
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	bonus := 1
+	stages[0].ForfeitPoints = &bonus
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "forfeit points cannot be more") {
+		t.Errorf("expected forfeit points error, got: %v", err)
+	}
+
+	stages[0].ForfeitPoints, stages[0].PointsLoss = nil, nil
+	stages[0].TourneyFormatID = models.SingleElimination
+	stages[0].RetiredAsForfeit = true
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "forfeit rules can only be set") {
+		t.Errorf("expected forfeit rules format error, got: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_Heats(t *testing.T) {
+	size, advance := 8, 4
+	stages := []models.StageDTO{
+		{StageName: "Heats", TourneyFormatID: models.Heats, ParticipantsAtStart: 24, ParticipantsAtEnd: 8, HeatSize: &size, AdvancePerHeat: &advance},
+		{StageName: "Playoffs", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 8, ParticipantsAtEnd: 1},
+	}
+	if err := checkStagePipeline(stages, 24, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	advance = 8
+	if err := checkStagePipeline(stages, 24, minTwo); err == nil || !strings.Contains(err.Error(), "cannot advance 8 each") {
+		t.Errorf("expected heat settings error, got: %v", err)
+	}
+
+	advance = 4
+	stages[1].HeatSize = &size
+	if err := checkStagePipeline(stages, 24, minTwo); err == nil || !strings.Contains(err.Error(), "can only be set on Heats stages") {
+		t.Errorf("expected heat settings format error, got: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_Ladder(t *testing.T) {
+	challengeRange, cooldown := 2, 24
+	stages := []models.StageDTO{
+		{StageName: "Ladder", TourneyFormatID: models.Ladder, ParticipantsAtStart: 8, ParticipantsAtEnd: 4, ChallengeRange: &challengeRange, ChallengeCooldownHours: &cooldown},
+		{StageName: "Playoffs", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 4, ParticipantsAtEnd: 1},
+	}
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	challengeRange = 0
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "at least 1 position") {
+		t.Errorf("expected challenge range error, got: %v", err)
+	}
+
+	challengeRange = 2
+	stages[1].ChallengeCooldownHours = &cooldown
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "can only be set on Ladder stages") {
+		t.Errorf("expected challenge settings format error, got: %v", err)
+	}
+
+	stages[1].ChallengeCooldownHours = nil
+	stages[0].DrawMode = "random"
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "cannot be drawn at random") {
+		t.Errorf("expected random ladder draw error, got: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_Legs(t *testing.T) {
+	legs := 2
+	stages := []models.StageDTO{
+		{StageName: "League", TourneyFormatID: models.RoundRobin, ParticipantsAtStart: 8, ParticipantsAtEnd: 4, Legs: &legs},
+		{StageName: "Playoffs", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 4, ParticipantsAtEnd: 1},
+	}
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	legs = 3
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "1 or 2 legs") {
+		t.Errorf("expected legs error, got: %v", err)
+	}
+
+	legs = 2
+	rounds := 3
+	stages[0].TourneyFormatID = models.Swiss
+	stages[0].SwissRounds = &rounds
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "can only be set on Round Robin and") {
+		t.Errorf("expected legs format error, got: %v", err)
+	}
+}
+
+func TestCheckStagePipeline_TwoLeggedTies(t *testing.T) {
+	legs := 2
+	stages := []models.StageDTO{
+		{StageName: "Cup", TourneyFormatID: models.SingleElimination, ParticipantsAtStart: 8, ParticipantsAtEnd: 1, Legs: &legs, AwayGoals: true},
+	}
+	if err := checkStagePipeline(stages, 8, minTwo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	stages[0].FullBracket = true
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "cannot be played as a full bracket") {
+		t.Errorf("expected full bracket error, got: %v", err)
+	}
+
+	stages[0].FullBracket = false
+	stages[0].Legs = nil
+	if err := checkStagePipeline(stages, 8, minTwo); err == nil || !strings.Contains(err.Error(), "away goals only apply") {
+		t.Errorf("expected away goals error, got: %v", err)
+	}
+}
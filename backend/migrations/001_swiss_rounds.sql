@@ -0,0 +1,2 @@
+-- Number of rounds a Swiss stage plays before it is complete.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS swiss_rounds INTEGER;
@@ -0,0 +1,3 @@
+-- Organizer-assigned seeds; NULL means unseeded.
+ALTER TABLE competition_participants ADD COLUMN IF NOT EXISTS seed INTEGER;
+ALTER TABLE stage_participants ADD COLUMN IF NOT EXISTS seed INTEGER;
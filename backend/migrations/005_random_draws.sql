@@ -0,0 +1,4 @@
+-- How first-round entrants are ordered: 'seeded' keeps seed order, 'random' shuffles unseeded entrants.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS draw_mode TEXT NOT NULL DEFAULT 'seeded';
+-- RNG seed used for a random draw, so the draw can be re-derived when audited.
+ALTER TABLE rounds ADD COLUMN IF NOT EXISTS rng_seed BIGINT;
@@ -0,0 +1,4 @@
+-- Number of groups a round robin stage is split into; 1 means a single table.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS num_groups INTEGER NOT NULL DEFAULT 1;
+-- Group (1-based) an entrant was drawn into for a grouped round robin stage.
+ALTER TABLE stage_participants ADD COLUMN IF NOT EXISTS group_number INTEGER;
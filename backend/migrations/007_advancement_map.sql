@@ -0,0 +1,3 @@
+-- Group places seeding this stage from the previous one, in seed order (e.g. 'A1,B1,A2,B2').
+-- NULL uses the default cross-group seeding.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS advancement_map TEXT;
@@ -0,0 +1,2 @@
+-- Single elimination stages can play a match for third place between the semifinal losers.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS third_place_match BOOLEAN NOT NULL DEFAULT false;
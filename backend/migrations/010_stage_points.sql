@@ -0,0 +1,4 @@
+-- Points per match outcome for table formats; NULL falls back to 3 / 1 / 0.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS points_win INTEGER;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS points_draw INTEGER;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS points_loss INTEGER;
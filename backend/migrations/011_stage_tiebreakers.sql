@@ -0,0 +1,3 @@
+-- Comma-separated tiebreaker chain for table stages, e.g. 'head_to_head,score_diff,score_for'.
+-- NULL uses the default chain.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS tiebreakers TEXT;
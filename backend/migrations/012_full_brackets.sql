@@ -0,0 +1,12 @@
+-- Elimination stages can create their whole bracket when they start.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS full_bracket BOOLEAN NOT NULL DEFAULT false;
+
+-- A slot of a pre-generated match that the winner ('W') or loser ('L') of an earlier match takes
+-- once that match is played.
+CREATE TABLE IF NOT EXISTS match_slots (
+    match_id INT NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+    source_match_id INT NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+    source_outcome CHAR(1) NOT NULL CHECK (source_outcome IN ('W', 'L')),
+    filled BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (match_id, source_match_id, source_outcome)
+);
@@ -0,0 +1,15 @@
+-- Matches can be played as best-of-N series. The length is set per stage and can be overridden
+-- per round; NULL on both plays single games.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS best_of INT;
+ALTER TABLE rounds ADD COLUMN IF NOT EXISTS best_of INT;
+
+-- One row per participant and game of a series; match_participants.score holds the games won.
+CREATE TABLE IF NOT EXISTS match_games (
+    match_id INT NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+    game_number INT NOT NULL,
+    user_id INT,
+    team_id INT,
+    score INT,
+    is_winner BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS match_games_match_idx ON match_games (match_id, game_number);
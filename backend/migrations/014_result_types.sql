@@ -0,0 +1,15 @@
+-- How a completed match was decided. Walkovers, forfeits and retirements are won by the other
+-- side; a double forfeit is lost by both and sends nobody on.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS result_type VARCHAR(20) NOT NULL DEFAULT 'played'
+    CHECK (result_type IN ('played', 'walkover', 'forfeit', 'retired', 'double_forfeit'));
+
+-- How a stage's table counts matches that were not played out. forfeit_points goes to the side
+-- that gave a match up (NULL: the points for a loss); awarded_score replaces the score of
+-- walkovers and forfeits, the winner getting it and the loser 0 (NULL: keep the recorded score);
+-- retired_as_forfeit counts retirements as forfeits instead of losses with the score as it stood.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS forfeit_points INT;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS awarded_score INT;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS retired_as_forfeit BOOLEAN NOT NULL DEFAULT false;
+
+-- Disqualified entrants lose every match they have left by walkover and advance no further.
+ALTER TABLE competition_participants ADD COLUMN IF NOT EXISTS disqualified_at TIMESTAMP;
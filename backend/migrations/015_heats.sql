@@ -0,0 +1,14 @@
+-- Matches can race more than two entrants at once. Each participant records a finishing place
+-- (1 is first; equal places for a dead heat) and optionally a finishing time in milliseconds,
+-- alongside the score.
+ALTER TABLE match_participants ADD COLUMN IF NOT EXISTS placement INT;
+ALTER TABLE match_participants ADD COLUMN IF NOT EXISTS time_ms BIGINT;
+
+-- Heats stages split their entrants into heats of at most heat_size and send the best
+-- advance_per_heat of every heat on to the next round, until a single heat is left as the final.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS heat_size INT;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS advance_per_heat INT;
+
+INSERT INTO tournament_formats (tourney_format_id, tourney_name, min_participants)
+VALUES (6, 'Heats', 2)
+ON CONFLICT (tourney_format_id) DO NOTHING;
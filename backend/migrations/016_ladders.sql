@@ -0,0 +1,12 @@
+-- Ladder stages: entrants challenge someone at most challenge_range positions above them
+-- (NULL: 1) and a winning challenger swaps places with them. An entrant who has played a ladder
+-- match cannot challenge or be challenged again for challenge_cooldown_hours (NULL: no wait).
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS challenge_range INT;
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS challenge_cooldown_hours INT;
+
+-- Current position (1 is the top) of an entrant on a ladder stage; NULL outside ladders.
+ALTER TABLE stage_participants ADD COLUMN IF NOT EXISTS ladder_position INT;
+
+INSERT INTO tournament_formats (tourney_format_id, tourney_name, min_participants)
+VALUES (7, 'Ladder', 2)
+ON CONFLICT (tourney_format_id) DO NOTHING;
@@ -0,0 +1,8 @@
+-- Stages are played over one leg (NULL: 1) or 2. Round robin stages play a second cycle with
+-- every pairing's home and away swapped; single and double elimination stages play every
+-- pairing as a two-legged tie, see 018_ties.sql.
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS legs INT;
+
+-- Side of an entrant in a match played home and away; NULL for matches without sides.
+ALTER TABLE match_participants ADD COLUMN IF NOT EXISTS side TEXT
+    CHECK (side IN ('home', 'away'));
@@ -0,0 +1,8 @@
+-- Legs of a two-legged knockout tie: 1 and 2 for the legs, 3 for the decider played when the
+-- aggregate is level. Every match of a tie points at its first leg, which identifies the tie.
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS leg INT CHECK (leg BETWEEN 1 AND 3);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS first_leg_id INT REFERENCES matches(match_id);
+
+-- Whether a level aggregate in a two-legged tie goes to the entrant with more away goals before
+-- a decider is played (NULL: no).
+ALTER TABLE competition_stages ADD COLUMN IF NOT EXISTS away_goals BOOLEAN;
@@ -0,0 +1,4 @@
+-- Entrants a random draw was applied to, in seed order, as a JSON array of
+-- {"user_id", "team_id", "seed"}. Together with rng_seed it re-derives the draw even after the
+-- stage's seeds are changed. NULL for rounds drawn before it was recorded.
+ALTER TABLE rounds ADD COLUMN IF NOT EXISTS draw_entrants JSONB;
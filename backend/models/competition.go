@@ -18,31 +18,160 @@ type Competition struct {
 }
 
 type StageDTO struct {
-	StageID             int    `json:"stage_id"`
-	StageName           string `json:"stage_name"`
-	StageOrder          int    `json:"stage_order"`
-	TourneyFormatID     int    `json:"tourney_format_id"`
-	ParticipantsAtStart int    `json:"participants_at_start"`
-	ParticipantsAtEnd   int    `json:"participants_at_end"`
+	StageID                int    `json:"stage_id"`
+	StageName              string `json:"stage_name"`
+	StageOrder             int    `json:"stage_order"`
+	TourneyFormatID        int    `json:"tourney_format_id"`
+	ParticipantsAtStart    int    `json:"participants_at_start"`
+	ParticipantsAtEnd      int    `json:"participants_at_end"`
+	SwissRounds            *int   `json:"swiss_rounds"`
+	DrawMode               string `json:"draw_mode"`
+	NumGroups              int    `json:"num_groups"`
+	AdvancementMap         string `json:"advancement_map"`
+	ThirdPlaceMatch        bool   `json:"third_place_match"`
+	PointsWin              *int   `json:"points_win"`
+	PointsDraw             *int   `json:"points_draw"`
+	PointsLoss             *int   `json:"points_loss"`
+	Tiebreakers            string `json:"tiebreakers"`
+	FullBracket            bool   `json:"full_bracket"`
+	BestOf                 *int   `json:"best_of"`
+	ForfeitPoints          *int   `json:"forfeit_points"`
+	AwardedScore           *int   `json:"awarded_score"`
+	RetiredAsForfeit       bool   `json:"retired_as_forfeit"`
+	HeatSize               *int   `json:"heat_size"`
+	AdvancePerHeat         *int   `json:"advance_per_heat"`
+	ChallengeRange         *int   `json:"challenge_range"`
+	ChallengeCooldownHours *int   `json:"challenge_cooldown_hours"`
+	Legs                   *int   `json:"legs"`
+	AwayGoals              bool   `json:"away_goals"`
 }
 
 type StageRound struct {
-	RoundID     int `json:"round_id"`
-	StageID     int `json:"stage_id"`
-	RoundNumber int `json:"round_number"`
+	RoundID     int     `json:"round_id"`
+	StageID     int     `json:"stage_id"`
+	RoundNumber int     `json:"round_number"`
+	Bracket     *string `json:"bracket"`
 }
 
 type Match struct {
-	MatchID     int        `json:"match_id"`
-	RoundID     int        `json:"round_id"`
-	ScheduledAt *time.Time `json:"scheduled_at"`
-	CompletedAt *time.Time `json:"completed_at"`
+	MatchID     int         `json:"match_id"`
+	RoundID     int         `json:"round_id"`
+	ScheduledAt *time.Time  `json:"scheduled_at"`
+	CompletedAt *time.Time  `json:"completed_at"`
+	ResultType  string      `json:"result_type"`
+	BestOf      int         `json:"best_of"`
+	Leg         *int        `json:"leg"`
+	FirstLegID  *int        `json:"first_leg_id"`
+	Games       []MatchGame `json:"games"`
 }
 
-type MatchParticipant struct {
-	MatchID  int  `json:"match_id"`
+// MatchGame is one game of a best-of series, with every participant's result in it.
+type MatchGame struct {
+	GameNumber int          `json:"game_number"`
+	Results    []GameResult `json:"results"`
+}
+
+type GameResult struct {
 	UserID   *int `json:"user_id"`
 	TeamID   *int `json:"team_id"`
-	IsWinner bool `json:"is_winner"`
 	Score    *int `json:"score"`
+	IsWinner bool `json:"is_winner"`
+}
+
+type MatchParticipant struct {
+	MatchID   int     `json:"match_id"`
+	UserID    *int    `json:"user_id"`
+	TeamID    *int    `json:"team_id"`
+	IsWinner  bool    `json:"is_winner"`
+	Score     *int    `json:"score"`
+	Placement *int    `json:"placement"`
+	TimeMs    *int    `json:"time_ms"`
+	Side      *string `json:"side"`
+}
+
+type Entrant struct {
+	UserID *int `json:"user_id"`
+	TeamID *int `json:"team_id"`
+}
+
+type Standing struct {
+	Rank         int    `json:"rank"`
+	Group        int    `json:"group"`
+	UserID       *int   `json:"user_id"`
+	TeamID       *int   `json:"team_id"`
+	Played       int    `json:"played"`
+	Won          int    `json:"won"`
+	Drawn        int    `json:"drawn"`
+	Lost         int    `json:"lost"`
+	ScoreFor     int    `json:"score_for"`
+	ScoreAgainst int    `json:"score_against"`
+	ScoreDiff    int    `json:"score_diff"`
+	Points       int    `json:"points"`
+	SeparatedBy  string `json:"separated_by,omitempty"`
+}
+
+type DrawAudit struct {
+	RoundID     int         `json:"round_id"`
+	StageID     int         `json:"stage_id"`
+	RoundNumber int         `json:"round_number"`
+	RNGSeed     int64       `json:"rng_seed"`
+	DrawOrder   []Entrant   `json:"draw_order"`
+	Derived     [][]Entrant `json:"derived_matches"`
+	Actual      [][]Entrant `json:"actual_matches"`
+	Verified    bool        `json:"verified"`
+}
+
+// BracketRound is a round of a stage's bracket with every match in it, played or not.
+type BracketRound struct {
+	RoundID     int            `json:"round_id"`
+	RoundNumber int            `json:"round_number"`
+	Bracket     *string        `json:"bracket"`
+	Matches     []BracketMatch `json:"matches"`
+}
+
+// BracketMatch is a match of a bracket: the participants known so far and placeholders for
+// those still to come from earlier matches.
+type BracketMatch struct {
+	MatchID      int                `json:"match_id"`
+	Completed    bool               `json:"completed"`
+	Participants []MatchParticipant `json:"participants"`
+	Placeholders []BracketSlot      `json:"placeholders"`
+}
+
+// BracketSlot is a place in a match still waiting on the winner or loser of another match.
+// Outcome is "winner" or "loser".
+type BracketSlot struct {
+	SourceMatchID int    `json:"source_match_id"`
+	Outcome       string `json:"outcome"`
+	Label         string `json:"label"`
+}
+
+// Correction reports what correcting a match result changed further on in its stage.
+type Correction struct {
+	MatchID int   `json:"match_id"`
+	Swapped []int `json:"swapped_matches"`
+	Voided  []int `json:"voided_matches"`
+	Removed []int `json:"removed_matches"`
+}
+
+// Disqualification reports the matches awarded as walkovers when an entrant was disqualified.
+type Disqualification struct {
+	UserID    *int  `json:"user_id,omitempty"`
+	TeamID    *int  `json:"team_id,omitempty"`
+	Walkovers []int `json:"walkover_matches"`
+}
+
+// LadderRung is an entrant's position on a ladder, 1 being the top.
+type LadderRung struct {
+	Position     int  `json:"position"`
+	UserID       *int `json:"user_id,omitempty"`
+	TeamID       *int `json:"team_id,omitempty"`
+	Disqualified bool `json:"disqualified,omitempty"`
+}
+
+// Challenge is a ladder match created by a challenge, with both entrants' positions when it was made.
+type Challenge struct {
+	MatchID    int        `json:"match_id"`
+	Challenger LadderRung `json:"challenger"`
+	Challenged LadderRung `json:"challenged"`
 }
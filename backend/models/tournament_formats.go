@@ -5,4 +5,6 @@ const (
 	DoubleElimination = 2
 	RoundRobin        = 3
 	Swiss             = 5
+	Heats             = 6
+	Ladder            = 7
 )
@@ -29,7 +29,10 @@ func NewRouter(db *sql.DB) http.Handler {
 	router.Handle("/api/competitions/{competitionId}/status", EnableCORS(handlers.CompetitionByIDHandler())).Methods("PATCH")
 	router.Handle("/api/competitions/{competitionId}/participants", EnableCORS(http.HandlerFunc(handlers.GetParticipantsByCompetitionID))).Methods("GET")
 	router.Handle("/api/competitions/{competitionId}/finish", EnableCORS(http.HandlerFunc(handlers.FinishCompetition))).Methods("POST")
+	router.Handle("/api/competitions/{competitionId}/disqualify", EnableCORS(http.HandlerFunc(handlers.DisqualifyParticipant))).Methods("POST")
 	router.Handle("/api/competitions/flag_teams/{flagTeams}", EnableCORS(http.HandlerFunc(handlers.GetCompetitionsByFlagTeams))).Methods("GET")
+	router.Handle("/api/competitions/{competitionId}/seeds", EnableCORS(http.HandlerFunc(handlers.GetCompetitionSeeds))).Methods("GET")
+	router.Handle("/api/competitions/{competitionId}/seeds", EnableCORS(http.HandlerFunc(handlers.SetCompetitionSeeds))).Methods("PUT")
 
 	// --- Competition Stages ---
 	router.Handle("/api/competitions/{competitionId}/stages", EnableCORS(http.HandlerFunc(handlers.GetStagesByCompetitionID))).Methods("GET")
@@ -41,13 +44,24 @@ func NewRouter(db *sql.DB) http.Handler {
 	router.Handle("/api/stages/{stageId}/rounds", EnableCORS(http.HandlerFunc(handlers.GetRoundsByStageID))).Methods("GET")
 	router.Handle("/api/stages/{stageId}/generate-next-round", EnableCORS(http.HandlerFunc(handlers.GenerateNextRound))).Methods("POST")
 	router.Handle("/api/stages/{stageId}/can-generate-next-round", EnableCORS(http.HandlerFunc(handlers.CanGenerateNextRound))).Methods("GET")
-	router.Handle("/api/stages/{stageId}/advance", EnableCORS(http.HandlerFunc(handlers.AdvanceAfterRoundRobin))).Methods("POST")
+	router.Handle("/api/stages/{stageId}/advance", EnableCORS(http.HandlerFunc(handlers.AdvanceStage))).Methods("POST")
+	router.Handle("/api/stages/{stageId}/standings", EnableCORS(http.HandlerFunc(handlers.GetStageStandings))).Methods("GET")
+	router.Handle("/api/stages/{stageId}/bracket", EnableCORS(http.HandlerFunc(handlers.GetStageBracket))).Methods("GET")
+	router.Handle("/api/stages/{stageId}/seeds", EnableCORS(http.HandlerFunc(handlers.SetStageSeeds))).Methods("PUT")
+	router.Handle("/api/stages/{stageId}/ladder", EnableCORS(http.HandlerFunc(handlers.GetStageLadder))).Methods("GET")
+	router.Handle("/api/stages/{stageId}/challenges", EnableCORS(http.HandlerFunc(handlers.CreateChallenge))).Methods("POST")
 
 	// --- Matches ---
 	router.Handle("/api/rounds/{roundId}/matches", EnableCORS(http.HandlerFunc(handlers.GetMatchesByRoundID))).Methods("GET")
+	router.Handle("/api/rounds/{roundId}/draw", EnableCORS(http.HandlerFunc(handlers.GetRoundDrawAudit))).Methods("GET")
+	router.Handle("/api/rounds/{roundId}/best-of", EnableCORS(http.HandlerFunc(handlers.SetRoundBestOf))).Methods("PUT")
 	router.Handle("/api/matches/{matchId}/participants", EnableCORS(http.HandlerFunc(handlers.GetMatchParticipants))).Methods("GET")
 	router.Handle("/api/matches/{matchId}/participants", EnableCORS(http.HandlerFunc(handlers.UpdateMatchResult))).Methods("PUT")
 	router.Handle("/api/matches/{matchId}/results", EnableCORS(http.HandlerFunc(handlers.SaveMatchResults))).Methods("PUT")
+	router.Handle("/api/matches/{matchId}/correction", EnableCORS(http.HandlerFunc(handlers.CorrectMatchResult))).Methods("PUT")
+	router.Handle("/api/matches/{matchId}/outcome", EnableCORS(http.HandlerFunc(handlers.RecordMatchOutcome))).Methods("PUT")
+	router.Handle("/api/matches/{matchId}/games", EnableCORS(http.HandlerFunc(handlers.GetMatchGames))).Methods("GET")
+	router.Handle("/api/matches/{matchId}/games", EnableCORS(http.HandlerFunc(handlers.RecordMatchGame))).Methods("POST")
 
 	// --- Lookup/Reference Data ---
 	router.Handle("/api/sports", EnableCORS(handlers.GetSportsHandler(db))).Methods("GET")